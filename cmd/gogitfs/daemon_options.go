@@ -4,16 +4,31 @@ import (
 	"flag"
 	"gogitfs/pkg/daemon"
 	"gogitfs/pkg/logging"
+	"time"
 )
 
 // CLI flag names
 const (
 	logLevelFlag      = "log-level"
+	logFormatFlag     = "log-format"
 	fuseDebugFlag     = "fuse-debug"
 	allowNonEmptyFlag = "allow-nonempty"
 	uidFlag           = "uid"
 	gidFlag           = "gid"
 	allowOtherFlag    = "allow-other"
+
+	detectDotGitFlag          = "detect-dot-git"
+	enableDotGitCommonDirFlag = "enable-dot-git-common-dir"
+
+	cacheDirFlag      = "cache-dir"
+	fetchIntervalFlag = "fetch-interval"
+
+	metricsAddrFlag = "metrics-addr"
+
+	writableRefsFlag = "writable-refs"
+	commitAuthorFlag = "commit-author"
+
+	rawLFSPointersFlag = "raw-lfs-pointers"
 )
 
 // gogitfsDaemon describes a daemon process handling the mounted repository
@@ -24,6 +39,7 @@ type gogitfsDaemon struct {
 	mountDir string
 
 	logLevel  logging.LogLevelFlag
+	logFormat logging.LogFormatFlag
 	fuseDebug bool
 
 	allowNonEmpty bool
@@ -31,11 +47,26 @@ type gogitfsDaemon struct {
 	uid        int64
 	gid        int64
 	allowOther bool
+
+	detectDotGit          bool
+	enableDotGitCommonDir bool
+
+	cacheDir      string
+	fetchInterval time.Duration
+
+	metricsAddr string
+
+	writableRefs bool
+	commitAuthor string
+
+	rawLFSPointers bool
 }
 
 func (d *gogitfsDaemon) Setup() {
 	d.logLevel = logging.Info
 	flag.Var(&d.logLevel, logLevelFlag, "log level, can be given as upper-case string or an integer")
+	d.logFormat = logging.Text
+	flag.Var(&d.logFormat, logFormatFlag, "log format, \"text\" or \"json\"")
 	flag.BoolVar(&d.fuseDebug, fuseDebugFlag, false, "show FUSE debug info in logs")
 
 	flag.BoolVar(&d.allowNonEmpty, allowNonEmptyFlag, false, "allow mounting in a non-empty directory")
@@ -43,11 +74,40 @@ func (d *gogitfsDaemon) Setup() {
 	flag.Int64Var(&d.uid, uidFlag, -1, "UID (user ID) to mount as; pass -1 to use current user's ID")
 	flag.Int64Var(&d.gid, gidFlag, -1, "GID (group ID) to mount as; pass -1 to use current user group's ID")
 	flag.BoolVar(&d.allowOther, allowOtherFlag, false, "mount FUSE filesystem with 'allow_other'")
+
+	flag.BoolVar(&d.detectDotGit, detectDotGitFlag, false, "search for the repository in parent directories of repo-dir")
+	flag.BoolVar(
+		&d.enableDotGitCommonDir,
+		enableDotGitCommonDirFlag,
+		true,
+		"respect the commondir file, allowing linked worktrees to be mounted",
+	)
+
+	flag.StringVar(&d.cacheDir, cacheDirFlag, "", "where to store mirrors of remote repositories; "+
+		"if empty, the gogitfs subdirectory of the user cache directory is used")
+	flag.DurationVar(
+		&d.fetchInterval,
+		fetchIntervalFlag,
+		0,
+		"how often to fetch changes to a mirrored remote repository; pass 0 to only fetch when mounting",
+	)
+
+	flag.StringVar(&d.metricsAddr, metricsAddrFlag, "", "serve metrics in the Prometheus format at this address, "+
+		"either unix:<socket-path> or localhost:<port>; if empty, metrics are not served")
+
+	flag.BoolVar(&d.writableRefs, writableRefsFlag, false, "allow creating and deleting branches and tags "+
+		"by creating symlinks in the branches and tags directories (deleted with rmdir and rm respectively), "+
+		"and creating commits in staging")
+	flag.StringVar(&d.commitAuthor, commitAuthorFlag, "", "author of commits created in staging directories, "+
+		"as \"Name <email>\"; if empty, user.name and user.email from git config are used")
+
+	flag.BoolVar(&d.rawLFSPointers, rawLFSPointersFlag, false, "serve Git LFS pointer files as they are, "+
+		"instead of the contents of the objects from lfs/objects in the git directory")
 }
 
 func (d *gogitfsDaemon) PositionalArgs() []daemon.PositionalArg {
 	return []daemon.PositionalArg{
-		{Name: "repo-dir", Usage: "path to the repository"},
+		{Name: "repo-dir", Usage: "path to the repository, or URL of a remote repository to mirror"},
 		{Name: "mount-dir", Usage: "where to mount the repository"},
 	}
 }
@@ -66,11 +126,20 @@ func (d *gogitfsDaemon) HandlePositionalArgs(args []string) error {
 func (d *gogitfsDaemon) Serialize() []string {
 	return []string{
 		daemon.SerializeStringFlag(logLevelFlag, d.logLevel.String()),
+		daemon.SerializeStringFlag(logFormatFlag, d.logFormat.String()),
 		daemon.SerializeBoolFlag(fuseDebugFlag, d.fuseDebug),
 		daemon.SerializeBoolFlag(allowNonEmptyFlag, d.allowNonEmpty),
 		daemon.SerializeIntFlag(uidFlag, d.uid),
 		daemon.SerializeIntFlag(gidFlag, d.gid),
 		daemon.SerializeBoolFlag(allowOtherFlag, d.allowOther),
+		daemon.SerializeBoolFlag(detectDotGitFlag, d.detectDotGit),
+		daemon.SerializeBoolFlag(enableDotGitCommonDirFlag, d.enableDotGitCommonDir),
+		daemon.SerializeStringFlag(cacheDirFlag, d.cacheDir),
+		daemon.SerializeStringFlag(fetchIntervalFlag, d.fetchInterval.String()),
+		daemon.SerializeStringFlag(metricsAddrFlag, d.metricsAddr),
+		daemon.SerializeBoolFlag(writableRefsFlag, d.writableRefs),
+		daemon.SerializeStringFlag(commitAuthorFlag, d.commitAuthor),
+		daemon.SerializeBoolFlag(rawLFSPointersFlag, d.rawLFSPointers),
 		d.repoDir,
 		d.mountDir,
 	}
@@ -80,9 +80,20 @@ func ParseFlags(ca CliArgs, parentSetup func()) error {
 	return err
 }
 
+// environmentArgs serializes the flags defined by environment.SetupFlags.
+func environmentArgs() []string {
+	return []string{
+		SerializeStringFlag("log-path", environment.LogFileName),
+		SerializeIntFlag("log-max-size", environment.LogMaxSize),
+		SerializeIntFlag("log-max-files", int64(environment.LogMaxFiles)),
+		SerializeBoolFlag("log-compress", environment.LogCompress),
+	}
+}
+
 func argsToFullList(ca SerializableCliArgs) []string {
-	// prepend process name to arguments
+	// prepend process name and environment flags to arguments
 	result := []string{os.Args[0]}
+	result = append(result, environmentArgs()...)
 	result = append(result, ca.Serialize()...)
 	return result
 }
@@ -7,6 +7,9 @@ import (
 	"gogitfs/pkg/daemon/internal/environment"
 	"gogitfs/pkg/daemon/internal/error_handling"
 	"gogitfs/pkg/error_handler"
+	"gogitfs/pkg/logging"
+	"golang.org/x/sys/unix"
+	"os"
 )
 
 // Daemon is an interface for types representing daemon processes.
@@ -68,6 +71,42 @@ func childProcessPostSpawn(daemonObj Daemon, envInfo error_handling.EnvInfo) {
 		panic("Unable to setup daemon error sender\nError: " + err.Error())
 	}
 	defer sender.Close()
+	err = setupLogRotation()
+	if err != nil {
+		sender.HandleError(fmt.Errorf("cannot setup log rotation: %w", err))
+	}
 	// run actual process code
 	daemonObj.DaemonMain(sender, sender)
 }
+
+// redirectStdStreams makes standard output and error refer to `file`, so that messages which don't go through
+// the logging package, such as panics, are written to the current log file.
+func redirectStdStreams(file *os.File) error {
+	for _, fd := range []int{int(os.Stdout.Fd()), int(os.Stderr.Fd())} {
+		if err := unix.Dup2(int(file.Fd()), fd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupLogRotation makes the loggers write to a rotating log file, as specified by the environment flags.
+// Standard output and error of the daemon process are redirected to the log file by go-daemon; after each rotation
+// they're redirected to the new file.
+func setupLogRotation() error {
+	if environment.LogMaxSize <= 0 {
+		return nil
+	}
+	file, err := logging.OpenRotatingFile(
+		environment.LogFileName,
+		environment.LogMaxSize*1024*1024,
+		environment.LogMaxFiles,
+		environment.LogCompress,
+	)
+	if err != nil {
+		return err
+	}
+	file.OnRotate = redirectStdStreams
+	logging.SetOutput(file)
+	return nil
+}
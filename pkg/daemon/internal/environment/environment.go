@@ -13,6 +13,15 @@ var DaemonParentPid int
 
 var LogFileName string
 
+// LogMaxSize is the size of the log file in megabytes above which it's rotated. If 0, the log is never rotated.
+var LogMaxSize int64
+
+// LogMaxFiles is the number of rotated log files which are kept.
+var LogMaxFiles int
+
+// LogCompress specifies whether rotated log files are compressed with gzip.
+var LogCompress bool
+
 // Init initializes global variables defined in this package, setting daemon name according to args
 // and daemon parent PID by taking current process' PID.
 func Init(daemonName string) {
@@ -28,4 +37,8 @@ func Init(daemonName string) {
 // SetupFlags adds necessary command-line flags.
 func SetupFlags() {
 	flag.StringVar(&LogFileName, "log-path", "", "log file name")
+	flag.Int64Var(&LogMaxSize, "log-max-size", 10, "size of the log file in megabytes above which it's rotated, "+
+		"0 to disable rotation")
+	flag.IntVar(&LogMaxFiles, "log-max-files", 5, "number of rotated log files to keep")
+	flag.BoolVar(&LogCompress, "log-compress", false, "compress rotated log files with gzip")
 }
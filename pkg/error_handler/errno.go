@@ -0,0 +1,99 @@
+package error_handler
+
+import (
+	"context"
+	"errors"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"gogitfs/pkg/logging"
+	"gogitfs/pkg/metrics"
+	"golang.org/x/sys/unix"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// notFoundErrors are errors signifying that the requested object does not exist.
+var notFoundErrors = []error{
+	os.ErrNotExist,
+	plumbing.ErrObjectNotFound,
+	plumbing.ErrReferenceNotFound,
+	object.ErrFileNotFound,
+	object.ErrDirectoryNotFound,
+	object.ErrEntryNotFound,
+}
+
+// Errno returns the errno which should be reported for the error:
+// * 0 for nil,
+// * the errno itself, if the error wraps a syscall.Errno,
+// * ENOENT if the error signifies a missing file, object or reference,
+// * EACCES for permission errors,
+// * EINTR if the operation was cancelled,
+// * EIO otherwise.
+func Errno(err error) syscall.Errno {
+	if err == nil {
+		return 0
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno
+	}
+	for _, target := range notFoundErrors {
+		if errors.Is(err, target) {
+			return syscall.ENOENT
+		}
+	}
+	if errors.Is(err, os.ErrPermission) {
+		return syscall.EACCES
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return syscall.EINTR
+	}
+	return syscall.EIO
+}
+
+// fuseErrors counts the errors handled by NodeErrorHandler.
+var fuseErrors = metrics.Default.NewCounterVec(
+	"gogitfs_fuse_errors_total",
+	"Errors returned by filesystem operations, by node type and errno.",
+	"node", "errno",
+)
+
+// NodeErrorHandler handles errors occurring in FUSE callbacks. Instead of terminating the program, the error
+// is logged along with the context of the call, and converted to an errno, so that only the operation
+// on the given path fails. The handler also counts the failures of each node type.
+type NodeErrorHandler struct {
+	lock     sync.Mutex
+	failures map[string]uint64
+}
+
+// HandleNodeError logs an error which occurred in a method of `node` while handling the request described by ctx,
+// increments the failure counter of the node's type (also exposed as the metric gogitfs_fuse_errors_total)
+// and returns the errno which should be reported to the kernel, see Errno.
+func (h *NodeErrorHandler) HandleNodeError(ctx context.Context, node logging.CallCtxGetter, err error) syscall.Errno {
+	errno := Errno(err)
+	nodeType := logging.TypeName(node)
+	h.lock.Lock()
+	if h.failures == nil {
+		h.failures = make(map[string]uint64)
+	}
+	h.failures[nodeType]++
+	h.lock.Unlock()
+	fuseErrors.Inc(nodeType, unix.ErrnoName(errno))
+	logging.LogError(ctx, 1, node, err, logging.CallCtx{"errno": unix.ErrnoName(errno)})
+	return errno
+}
+
+// Failures returns the number of failures of each node type.
+func (h *NodeErrorHandler) Failures() map[string]uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	result := make(map[string]uint64, len(h.failures))
+	for k, v := range h.failures {
+		result[k] = v
+	}
+	return result
+}
+
+// Fuse handler is used for errors in FUSE callbacks, see NodeErrorHandler.
+var Fuse = &NodeErrorHandler{}
@@ -0,0 +1,60 @@
+package error_handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"gogitfs/pkg/logging"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestErrno(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected syscall.Errno
+	}{
+		{"nil", nil, 0},
+		{"errno", fmt.Errorf("foo: %w", syscall.EROFS), syscall.EROFS},
+		{"not exist", fmt.Errorf("foo: %w", os.ErrNotExist), syscall.ENOENT},
+		{"object not found", fmt.Errorf("foo: %w", plumbing.ErrObjectNotFound), syscall.ENOENT},
+		{"reference not found", fmt.Errorf("foo: %w", plumbing.ErrReferenceNotFound), syscall.ENOENT},
+		{"permission", fmt.Errorf("foo: %w", os.ErrPermission), syscall.EACCES},
+		{"cancelled", fmt.Errorf("foo: %w", context.Canceled), syscall.EINTR},
+		{"other", errors.New("foo"), syscall.EIO},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Errno(tc.err), "incorrect errno")
+		})
+	}
+}
+
+type testNode struct{}
+
+func (n *testNode) GetCallCtx() logging.CallCtx {
+	return logging.CallCtx{"foo": "bar"}
+}
+
+type otherTestNode struct {
+	testNode
+}
+
+func TestNodeErrorHandler(t *testing.T) {
+	logging.Init(logging.Debug)
+	h := &NodeErrorHandler{}
+	assert.Empty(t, h.Failures(), "there should be no failures initially")
+
+	errno := h.HandleNodeError(context.Background(), &testNode{}, errors.New("foo"))
+	assert.Equal(t, syscall.EIO, errno, "incorrect errno")
+	errno = h.HandleNodeError(context.Background(), &testNode{}, os.ErrNotExist)
+	assert.Equal(t, syscall.ENOENT, errno, "incorrect errno")
+	h.HandleNodeError(context.Background(), &otherTestNode{}, errors.New("foo"))
+
+	expected := map[string]uint64{"testNode": 2, "otherTestNode": 1}
+	assert.Equal(t, expected, h.Failures(), "incorrect failure counts")
+}
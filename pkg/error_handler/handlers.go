@@ -44,4 +44,5 @@ func (h fatalErrorHandler) HandleError(err error) {
 }
 
 // Fatal handler displays a message with level "ERROR" and terminates the program.
+// It must not be used in FUSE callbacks, since it would leave a broken mount - use Fuse instead.
 var Fatal fatalErrorHandler
@@ -4,9 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
 	"gogitfs/pkg/error_handler"
@@ -39,35 +39,38 @@ type headLinkNode struct {
 	repoNode
 }
 
+// GetCallCtx returns information about the node and the current HEAD commit.
+// If the HEAD commit cannot be read, the error is included instead.
 func (n *headLinkNode) GetCallCtx() logging.CallCtx {
+	info := utils.NodeCallCtx(n)
 	commit, err := headCommit(n)
 	if err != nil {
-		error_handler.Fatal.HandleError(fmt.Errorf("cannot get HEAD commit object: %w", err))
+		info["headErr"] = err.Error()
+		return info
 	}
-	info := utils.NodeCallCtx(n)
 	info["headHash"] = commit.Hash.String()
 	info["headMsg"] = commit.Message
 	return info
 }
 
 // Readlink returns the path to the current HEAD commit.
-func (n *headLinkNode) Readlink(_ context.Context) ([]byte, syscall.Errno) {
-	logging.LogCall(n, nil)
+func (n *headLinkNode) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
 	head, err := n.repo.Head()
 	if err != nil {
-		error_handler.Logging.HandleError(fmt.Errorf("cannot get HEAD object: %w", err))
-		return nil, syscall.EIO
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get HEAD object: %w", err))
 	}
 	return []byte(head.Hash().String()), fs.OK
 }
 
 // Getattr returns attributes corresponding to the current HEAD commit.
-func (n *headLinkNode) Getattr(_ context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
-	logging.LogCall(n, nil)
+func (n *headLinkNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
 	attr, err := headAttr(n)
 	if err != nil {
-		error_handler.Logging.HandleError(fmt.Errorf("cannot get HEAD commit attributes: %w", err))
-		return syscall.EIO
+		return error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get HEAD commit attributes: %w", err))
 	}
 	out.Attr = attr
 	out.Attr.Mode = 0555
@@ -92,9 +95,21 @@ type commitDirStream struct {
 	stop chan<- int
 }
 
-// readCommitIter reads the commits from `iter`, generates corresponding entries and places them in the channel `next`.
-// If a value is read from `stop`, the function returns immediately.
-func readCommitIter(iter object.CommitIter, next chan<- *fuse.DirEntry, stop <-chan int) {
+// commitEntryFunc creates the directory entry representing a commit.
+type commitEntryFunc func(commit *object.Commit) fuse.DirEntry
+
+// commitDirEntry creates an entry for the directory representing a commit in the directory of all commits.
+func (c *fsContext) commitDirEntry(commit *object.Commit) fuse.DirEntry {
+	var entry fuse.DirEntry
+	entry.Name = commit.Hash.String()
+	entry.Ino = c.commitCache.AttrStore.GetOrInsert(commit.Hash.String(), false).Ino
+	entry.Mode = fuse.S_IFDIR
+	return entry
+}
+
+// readCommitIter reads the commits from `iter`, generates corresponding entries using `makeEntry`
+// and places them in the channel `next`. If a value is read from `stop`, the function returns immediately.
+func readCommitIter(iter object.CommitIter, makeEntry commitEntryFunc, next chan<- *fuse.DirEntry, stop <-chan int) {
 	funcName := logging.CurrentFuncName(0, logging.Package)
 	err := iter.ForEach(func(commit *object.Commit) error {
 		logging.DebugLog.Printf(
@@ -104,13 +119,10 @@ func readCommitIter(iter object.CommitIter, next chan<- *fuse.DirEntry, stop <-c
 			strings.Replace(commit.Message, "\n", ";", -1),
 		)
 
-		var entry fuse.DirEntry
-		entry.Name = commit.Hash.String()
-		entry.Ino = commitCache.AttrStore.GetOrInsert(commit.Hash.String(), false).Ino
-		entry.Mode = fuse.S_IFDIR
+		entry := makeEntry(commit)
 		select {
 		case <-stop:
-			return nil
+			return storer.ErrStop
 		case next <- &entry:
 		}
 		return nil
@@ -122,17 +134,18 @@ func readCommitIter(iter object.CommitIter, next chan<- *fuse.DirEntry, stop <-c
 }
 
 // newCommitDirStream creates a new commitDirStream from the commit iterator and an optional HEAD symlink node.
-func newCommitDirStream(iter object.CommitIter, headLink *fs.Inode) *commitDirStream {
+// Entries representing commits are created using `makeEntry`.
+func newCommitDirStream(iter object.CommitIter, headLink *fs.Inode, makeEntry commitEntryFunc) *commitDirStream {
 	rest := make(chan *fuse.DirEntry, 5)
 	stop := make(chan int, 1)
-	go readCommitIter(iter, rest, stop)
+	go readCommitIter(iter, makeEntry, rest, stop)
 	ds := &commitDirStream{headLink: headLink, rest: rest, stop: stop}
 	return ds
 }
 
 // HasNext returns true if there are more entries.
 func (s *commitDirStream) HasNext() bool {
-	logging.LogCall(logging.NilCtx{}, logging.CallCtx{})
+	logging.LogCall(context.Background(), logging.NilCtx{}, logging.CallCtx{})
 	if s.next == nil {
 		s.next = <-s.rest
 	}
@@ -141,7 +154,7 @@ func (s *commitDirStream) HasNext() bool {
 
 // Next returns the next entry. Note that this function depends on HasNext being called first.
 func (s *commitDirStream) Next() (entry fuse.DirEntry, errno syscall.Errno) {
-	logging.LogCall(logging.NilCtx{}, logging.CallCtx{})
+	logging.LogCall(context.Background(), logging.NilCtx{}, logging.CallCtx{})
 	if s.headLink != nil {
 		entry.Name = "HEAD"
 		entry.Mode = fuse.S_IFLNK
@@ -160,7 +173,7 @@ func (s *commitDirStream) Next() (entry fuse.DirEntry, errno syscall.Errno) {
 
 // Close closes the stream and cleans up any resources.
 func (s *commitDirStream) Close() {
-	logging.LogCall(logging.NilCtx{}, logging.CallCtx{})
+	logging.LogCall(context.Background(), logging.NilCtx{}, logging.CallCtx{})
 	s.next = nil
 	s.headLink = nil
 	s.stop <- 1
@@ -170,26 +183,27 @@ func (s *commitDirStream) Close() {
 // i.e. the HEAD symlink and the directories representing commits.
 // The result is based on the current state of the repository.
 func (n *allCommitsNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
-	logging.LogCall(n, nil)
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
 	iter, err := n.repo.CommitObjects()
 	if err != nil {
-		error_handler.Logging.HandleError(fmt.Errorf("cannot get commit objects: %w", err))
-		return nil, syscall.EIO
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get commit objects: %w", err))
 	}
-	return newCommitDirStream(iter, n.getHeadLinkNode(ctx)), fs.OK
+	return newCommitDirStream(iter, n.getHeadLinkNode(ctx), n.commitDirEntry), fs.OK
 }
 
 // Lookup returns a node representing the commit with the given hash, or the HEAD symlink if `name == "HEAD"`.
 // The result is based on the current state of the repository.
 func (n *allCommitsNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
-	logging.LogCall(n, logging.CallCtx{"name": name})
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
 	var err error
 	if name == "HEAD" {
 		headLink := n.getHeadLinkNode(ctx)
 		out.Attr, err = headAttr(n)
 		if err != nil {
-			error_handler.Logging.HandleError(fmt.Errorf("cannot get HEAD commit attributes: %w", err))
-			return nil, syscall.EIO
+			err = fmt.Errorf("cannot get HEAD commit attributes: %w", err)
+			return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
 		}
 		out.Mode = fuse.S_IFLNK | 0555
 		out.SetAttrTimeout(HeadAttrValid)
@@ -203,8 +217,8 @@ func (n *allCommitsNode) Lookup(ctx context.Context, name string, out *fuse.Entr
 			logging.WarningLog.Printf("Commit %v not found", name)
 			return nil, syscall.ENOENT
 		} else {
-			error_handler.Logging.HandleError(fmt.Errorf("cannot get commit object %v: %w", hash, err))
-			return nil, syscall.EIO
+			err = fmt.Errorf("cannot get commit object %v: %w", hash, err)
+			return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
 		}
 	}
 	node := newCommitNode(ctx, commit, n)
@@ -215,12 +229,12 @@ func (n *allCommitsNode) Lookup(ctx context.Context, name string, out *fuse.Entr
 }
 
 // Getattr returns attributes corresponding to the current HEAD commit.
-func (n *allCommitsNode) Getattr(_ context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
-	logging.LogCall(n, nil)
+func (n *allCommitsNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
 	attr, err := headAttr(n)
 	if err != nil {
-		error_handler.Logging.HandleError(fmt.Errorf("cannot get HEAD commit attributes: %w", err))
-		return syscall.EIO
+		return error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get HEAD commit attributes: %w", err))
 	}
 	out.Attr = attr
 	out.Attr.Mode = 0555
@@ -228,16 +242,16 @@ func (n *allCommitsNode) Getattr(_ context.Context, _ fs.FileHandle, out *fuse.A
 	return fs.OK
 }
 
-func newAllCommitsNode(repo *git.Repository) *allCommitsNode {
+func newAllCommitsNode(fsCtx *fsContext) *allCommitsNode {
 	node := &allCommitsNode{}
-	node.repo = repo
+	node.fsContext = fsCtx
 	return node
 }
 
 func (n *allCommitsNode) getHeadLinkNode(ctx context.Context) *fs.Inode {
 	if n.headLink == nil {
 		headLink := &headLinkNode{}
-		headLink.repo = n.repo
+		headLink.fsContext = n.fsContext
 		hlNode := n.NewInode(ctx, headLink, fs.StableAttr{Mode: fuse.S_IFLNK})
 		n.headLink = hlNode
 	}
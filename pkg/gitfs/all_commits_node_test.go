@@ -8,9 +8,8 @@ import (
 )
 
 func Test_allCommitsNode(t *testing.T) {
-	Init()
 	repo, extras := makeRepo(t)
-	node := newAllCommitsNode(repo)
+	node := newAllCommitsNode(newFsContext(repo))
 	server, mountPath := mountNode(t, node, noOpCb)
 	defer func() {
 		_ = server.Unmount()
@@ -42,6 +41,11 @@ func Test_allCommitsNode(t *testing.T) {
 		assert.Equal(t, commitSignatures["bar"].When, stat.ModTime().UTC(), "incorrect modification time")
 	})
 
+	t.Run("HEAD xattr", func(t *testing.T) {
+		// the attributes are read from the commit directory the symlink points to
+		assertCommitXattrs(t, path.Join(mountPath, "HEAD"), extras, "bar")
+	})
+
 	hash := addCommit(t, extras.worktree, extras.fs, "new")
 	expected = append(expected, hash.String())
 
@@ -0,0 +1,288 @@
+package gitfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"gogitfs/pkg/error_handler"
+	"gogitfs/pkg/gitfs/internal/utils"
+	"gogitfs/pkg/logging"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// archiveFormat specifies the format of an archive of a commit's tree.
+type archiveFormat int
+
+const (
+	archiveTar archiveFormat = iota
+	archiveTarGz
+	archiveZip
+)
+
+// archiveNames maps the archive formats to names of the files containing them.
+var archiveNames = map[archiveFormat]string{
+	archiveTar:   "archive.tar",
+	archiveTarGz: "archive.tar.gz",
+	archiveZip:   "archive.zip",
+}
+
+// archiveFileMode returns the permissions of an archived file, in the same way as `git archive`.
+func archiveFileMode(mode filemode.FileMode) int64 {
+	if mode == filemode.Executable {
+		return 0755
+	}
+	return 0644
+}
+
+// archiveDirMode is the permissions of archived directories, as in `git archive`.
+const archiveDirMode = 0755
+
+// walkArchiveTree calls `f` with the path and entry of each directory, file and symlink in the tree, with each
+// directory preceding its contents. Submodules are skipped.
+func walkArchiveTree(tree *object.Tree, f func(name string, entry object.TreeEntry) error) error {
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("cannot walk tree %v: %w", tree.Hash, err)
+		}
+		if entry.Mode == filemode.Submodule {
+			continue
+		}
+		if err := f(name, entry); err != nil {
+			return err
+		}
+	}
+}
+
+// writeTar writes the tree to w in tar format. Directories are stored with their own entries, symlinks are stored
+// as symlinks and submodules are skipped. The modification time of all entries is set to the commit time.
+// The contents of files are served by `blobs`, so Git LFS pointers are replaced with the objects,
+// as by `git archive`.
+func writeTar(w io.Writer, commit *object.Commit, tree *object.Tree, blobs lfsResolver) error {
+	tw := tar.NewWriter(w)
+	err := walkArchiveTree(tree, func(name string, entry object.TreeEntry) error {
+		header := &tar.Header{
+			Name:    name,
+			Mode:    archiveFileMode(entry.Mode),
+			ModTime: commit.Committer.When,
+			Format:  tar.FormatPAX,
+		}
+		switch entry.Mode {
+		case filemode.Dir:
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+			header.Mode = archiveDirMode
+			return tw.WriteHeader(header)
+		case filemode.Symlink:
+			target, err := readBlob(blobs.repo, entry.Hash)
+			if err != nil {
+				return fmt.Errorf("cannot read symlink %v: %w", name, err)
+			}
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = string(target)
+			header.Mode = 0777
+			return tw.WriteHeader(header)
+		}
+
+		reader, info, err := blobs.open(entry.Hash)
+		if err != nil {
+			return fmt.Errorf("cannot read file %v: %w", name, err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		header.Typeflag = tar.TypeReg
+		header.Size = info.size
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, reader)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// writeZip writes the tree to w in zip format, in the same manner as writeTar.
+func writeZip(w io.Writer, commit *object.Commit, tree *object.Tree, blobs lfsResolver) error {
+	zw := zip.NewWriter(w)
+	err := walkArchiveTree(tree, func(name string, entry object.TreeEntry) error {
+		header := &zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: commit.Committer.When,
+		}
+		switch entry.Mode {
+		case filemode.Dir:
+			header.Name += "/"
+			header.Method = zip.Store
+			header.SetMode(archiveDirMode | os.ModeDir)
+			_, err := zw.CreateHeader(header)
+			return err
+		case filemode.Symlink:
+			header.SetMode(0777 | os.ModeSymlink)
+		default:
+			header.SetMode(os.FileMode(archiveFileMode(entry.Mode)))
+		}
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if entry.Mode == filemode.Symlink {
+			target, err := readBlob(blobs.repo, entry.Hash)
+			if err != nil {
+				return fmt.Errorf("cannot read symlink %v: %w", name, err)
+			}
+			_, err = fw.Write(target)
+			return err
+		}
+		reader, _, err := blobs.open(entry.Hash)
+		if err != nil {
+			return fmt.Errorf("cannot read file %v: %w", name, err)
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		_, err = io.Copy(fw, reader)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// write writes the archive of the commit's tree in the given format to w, reading files with `blobs`.
+func (f archiveFormat) write(w io.Writer, commit *object.Commit, blobs lfsResolver) error {
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("cannot get tree of commit %v: %w", commit.Hash, err)
+	}
+	switch f {
+	case archiveTarGz:
+		gw := gzip.NewWriter(w)
+		err = writeTar(gw, commit, tree, blobs)
+		if err != nil {
+			return err
+		}
+		return gw.Close()
+	case archiveZip:
+		return writeZip(w, commit, tree, blobs)
+	default:
+		return writeTar(w, commit, tree, blobs)
+	}
+}
+
+// archiveFileNode represents an archive of the commit's tree, similar to the output of `git archive`.
+// The archive is streamed while the file is read, so its size is reported as 0 and it can only be read sequentially.
+type archiveFileNode struct {
+	repoNode
+	commit *object.Commit
+	format archiveFormat
+}
+
+func (n *archiveFileNode) GetCallCtx() logging.CallCtx {
+	info := utils.NodeCallCtx(n)
+	info["hash"] = n.commit.Hash.String()
+	info["format"] = int(n.format)
+	return info
+}
+
+// Getattr returns attributes corresponding to those of the commit.
+func (n *archiveFileNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	out.Attr = utils.CommitAttr(n.commit)
+	out.Mode = 0444
+	return fs.OK
+}
+
+// Open starts creating the archive, see streamFileHandle.
+func (n *archiveFileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	logging.LogCall(ctx, n, logging.CallCtx{"flags": flags})
+	defer logging.Benchmark(time.Now())
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	logging.InfoLog.Printf("Creating %v of commit %v", archiveNames[n.format], n.commit.Hash)
+	blobs := n.lfs()
+	handle := newStreamFileHandle(n, func(w io.Writer) error {
+		err := n.format.write(w, n.commit, blobs)
+		if err != nil {
+			return fmt.Errorf("cannot create archive of commit %v: %w", n.commit.Hash, err)
+		}
+		return nil
+	})
+	return handle, fuse.FOPEN_DIRECT_IO | fuse.FOPEN_NONSEEKABLE, fs.OK
+}
+
+var _ fs.NodeOpener = (*archiveFileNode)(nil)
+var _ fs.NodeGetattrer = (*archiveFileNode)(nil)
+
+// streamFileHandle is a file handle serving data generated in a separate goroutine while the file is read,
+// so the data does not have to be kept in memory. The data can only be read sequentially; reads at other offsets
+// fail with ESPIPE. The generation is cancelled when the handle is released.
+type streamFileHandle struct {
+	// node is the node the handle belongs to, used for error reporting
+	node   logging.CallCtxGetter
+	lock   sync.Mutex
+	reader *io.PipeReader
+	// offset is the offset of the next byte which can be read
+	offset int64
+}
+
+// newStreamFileHandle creates a handle serving data written by `write`. Errors returned by `write` are reported
+// by the read following the last written byte.
+func newStreamFileHandle(node logging.CallCtxGetter, write func(w io.Writer) error) *streamFileHandle {
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(write(writer))
+	}()
+	return &streamFileHandle{node: node, reader: reader}
+}
+
+// Read reads the next part of the data. The buffer is filled unless the end of the data is reached.
+func (h *streamFileHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	ctx = logging.LogCall(ctx, h.node, logging.CallCtx{"offset": off, "size": len(dest)})
+	defer logging.Benchmark(time.Now())
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if off != h.offset {
+		return nil, syscall.ESPIPE
+	}
+	n, err := io.ReadFull(h.reader, dest)
+	h.offset += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, h.node, err)
+	}
+	return fuse.ReadResultData(dest[:n]), fs.OK
+}
+
+// Release stops generating the data.
+func (h *streamFileHandle) Release(ctx context.Context) syscall.Errno {
+	logging.LogCall(ctx, h.node, nil)
+	defer logging.Benchmark(time.Now())
+	_ = h.reader.CloseWithError(os.ErrClosed)
+	return fs.OK
+}
+
+var _ fs.FileReader = (*streamFileHandle)(nil)
+var _ fs.FileReleaser = (*streamFileHandle)(nil)
@@ -0,0 +1,193 @@
+package gitfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// readTar returns the contents of files in a tar archive.
+func readTar(t *testing.T, r io.Reader) map[string]string {
+	result := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err, "unexpected error when reading tar archive") {
+			break
+		}
+		assert.EqualValues(t, 0644, header.Mode, "incorrect mode of %v", header.Name)
+		data, err := io.ReadAll(tr)
+		assert.NoError(t, err, "unexpected error when reading %v", header.Name)
+		result[header.Name] = string(data)
+	}
+	return result
+}
+
+// readZip returns the contents of files in a zip archive.
+func readZip(t *testing.T, data []byte) map[string]string {
+	result := make(map[string]string)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if !assert.NoError(t, err, "unexpected error when reading zip archive") {
+		return result
+	}
+	for _, file := range zr.File {
+		r, err := file.Open()
+		if !assert.NoError(t, err, "unexpected error when opening %v", file.Name) {
+			continue
+		}
+		data, err := io.ReadAll(r)
+		assert.NoError(t, err, "unexpected error when reading %v", file.Name)
+		_ = r.Close()
+		result[file.Name] = string(data)
+	}
+	return result
+}
+
+func Test_archiveFileNode(t *testing.T) {
+	repo, extras := makeRepo(t)
+	commit, err := repo.CommitObject(extras.commits["bar"])
+	if err != nil {
+		t.Fatalf("Error during commit retrieval: %v", err)
+	}
+	node := &commitNode{commit: commit}
+	node.fsContext = newFsContext(repo)
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+
+	expected := map[string]string{"foo": "foo", "bar": "bar"}
+	testCases := []struct {
+		name string
+		read func(t *testing.T, data []byte) map[string]string
+	}{
+		{
+			"archive.tar",
+			func(t *testing.T, data []byte) map[string]string {
+				return readTar(t, bytes.NewReader(data))
+			},
+		},
+		{
+			"archive.tar.gz",
+			func(t *testing.T, data []byte) map[string]string {
+				gr, err := gzip.NewReader(bytes.NewReader(data))
+				if !assert.NoError(t, err, "unexpected error when reading gzip stream") {
+					return nil
+				}
+				return readTar(t, gr)
+			},
+		},
+		{
+			"archive.zip",
+			readZip,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := path.Join(mountPath, tc.name)
+			data, err := os.ReadFile(p)
+			assert.NoError(t, err, "unexpected error when reading %v", p)
+			assert.Equal(t, expected, tc.read(t, data), "incorrect archive contents")
+
+			stat, err := os.Stat(p)
+			assert.NoError(t, err, "unexpected error on os.Stat")
+			assert.Equal(t, commitSignatures["bar"].When, stat.ModTime().UTC(), "incorrect modification time")
+		})
+	}
+	t.Run("sequential reads", func(t *testing.T) {
+		file, err := os.Open(path.Join(mountPath, "archive.tar"))
+		if !assert.NoError(t, err, "unexpected error when opening archive") {
+			return
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		buf := make([]byte, 100)
+		_, err = io.ReadFull(file, buf)
+		assert.NoError(t, err, "unexpected error when reading archive")
+		_, err = file.ReadAt(buf, 0)
+		assert.ErrorIs(t, err, syscall.ESPIPE, "archive should not be seekable")
+		data, err := io.ReadAll(file)
+		assert.NoError(t, err, "unexpected error when reading archive")
+		assert.Equal(t, expected, readTar(t, io.MultiReader(bytes.NewReader(buf), bytes.NewReader(data))),
+			"incorrect archive contents")
+	})
+}
+
+func Test_archiveFormat_directories(t *testing.T) {
+	repo, _ := makeRepo(t)
+	nestedHash := storeObject(t, repo.Storer, &object.Tree{Entries: []object.TreeEntry{
+		{Name: "file", Mode: filemode.Regular, Hash: storeBlob(t, repo.Storer, "file")},
+	}})
+	dirHash := storeObject(t, repo.Storer, &object.Tree{Entries: []object.TreeEntry{
+		{Name: "nested", Mode: filemode.Dir, Hash: nestedHash},
+	}})
+	hash := storeCommit(t, repo.Storer, []object.TreeEntry{
+		{Name: "dir", Mode: filemode.Dir, Hash: dirHash},
+		{Name: "link", Mode: filemode.Symlink, Hash: storeBlob(t, repo.Storer, "dir/nested/file")},
+		{Name: "run.sh", Mode: filemode.Executable, Hash: storeBlob(t, repo.Storer, "#!/bin/sh")},
+		{Name: "sub", Mode: filemode.Submodule, Hash: plumbing.NewHash(strings.Repeat("ab", 20))},
+	}, "directories")
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		t.Fatalf("Error during commit retrieval: %v", err)
+	}
+	blobs := lfsResolver{repo: repo, stats: newLFSStatCache()}
+	expected := map[string]os.FileMode{
+		"dir/":            os.ModeDir | 0755,
+		"dir/nested/":     os.ModeDir | 0755,
+		"dir/nested/file": 0644,
+		"link":            os.ModeSymlink | 0777,
+		"run.sh":          0755,
+	}
+
+	t.Run("tar", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, archiveTar.write(&buf, commit, blobs), "unexpected error when creating archive")
+		modes := make(map[string]os.FileMode)
+		var names []string
+		tr := tar.NewReader(&buf)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if !assert.NoError(t, err, "unexpected error when reading tar archive") {
+				return
+			}
+			names = append(names, header.Name)
+			modes[header.Name] = header.FileInfo().Mode()
+			assert.Equal(t, commit.Committer.When.Unix(), header.ModTime.Unix(), "incorrect time of %v", header.Name)
+		}
+		assert.Equal(t, expected, modes, "incorrect archive entries")
+		assert.Equal(t, []string{"dir/", "dir/nested/", "dir/nested/file"}, names[:3], "directories should precede contents")
+	})
+	t.Run("zip", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, archiveZip.write(&buf, commit, blobs), "unexpected error when creating archive")
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if !assert.NoError(t, err, "unexpected error when reading zip archive") {
+			return
+		}
+		modes := make(map[string]os.FileMode)
+		for _, file := range zr.File {
+			modes[file.Name] = file.Mode()
+			assert.Equal(t, commit.Committer.When.Unix(), file.Modified.Unix(), "incorrect time of %v", file.Name)
+		}
+		assert.Equal(t, expected, modes, "incorrect archive entries")
+	})
+}
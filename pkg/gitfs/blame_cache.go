@@ -0,0 +1,144 @@
+package gitfs
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"gogitfs/pkg/logging"
+	"sync"
+)
+
+// blameKey identifies a blame result.
+type blameKey struct {
+	commit plumbing.Hash
+	path   string
+}
+
+// blameEntry is a cached blame result, along with its renderings in the formats requested so far.
+type blameEntry struct {
+	result   *git.BlameResult
+	rendered map[blameFormat][]byte
+}
+
+// blameCache stores the results of git.Blame, so that the (expensive) computation is performed once per file.
+// The rendered output is cached as well, so that the size of a blame file can be reported without rendering it again.
+// At most maxEntries results are kept - when the limit is reached, the least recently used entry is removed.
+type blameCache struct {
+	lock       *sync.Mutex
+	maxEntries int
+	results    map[blameKey]*blameEntry
+	// order contains the keys in order of use, the least recently used first.
+	order []blameKey
+}
+
+// init performs initialization. maxEntries is the maximum number of stored results.
+func (c *blameCache) init(maxEntries int) {
+	c.lock = &sync.Mutex{}
+	c.maxEntries = maxEntries
+	c.results = make(map[blameKey]*blameEntry)
+	c.order = nil
+}
+
+// touch marks the key as the most recently used. The caller must hold the lock.
+func (c *blameCache) touch(key blameKey) {
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(append(c.order[:i:i], c.order[i+1:]...), key)
+			return
+		}
+	}
+}
+
+// get returns the cached blame of the file at `path` in `commit`, or nil if it has not been computed yet.
+func (c *blameCache) get(commit *object.Commit, path string) *git.BlameResult {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := blameKey{commit.Hash, path}
+	entry := c.results[key]
+	if entry == nil {
+		return nil
+	}
+	c.touch(key)
+	return entry.result
+}
+
+// getOrCompute returns the blame of the file at `path` in `commit`, computing it if necessary.
+func (c *blameCache) getOrCompute(commit *object.Commit, path string) (*git.BlameResult, error) {
+	result := c.get(commit, path)
+	if result != nil {
+		return result, nil
+	}
+	// computation is done without holding the lock, as it might take a long time
+	logging.InfoLog.Printf("Computing blame of %v at commit %v", path, commit.Hash)
+	result, err := git.Blame(commit, path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	key := blameKey{commit.Hash, path}
+	if entry, ok := c.results[key]; ok {
+		return entry.result, nil
+	}
+	if len(c.order) >= c.maxEntries {
+		delete(c.results, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.order = append(c.order, key)
+	c.results[key] = &blameEntry{result: result, rendered: make(map[blameFormat][]byte)}
+	return result, nil
+}
+
+// rendered returns the blame of the file at `path` in `commit` rendered in the given format, or nil
+// if the blame has not been computed yet. The rendering is stored along with the result.
+func (c *blameCache) rendered(commit *object.Commit, path string, format blameFormat) []byte {
+	c.lock.Lock()
+	key := blameKey{commit.Hash, path}
+	entry := c.results[key]
+	if entry == nil {
+		c.lock.Unlock()
+		return nil
+	}
+	c.touch(key)
+	data, ok := entry.rendered[format]
+	c.lock.Unlock()
+	if ok {
+		return data
+	}
+	data = format.render(entry.result)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry.rendered[format] = data
+	return data
+}
+
+// renderOrCompute returns the blame of the file at `path` in `commit` rendered in the given format,
+// computing and rendering it if necessary.
+func (c *blameCache) renderOrCompute(commit *object.Commit, path string, format blameFormat) ([]byte, error) {
+	result, err := c.getOrCompute(commit, path)
+	if err != nil {
+		return nil, err
+	}
+	data := c.rendered(commit, path, format)
+	if data == nil {
+		// evicted in the meantime
+		data = format.render(result)
+	}
+	return data, nil
+}
+
+// len returns the number of cached results.
+func (c *blameCache) len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.results)
+}
+
+// clear removes all cached results.
+func (c *blameCache) clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.results = make(map[blameKey]*blameEntry)
+	c.order = nil
+}
@@ -0,0 +1,259 @@
+package gitfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"gogitfs/pkg/error_handler"
+	"gogitfs/pkg/gitfs/internal/utils"
+	"gogitfs/pkg/logging"
+	"path"
+	"syscall"
+	"time"
+)
+
+// blameFormat specifies how the blame of a file is rendered.
+type blameFormat int
+
+const (
+	// blameHuman - the format of `git blame`
+	blameHuman blameFormat = iota
+	// blamePorcelain - a format similar to `git blame --line-porcelain`, meant to be parsed by other programs
+	blamePorcelain
+)
+
+// render converts the blame result to text.
+// In porcelain format, each line is described by a header line containing the commit hash and the line number,
+// followed by author information, the file name and the line itself, prefixed with a tab character.
+func (f blameFormat) render(result *git.BlameResult) []byte {
+	if f == blameHuman {
+		return []byte(result.String())
+	}
+	var buf bytes.Buffer
+	for i, line := range result.Lines {
+		_, _ = fmt.Fprintf(&buf, "%v %d\n", line.Hash, i+1)
+		_, _ = fmt.Fprintf(&buf, "author %v\n", line.AuthorName)
+		_, _ = fmt.Fprintf(&buf, "author-mail <%v>\n", line.Author)
+		_, _ = fmt.Fprintf(&buf, "author-time %d\n", line.Date.Unix())
+		_, _ = fmt.Fprintf(&buf, "author-tz %v\n", line.Date.Format("-0700"))
+		_, _ = fmt.Fprintf(&buf, "filename %v\n", result.Path)
+		_, _ = fmt.Fprintf(&buf, "\t%v\n", line.Text)
+	}
+	return buf.Bytes()
+}
+
+// blameNode represents a directory in the file tree of a commit. Each file in the tree is represented by
+// a blameFileNode containing the blame of the file.
+type blameNode struct {
+	repoNode
+	commit *object.Commit
+	// path is the path of the represented directory, relative to the repository root. Empty for the root directory.
+	path   string
+	format blameFormat
+}
+
+func (n *blameNode) GetCallCtx() logging.CallCtx {
+	info := utils.NodeCallCtx(n)
+	info["hash"] = n.commit.Hash.String()
+	info["path"] = n.path
+	info["format"] = int(n.format)
+	return info
+}
+
+// tree returns the tree corresponding to the node's path.
+func (n *blameNode) tree() (*object.Tree, error) {
+	tree, err := n.commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get tree of commit %v: %w", n.commit.Hash, err)
+	}
+	if n.path != "" {
+		tree, err = tree.Tree(n.path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get tree %v: %w", n.path, err)
+		}
+	}
+	return tree, nil
+}
+
+// Readdir returns the entries of the represented tree. Submodules are skipped, as they cannot be blamed.
+func (n *blameNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	tree, err := n.tree()
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	var entries []fuse.DirEntry
+	for _, e := range tree.Entries {
+		switch e.Mode {
+		case filemode.Dir:
+			entries = append(entries, fuse.DirEntry{Name: e.Name, Mode: fuse.S_IFDIR})
+		case filemode.Submodule:
+			continue
+		default:
+			entries = append(entries, fuse.DirEntry{Name: e.Name, Mode: fuse.S_IFREG})
+		}
+	}
+	return fs.NewListDirStream(entries), fs.OK
+}
+
+// Lookup returns a blameNode for subdirectories and a blameFileNode for files.
+func (n *blameNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	tree, err := n.tree()
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	entry, err := tree.FindEntry(name)
+	if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return nil, syscall.ENOENT
+	} else if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get tree entry %v: %w", name, err))
+	}
+
+	p := path.Join(n.path, name)
+	out.Attr = utils.CommitAttr(n.commit)
+	switch entry.Mode {
+	case filemode.Dir:
+		node := newBlameNode(n.fsContext, n.commit, p, n.format)
+		out.Mode = fuse.S_IFDIR | 0555
+		return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFDIR}), fs.OK
+	case filemode.Submodule:
+		return nil, syscall.ENOENT
+	default:
+		node := &blameFileNode{commit: n.commit, path: p, format: n.format, blob: entry.Hash, mode: entry.Mode}
+		node.fsContext = n.fsContext
+		node.fillAttr(&out.Attr)
+		return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFREG}), fs.OK
+	}
+}
+
+// Getattr returns attributes corresponding to those of the commit.
+func (n *blameNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	out.Attr = utils.CommitAttr(n.commit)
+	out.Mode = 0555
+	return fs.OK
+}
+
+// newBlameNode creates a blameNode representing the directory `p` in the given commit.
+func newBlameNode(fsCtx *fsContext, commit *object.Commit, p string, format blameFormat) *blameNode {
+	node := &blameNode{commit: commit, path: p, format: format}
+	node.fsContext = fsCtx
+	return node
+}
+
+var _ fs.NodeLookuper = (*blameNode)(nil)
+var _ fs.NodeReaddirer = (*blameNode)(nil)
+var _ fs.NodeGetattrer = (*blameNode)(nil)
+
+// blameFileNode represents the blame of a single file. The blame is computed when the file is opened for the first
+// time and stored in blameCache. Until then, the reported size of the file is 0, so it is read using direct I/O.
+type blameFileNode struct {
+	repoNode
+	commit *object.Commit
+	path   string
+	format blameFormat
+	// blob is the hash of the blamed file's blob
+	blob plumbing.Hash
+	// mode is the mode of the blamed file in the tree
+	mode filemode.FileMode
+}
+
+func (n *blameFileNode) GetCallCtx() logging.CallCtx {
+	info := utils.NodeCallCtx(n)
+	info["hash"] = n.commit.Hash.String()
+	info["path"] = n.path
+	info["format"] = int(n.format)
+	return info
+}
+
+// fillAttr sets the attributes of the file. The size is only known if the blame has already been computed.
+// It is taken from the rendering stored in blameCache, so the blame is rendered at most once per format.
+// Until the file is first opened, the size is reported as 0, so the size returned by stat changes afterward,
+// and becomes 0 again if the result is evicted from blameCache.
+func (n *blameFileNode) fillAttr(attr *fuse.Attr) {
+	*attr = utils.CommitAttr(n.commit)
+	attr.Mode = fuse.S_IFREG | 0444
+	attr.Size = uint64(len(n.blameResults.rendered(n.commit, n.path, n.format)))
+}
+
+// Getattr returns attributes corresponding to those of the commit.
+func (n *blameFileNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	n.fillAttr(&out.Attr)
+	return fs.OK
+}
+
+// Open computes the blame of the file, if necessary, and renders it.
+func (n *blameFileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"flags": flags})
+	defer logging.Benchmark(time.Now())
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	data, err := n.blameResults.renderOrCompute(n.commit, n.path, n.format)
+	if err != nil {
+		err = fmt.Errorf("cannot compute blame of %v: %w", n.path, err)
+		return nil, 0, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	return &bytesFileHandle{data: data}, fuse.FOPEN_DIRECT_IO, fs.OK
+}
+
+// xattrs returns extended attributes describing the commit (see utils.CommitXattrs) and the blamed file:
+// user.git.path, user.git.blob and user.git.mode.
+func (n *blameFileNode) xattrs() utils.Xattrs {
+	xattrs := utils.CommitXattrs(n.commit)
+	xattrs["user.git.path"] = n.path
+	xattrs["user.git.blob"] = n.blob.String()
+	xattrs["user.git.mode"] = n.mode.String()
+	return xattrs
+}
+
+// Getxattr returns extended attributes describing the blamed file.
+func (n *blameFileNode) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	logging.LogCall(ctx, n, logging.CallCtx{"attr": attr})
+	defer logging.Benchmark(time.Now())
+	return n.xattrs().GetXattr(attr, dest)
+}
+
+// Listxattr lists extended attributes describing the blamed file.
+func (n *blameFileNode) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	return n.xattrs().ListXattr(dest)
+}
+
+var _ fs.NodeOpener = (*blameFileNode)(nil)
+var _ fs.NodeGetattrer = (*blameFileNode)(nil)
+var _ fs.NodeGetxattrer = (*blameFileNode)(nil)
+var _ fs.NodeListxattrer = (*blameFileNode)(nil)
+
+// bytesFileHandle is a file handle serving reads from an in-memory buffer.
+type bytesFileHandle struct {
+	data []byte
+}
+
+// Read returns the requested part of the buffer.
+func (h *bytesFileHandle) Read(_ context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	end := off + int64(len(dest))
+	if end > int64(len(h.data)) {
+		end = int64(len(h.data))
+	}
+	if off > end {
+		off = end
+	}
+	return fuse.ReadResultData(h.data[off:end]), fs.OK
+}
+
+var _ fs.FileReader = (*bytesFileHandle)(nil)
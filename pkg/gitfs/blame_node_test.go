@@ -0,0 +1,131 @@
+package gitfs
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path"
+	"testing"
+)
+
+func Test_blameNode(t *testing.T) {
+	repo, extras := makeRepo(t)
+	commit, err := repo.CommitObject(extras.commits["bar"])
+	if err != nil {
+		t.Fatalf("Error during commit retrieval: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		format   blameFormat
+		expected func(c string) string
+	}{
+		{
+			"human",
+			blameHuman,
+			func(c string) string {
+				sig := commitSignatures[c]
+				return fmt.Sprintf(
+					"%v (%v %v 1) %v\n",
+					extras.commits[c].String()[:8],
+					sig.Name,
+					sig.When.Format("2006-01-02 15:04:05 -0700"),
+					c,
+				)
+			},
+		},
+		{
+			"porcelain",
+			blamePorcelain,
+			func(c string) string {
+				sig := commitSignatures[c]
+				return fmt.Sprintf(
+					"%v 1\nauthor %v\nauthor-mail <%v>\nauthor-time %d\nauthor-tz +0000\nfilename %v\n\t%v\n",
+					extras.commits[c],
+					sig.Name,
+					sig.Email,
+					sig.When.Unix(),
+					c,
+					c,
+				)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node := newBlameNode(newFsContext(repo), commit, "", tc.format)
+			server, mountPath := mountNode(t, node, noOpCb)
+			defer func() {
+				_ = server.Unmount()
+			}()
+
+			t.Run("ls", func(t *testing.T) {
+				assertDirEntries(t, mountPath, []string{"foo", "bar"}, "incorrect directory entries")
+			})
+			for _, c := range []string{"foo", "bar"} {
+				t.Run(c, func(t *testing.T) {
+					p := path.Join(mountPath, c)
+					assert.Equal(t, tc.expected(c), catFile(t, p), "incorrect blame")
+					stat, err := os.Stat(p)
+					assert.NoError(t, err, "unexpected error on os.Stat")
+					assert.EqualValues(t, len(tc.expected(c)), stat.Size(), "incorrect size of computed blame")
+					assert.Equal(t, commitSignatures["bar"].When, stat.ModTime().UTC(), "incorrect modification time")
+
+					file, err := commit.File(c)
+					if err != nil {
+						t.Fatalf("Error during file retrieval: %v", err)
+					}
+					assert.Equal(t, file.Hash.String(), getXattr(t, p, "user.git.blob"), "incorrect blob hash")
+					assert.Equal(t, "0100644", getXattr(t, p, "user.git.mode"), "incorrect file mode")
+					assert.Equal(t, c, getXattr(t, p, "user.git.path"), "incorrect path")
+				})
+			}
+			t.Run("lookup nonexistent", func(t *testing.T) {
+				_, err := os.Stat(path.Join(mountPath, "baz"))
+				assert.True(t, os.IsNotExist(err), "error should be an ErrNotExist")
+			})
+		})
+	}
+}
+
+func Test_blameCache(t *testing.T) {
+	repo, extras := makeRepo(t)
+	cache := &blameCache{}
+	cache.init(1)
+	commit, err := repo.CommitObject(extras.commits["bar"])
+	if err != nil {
+		t.Fatalf("Error during commit retrieval: %v", err)
+	}
+
+	assert.Nil(t, cache.get(commit, "foo"), "result should be absent before computation")
+	result, err := cache.getOrCompute(commit, "foo")
+	assert.NoError(t, err, "unexpected error during blame computation")
+	assert.Same(t, result, cache.get(commit, "foo"), "result should be cached")
+	rendered := cache.rendered(commit, "foo", blamePorcelain)
+	assert.Equal(t, blamePorcelain.render(result), rendered, "incorrect rendering")
+	assert.Same(t, &rendered[0], &cache.rendered(commit, "foo", blamePorcelain)[0], "rendering should be cached")
+
+	_, err = cache.getOrCompute(commit, "bar")
+	assert.NoError(t, err, "unexpected error during blame computation")
+	assert.Nil(t, cache.get(commit, "foo"), "oldest result should be evicted")
+	assert.NotNil(t, cache.get(commit, "bar"), "newest result should be cached")
+	assert.Nil(t, cache.rendered(commit, "foo", blameHuman), "evicted result should not be rendered")
+
+	_, err = cache.getOrCompute(commit, "nonexistent")
+	assert.Error(t, err, "expected an error for a nonexistent file")
+
+	other, err := repo.CommitObject(extras.commits["baz"])
+	if err != nil {
+		t.Fatalf("Error during commit retrieval: %v", err)
+	}
+	cache.init(2)
+	for _, p := range []string{"foo", "bar"} {
+		_, err = cache.getOrCompute(commit, p)
+		assert.NoError(t, err, "unexpected error during blame computation")
+	}
+	assert.NotNil(t, cache.get(commit, "foo"), "result should be cached")
+	_, err = cache.getOrCompute(other, "baz")
+	assert.NoError(t, err, "unexpected error during blame computation")
+	assert.NotNil(t, cache.get(commit, "foo"), "recently used result should be kept")
+	assert.Nil(t, cache.get(commit, "bar"), "least recently used result should be evicted")
+}
@@ -4,13 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
 	"gogitfs/pkg/error_handler"
 	"gogitfs/pkg/gitfs/internal/utils"
+	"gogitfs/pkg/inode_manager"
 	"gogitfs/pkg/logging"
 	"syscall"
 	"time"
@@ -21,6 +21,8 @@ const BranchValid = 30 * time.Second
 
 // branchListNode represents the list of all branches. Each branch is represented as a directory named after the branch.
 // Readdir and Lookup always consider the current state of the repository.
+// If references are writable (see RootNode.SetWritableRefs), a branch can be created by creating a symlink
+// to a commit, e.g. `ln -s ../commits/<hash> branches/<name>`, and deleted by removing its directory.
 type branchListNode struct {
 	repoNode
 }
@@ -37,9 +39,15 @@ type branchDirStream struct {
 	stop chan<- int
 }
 
-// readBranchIter reads the branch references from `iter`, generates corresponding entries
-// and places them in the channel `next`. If a value is read from `stop`, the function returns immediately.
-func readBranchIter(iter storer.ReferenceIter, next chan<- *fuse.DirEntry, stop <-chan int) {
+// readBranchIter reads the branch references from `iter`, generates corresponding entries with inode numbers
+// taken from `attrs` and places them in the channel `next`. If a value is read from `stop`,
+// the function returns immediately.
+func readBranchIter(
+	iter storer.ReferenceIter,
+	attrs *inode_manager.AttrStore,
+	next chan<- *fuse.DirEntry,
+	stop <-chan int,
+) {
 	funcName := logging.CurrentFuncName(0, logging.Package)
 	err := iter.ForEach(func(reference *plumbing.Reference) error {
 		logging.DebugLog.Printf(
@@ -50,7 +58,7 @@ func readBranchIter(iter storer.ReferenceIter, next chan<- *fuse.DirEntry, stop
 
 		var entry fuse.DirEntry
 		entry.Name = reference.Name().Short()
-		entry.Ino = branchCache.AttrStore.GetOrInsert(reference.Name().Short(), false).Ino
+		entry.Ino = attrs.GetOrInsert(reference.Name().Short(), false).Ino
 		entry.Mode = fuse.S_IFDIR
 		select {
 		case <-stop:
@@ -66,10 +74,11 @@ func readBranchIter(iter storer.ReferenceIter, next chan<- *fuse.DirEntry, stop
 }
 
 // newBranchDirStream creates a new branchDirStream from the branch reference iterator.
-func newBranchDirStream(iter storer.ReferenceIter) *branchDirStream {
+// The inode numbers of the entries are taken from `attrs`.
+func newBranchDirStream(iter storer.ReferenceIter, attrs *inode_manager.AttrStore) *branchDirStream {
 	rest := make(chan *fuse.DirEntry, 5)
 	stop := make(chan int, 1)
-	go readBranchIter(iter, rest, stop)
+	go readBranchIter(iter, attrs, rest, stop)
 	stream := &branchDirStream{rest: rest, stop: stop}
 	return stream
 }
@@ -101,20 +110,21 @@ func (s *branchDirStream) Close() {
 
 // Readdir returns the contents of the directory representing all branches.
 // The result is based on the current state of the repository.
-func (n *branchListNode) Readdir(_ context.Context) (fs.DirStream, syscall.Errno) {
-	logging.LogCall(n, nil)
+func (n *branchListNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
 	iter, err := n.repo.Branches()
 	if err != nil {
-		error_handler.Logging.HandleError(err)
-		return nil, syscall.EIO
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
 	}
-	return newBranchDirStream(iter), fs.OK
+	return newBranchDirStream(iter, n.branchCache.AttrStore), fs.OK
 }
 
 // Lookup returns a node representing the branch with the given name.
 // The result is based on the current state of the repository.
 func (n *branchListNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
-	logging.LogCall(n, logging.CallCtx{"name": name})
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
 	refName := plumbing.NewBranchReferenceName(name)
 	branch, err := n.repo.Reference(refName, false)
 	if err != nil {
@@ -122,41 +132,100 @@ func (n *branchListNode) Lookup(ctx context.Context, name string, out *fuse.Entr
 			logging.WarningLog.Printf("Branch %v not found", name)
 			return nil, syscall.ENOENT
 		} else {
-			error_handler.Logging.HandleError(fmt.Errorf("cannot get branch reference %v: %w", refName, err))
-			return nil, syscall.EIO
+			err = fmt.Errorf("cannot get branch reference %v: %w", refName, err)
+			return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
 		}
 	}
-	commit, node, err := branchCache.getOrInsert(ctx, branch, n)
+	commit, node, err := n.branchCache.getOrInsert(ctx, branch, n)
 	if err != nil {
-		error_handler.Logging.HandleError(fmt.Errorf("cannot get branch %v: %w", branch, err))
-		return nil, syscall.EIO
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get branch %v: %w", branch, err))
 	}
 	out.SetAttrTimeout(BranchValid)
 	out.SetEntryTimeout(BranchValid)
 	out.Attr = utils.CommitAttr(commit)
 	out.Mode = fuse.S_IFDIR | 0555
+	if n.writableRefs {
+		out.Mode = fuse.S_IFDIR | 0755
+	}
 	return node, fs.OK
 }
 
 // Getattr returns attributes corresponding to the current HEAD commit.
-func (n *branchListNode) Getattr(_ context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
-	logging.LogCall(n, nil)
+func (n *branchListNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
 	attr, err := headAttr(n)
 	if err != nil {
-		error_handler.Logging.HandleError(fmt.Errorf("cannot get HEAD commit attributes: %w", err))
-		return syscall.EIO
+		return error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get HEAD commit attributes: %w", err))
 	}
 	out.Attr = attr
 	out.Attr.Mode = 0555
+	if n.writableRefs {
+		out.Attr.Mode = 0755
+	}
 	return fs.OK
 }
 
-func newBranchListNode(repo *git.Repository) *branchListNode {
+// Symlink creates the branch `name` pointing to the commit which `target` points to, see parseRefTarget.
+// The returned symlink is not cached, so that afterward the branch is looked up as a directory.
+func (n *branchListNode) Symlink(
+	ctx context.Context,
+	target, name string,
+	out *fuse.EntryOut,
+) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"target": target, "name": name})
+	defer logging.Benchmark(time.Now())
+	commit, err := n.createRef(plumbing.NewBranchReferenceName(name), target)
+	if err != nil {
+		return nil, handleRefError(ctx, n, err)
+	}
+	basePath := "../commits"
+	link := commitSymlink(commit, &basePath)
+	out.Attr = link.Attr
+	out.Mode = fuse.S_IFLNK | 0555
+	out.SetAttrTimeout(0)
+	out.SetEntryTimeout(0)
+	return n.NewInode(ctx, link, fs.StableAttr{Mode: fuse.S_IFLNK}), fs.OK
+}
+
+// Rmdir deletes the branch `name`, unless it is checked out. Since branches are directories, this is the only way
+// to delete them: the kernel rejects unlink (and thus plain `rm`) with EISDIR before it reaches the filesystem.
+func (n *branchListNode) Rmdir(ctx context.Context, name string) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	err := n.deleteRef(plumbing.NewBranchReferenceName(name))
+	if err != nil {
+		return handleRefError(ctx, n, err)
+	}
+	return fs.OK
+}
+
+// Mkdir always fails with ENOTSUP, since a new branch needs a commit to point to. Branches are created with Symlink
+// instead.
+func (n *branchListNode) Mkdir(
+	ctx context.Context,
+	name string,
+	_ uint32,
+	_ *fuse.EntryOut,
+) (*fs.Inode, syscall.Errno) {
+	logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	if !n.writableRefs {
+		return nil, syscall.EROFS
+	}
+	logging.WarningLog.Printf("Cannot create branch %v without a commit, use `ln -s ../commits/<hash> %v`", name, name)
+	return nil, syscall.ENOTSUP
+}
+
+func newBranchListNode(fsCtx *fsContext) *branchListNode {
 	node := &branchListNode{}
-	node.repo = repo
+	node.fsContext = fsCtx
 	return node
 }
 
 var _ fs.NodeLookuper = (*branchListNode)(nil)
 var _ fs.NodeReaddirer = (*branchListNode)(nil)
 var _ fs.NodeGetattrer = (*branchListNode)(nil)
+var _ fs.NodeSymlinker = (*branchListNode)(nil)
+var _ fs.NodeRmdirer = (*branchListNode)(nil)
+var _ fs.NodeMkdirer = (*branchListNode)(nil)
@@ -6,13 +6,15 @@ import (
 	"github.com/stretchr/testify/assert"
 	"os"
 	"path"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func Test_branchListNode(t *testing.T) {
-	Init()
 	repo, extras := makeRepo(t)
-	node := newBranchListNode(repo)
+	node := newBranchListNode(newFsContext(repo))
 	server, mountPath := mountNode(t, node, noOpCb)
 	defer func() {
 		_ = server.Unmount()
@@ -50,3 +52,148 @@ func Test_branchListNode(t *testing.T) {
 		assert.True(t, os.IsNotExist(err), "error should be an ErrNotExist")
 	})
 }
+
+func Test_branchListNode_writable(t *testing.T) {
+	repo, repoPath, commits := makeDiskRepo(t)
+	addWorktree(t, repoPath, "wt", "ref: refs/heads/feature")
+	fsCtx := newFsContext(repo)
+	fsCtx.writableRefs = true
+	node := newBranchListNode(fsCtx)
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+	target := "../commits/" + commits["foo"].String()
+
+	t.Run("symlink", func(t *testing.T) {
+		assert.NoError(t, os.Symlink(target, path.Join(mountPath, "new")), "unexpected error when creating branch")
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName("new"), false)
+		assert.NoError(t, err, "branch should be created")
+		if err == nil {
+			assert.Equal(t, commits["foo"], ref.Hash(), "branch should point to the commit")
+		}
+		stat, err := os.Lstat(path.Join(mountPath, "new"))
+		assert.NoError(t, err, "unexpected error on running os.Lstat on the new branch")
+		if err == nil {
+			assert.True(t, stat.IsDir(), "new branch should be a directory")
+		}
+	})
+	t.Run("symlink invalid", func(t *testing.T) {
+		testCases := []struct {
+			name   string
+			target string
+			errno  syscall.Errno
+		}{
+			{"missing", "../commits/" + strings.Repeat("0", 40), syscall.ENOENT},
+			{"not-a-commit", "../foo/" + commits["foo"].String(), syscall.EINVAL},
+			{"bad..name", target, syscall.EINVAL},
+			{"feature", target, syscall.EEXIST},
+		}
+		for _, tc := range testCases {
+			err := os.Symlink(tc.target, path.Join(mountPath, tc.name))
+			assert.ErrorIs(t, err, tc.errno, "incorrect error when creating branch %v", tc.name)
+		}
+	})
+	t.Run("mkdir", func(t *testing.T) {
+		err := os.Mkdir(path.Join(mountPath, "dir"), 0755)
+		assert.ErrorIs(t, err, syscall.ENOTSUP, "branches cannot be created with mkdir")
+	})
+	t.Run("unlink", func(t *testing.T) {
+		err := syscall.Unlink(path.Join(mountPath, "new"))
+		assert.ErrorIs(t, err, syscall.EISDIR, "branches should only be deleted with rmdir")
+		_, err = repo.Reference(plumbing.NewBranchReferenceName("new"), false)
+		assert.NoError(t, err, "branch should not be deleted")
+	})
+	t.Run("rmdir", func(t *testing.T) {
+		assert.NoError(t, syscall.Rmdir(path.Join(mountPath, "new")), "unexpected error when deleting branch")
+		_, err := repo.Reference(plumbing.NewBranchReferenceName("new"), false)
+		assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound, "branch should be deleted")
+		assertDirEntries(t, mountPath, []string{"feature", "main"}, "incorrect directory entries")
+	})
+	t.Run("rmdir checked out", func(t *testing.T) {
+		for _, name := range []string{"main", "feature"} {
+			err := syscall.Rmdir(path.Join(mountPath, name))
+			assert.ErrorIs(t, err, syscall.EBUSY, "checked out branch %v should not be deleted", name)
+		}
+		assertDirEntries(t, mountPath, []string{"feature", "main"}, "incorrect directory entries")
+	})
+}
+
+func Test_branchListNode_readOnly(t *testing.T) {
+	repo, extras := makeRepo(t)
+	node := newBranchListNode(newFsContext(repo))
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+
+	err := os.Symlink("../commits/"+extras.commits["foo"].String(), path.Join(mountPath, "new"))
+	assert.ErrorIs(t, err, syscall.EROFS, "branches should not be created by default")
+	err = syscall.Rmdir(path.Join(mountPath, "branch"))
+	assert.ErrorIs(t, err, syscall.EROFS, "branches should not be deleted by default")
+	assertDirEntries(t, mountPath, []string{"branch", "main"}, "incorrect directory entries")
+}
+
+func Test_branchListNode_moveHead(t *testing.T) {
+	repo, _, commits := makeDiskRepo(t)
+	fsCtx := newFsContext(repo)
+	fsCtx.writableRefs = true
+	node := newBranchListNode(fsCtx)
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+	// moveHead replaces the HEAD symlink of the branch, in the same way as `ln -sfn`
+	moveHead := func(branch, target string) error {
+		tmpPath := path.Join(mountPath, branch, "tmp")
+		err := os.Symlink(target, tmpPath)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(tmpPath, path.Join(mountPath, branch, "HEAD"))
+		if err != nil {
+			_ = os.Remove(tmpPath)
+		}
+		return err
+	}
+	assertBranch := func(branch string, hash plumbing.Hash) {
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName(branch), false)
+		assert.NoError(t, err, "unexpected error when getting branch %v", branch)
+		if err == nil {
+			assert.Equal(t, hash, ref.Hash(), "incorrect commit of branch %v", branch)
+		}
+	}
+
+	t.Run("fast-forward", func(t *testing.T) {
+		err := moveHead("feature", "../../commits/"+commits["bar"].String())
+		assert.NoError(t, err, "unexpected error when moving branch")
+		assertBranch("feature", commits["bar"])
+		assert.Eventually(t, func() bool {
+			target, err := os.Readlink(path.Join(mountPath, "feature", "HEAD"))
+			return err == nil && target == commits["bar"].String()
+		}, time.Second, 10*time.Millisecond, "new HEAD should be visible")
+	})
+	t.Run("not fast-forward", func(t *testing.T) {
+		err := moveHead("feature", commits["foo"].String())
+		assert.ErrorIs(t, err, syscall.EPERM, "only fast-forwards should be allowed")
+		assertBranch("feature", commits["bar"])
+		expected := []string{"HEAD", commits["foo"].String(), commits["bar"].String()}
+		assertDirEntries(t, path.Join(mountPath, "feature"), expected, "temporary symlink should be removed")
+	})
+	t.Run("force", func(t *testing.T) {
+		err := moveHead("feature", "+"+commits["foo"].String())
+		assert.NoError(t, err, "unexpected error when moving branch")
+		assertBranch("feature", commits["foo"])
+	})
+	t.Run("checked out", func(t *testing.T) {
+		err := moveHead("main", "+"+commits["foo"].String())
+		assert.ErrorIs(t, err, syscall.EBUSY, "checked out branch should not be moved")
+		assertBranch("main", commits["bar"])
+	})
+	t.Run("invalid", func(t *testing.T) {
+		err := os.Symlink("../../foo", path.Join(mountPath, "feature", "tmp"))
+		assert.ErrorIs(t, err, syscall.EINVAL, "invalid target should be rejected")
+		err = os.Rename(path.Join(mountPath, "feature", "HEAD"), path.Join(mountPath, "feature", "HEAD2"))
+		assert.ErrorIs(t, err, syscall.EPERM, "only new symlinks should be renamed to HEAD")
+	})
+}
@@ -27,6 +27,13 @@ func (m *branchNodeCache) init(initialIno uint64) {
 	m.lastCommitHash = make(map[string]plumbing.Hash)
 }
 
+// initHashed performs initialization, so that inode numbers are derived from branch names.
+// The parameters are passed to InodeCache.InitHashed.
+func (m *branchNodeCache) initHashed(baseIno uint64, hashBits uint) {
+	m.init(baseIno)
+	m.InodeCache.AttrStore.InitHashed(baseIno, hashBits)
+}
+
 // getOrInsert returns the Inode corresponding to the given key. If the key is absent or the branch head was changed,
 // a new node will be created as in InodeCache. As long as the last commit of the branch remains unchanged,
 // subsequent calls will not create a new node.
@@ -62,10 +69,11 @@ func (m *branchNodeCache) getOrInsert(
 			branchName,
 		)
 		nodeOpts := commitLogNodeOpts{linkLevels: 0, includeHead: true, symlinkHead: true}
-		logNode, err := newCommitLogNode(parent.embeddedRepoNode().repo, lastCommit, nodeOpts)
+		logNode, err := newCommitLogNode(parent.embeddedRepoNode().fsContext, lastCommit, nodeOpts)
 		if err != nil {
 			return nil, err
 		}
+		logNode.branch = branch.Name()
 		m.lastCommitHash[branchName] = lastCommit.Hash
 		return logNode, nil
 	}
@@ -11,10 +11,9 @@ import (
 )
 
 func Test_branchNodeCache_getOrInsert(t *testing.T) {
-	Init()
 	repo, extras := makeRepo(t)
 	node := &repoNode{}
-	node.repo = repo
+	node.fsContext = newFsContext(repo)
 	server, _ := mountNode(t, node, func(t *testing.T, ctx context.Context, inode *fs.Inode) {
 		cache := &branchNodeCache{}
 		cache.init(16)
@@ -3,21 +3,35 @@ package gitfs
 import (
 	"context"
 	"fmt"
-	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
+	"gogitfs/pkg/error_handler"
 	"gogitfs/pkg/gitfs/internal/utils"
+	"gogitfs/pkg/inode_manager"
 	"gogitfs/pkg/logging"
 	"path"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
 // commitLogNode represents a commit log, or any other subset of repo commits.
 // Each commit is represented as a symlink or a hardlink, whose name and attributes correspond to those of
 // the actual directory representing the commit (in particular, the symlink's name is the hash of the commit).
+// The links are created on lookup, so that the kernel can forget them.
+// If the node represents a branch and references are writable (see RootNode.SetWritableRefs), the branch can be
+// moved by replacing the HEAD symlink, e.g. with `ln -sfn ../../commits/<hash> HEAD`. The new symlink is created
+// under a temporary name and renamed to HEAD, which moves the branch, see fsContext.moveRef.
 type commitLogNode struct {
 	repoNode
+	inode_manager.ForgetHook
+	// lock guards hashes, members and pending
+	lock *sync.Mutex
+	// loadLock serializes reading iter, so that other operations are not blocked by lock meanwhile
+	loadLock *sync.Mutex
 	// from is the start commit of the log
 	from *object.Commit
 	// iter is the iterator over commits, which may or may not contain from.
@@ -32,6 +46,14 @@ type commitLogNode struct {
 	includeHead bool
 	// If true, a symlink to the head commit called "HEAD" will be created - requires includeHead.
 	symlinkHead bool
+	// hashes contains the hashes of the commits read from iter, in order
+	hashes []plumbing.Hash
+	// members is the set of commits read from iter. It is nil until iter has been read.
+	members map[plumbing.Hash]bool
+	// branch is the branch represented by the node, or an empty name if the node does not represent a branch.
+	branch plumbing.ReferenceName
+	// pending maps the names of symlinks created in the node to their targets, until they are renamed to HEAD.
+	pending map[string]string
 }
 
 func (n *commitLogNode) GetCallCtx() logging.CallCtx {
@@ -48,13 +70,33 @@ func (n *commitLogNode) GetCallCtx() logging.CallCtx {
 }
 
 // Getattr returns attributes corresponding to the head commit of the log.
-func (n *commitLogNode) Getattr(_ context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
-	logging.LogCall(n, nil)
+func (n *commitLogNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
 	out.Attr = n.attr
+	if n.isMovable() {
+		out.Attr.Mode = 0755
+	}
 	return fs.OK
 }
 
-// commitSymlink creates a symlink node for a given commit object
+// Getxattr returns extended attributes describing the head commit of the log, see utils.CommitXattrs.
+func (n *commitLogNode) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	logging.LogCall(ctx, n, logging.CallCtx{"attr": attr})
+	defer logging.Benchmark(time.Now())
+	return utils.CommitXattrs(n.from).GetXattr(attr, dest)
+}
+
+// Listxattr lists extended attributes describing the head commit of the log.
+func (n *commitLogNode) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	return utils.CommitXattrs(n.from).ListXattr(dest)
+}
+
+// commitSymlink creates a symlink node for a given commit object.
+// Note that the kernel does not allow user extended attributes on symlinks, so the commit's metadata is only available
+// by following the symlink.
 func commitSymlink(commit *object.Commit, basePath *string) *fs.MemSymlink {
 	attr := utils.CommitAttr(commit)
 	attr.Mode = 0555
@@ -66,48 +108,211 @@ func commitSymlink(commit *object.Commit, basePath *string) *fs.MemSymlink {
 	return link
 }
 
-// OnAdd populates the inode with links corresponding to commits and the optional HEAD symlink.
-func (n *commitLogNode) OnAdd(ctx context.Context) {
-	logging.LogCall(n, nil)
-	if n.basePath == nil {
-		n.addHardlinks(ctx)
-	} else {
-		n.addSymlinks(ctx, *n.basePath)
+// load reads the hashes of the commits in the log. The iterator is only read once - afterward, the stored hashes
+// are returned. n.lock is only held while checking and storing the result, not during the walk.
+func (n *commitLogNode) load() ([]plumbing.Hash, error) {
+	if hashes, ok := n.loaded(); ok {
+		return hashes, nil
 	}
-	if n.symlinkHead {
-		link := commitSymlink(n.from, nil)
-		node := n.NewPersistentInode(ctx, link, fs.StableAttr{Mode: fuse.S_IFLNK})
-		n.AddChild("HEAD", node, false)
+	n.loadLock.Lock()
+	defer n.loadLock.Unlock()
+	if hashes, ok := n.loaded(); ok {
+		return hashes, nil
 	}
-}
-
-func (n *commitLogNode) addHardlinks(ctx context.Context) {
-	_ = n.iter.ForEach(func(commit *object.Commit) error {
+	members := make(map[plumbing.Hash]bool)
+	var hashes []plumbing.Hash
+	err := n.iter.ForEach(func(commit *object.Commit) error {
 		if !n.includeHead && commit.Hash == n.from.Hash {
 			return nil
 		}
-		node := newCommitNode(ctx, commit, n)
-		succ := n.AddChild(commit.Hash.String(), node, false)
-		if !succ {
+		if members[commit.Hash] {
 			logging.WarningLog.Printf("Duplicate commit node: %v\n", commit.Hash.String())
+			return nil
 		}
+		members[commit.Hash] = true
+		hashes = append(hashes, commit.Hash)
 		return nil
 	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read commit log: %w", err)
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.hashes = hashes
+	n.members = members
+	return hashes, nil
 }
 
-func (n *commitLogNode) addSymlinks(ctx context.Context, basePath string) {
-	_ = n.iter.ForEach(func(commit *object.Commit) error {
-		if !n.includeHead && commit.Hash == n.from.Hash {
-			return nil
-		}
-		link := commitSymlink(commit, &basePath)
-		node := n.NewPersistentInode(ctx, link, fs.StableAttr{Mode: fuse.S_IFLNK})
-		succ := n.AddChild(commit.Hash.String(), node, false)
-		if !succ {
-			logging.WarningLog.Printf("Duplicate commit node: %v\n", commit.Hash.String())
+// loaded returns the stored hashes, if the iterator has already been read.
+func (n *commitLogNode) loaded() ([]plumbing.Hash, bool) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.hashes, n.members != nil
+}
+
+// contains checks whether the commit with the given hash belongs to the log.
+func (n *commitLogNode) contains(hash plumbing.Hash) (bool, error) {
+	_, err := n.load()
+	if err != nil {
+		return false, err
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.members[hash], nil
+}
+
+// Readdir returns the links corresponding to commits and the optional HEAD symlink.
+func (n *commitLogNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	hashes, err := n.load()
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	entries := make([]fuse.DirEntry, 0, len(hashes)+1)
+	for _, hash := range hashes {
+		entry := fuse.DirEntry{Name: hash.String(), Mode: fuse.S_IFLNK}
+		if n.basePath == nil {
+			entry.Mode = fuse.S_IFDIR
+			entry.Ino = n.commitCache.AttrStore.GetOrInsert(hash.String(), false).Ino
 		}
-		return nil
-	})
+		entries = append(entries, entry)
+	}
+	if n.symlinkHead {
+		entries = append(entries, fuse.DirEntry{Name: "HEAD", Mode: fuse.S_IFLNK})
+	}
+	return fs.NewListDirStream(entries), fs.OK
+}
+
+// Lookup returns the link to the commit with the given hash, provided that it belongs to the log,
+// or the HEAD symlink.
+func (n *commitLogNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	if target, ok := n.pendingTarget(name); ok {
+		link := &fs.MemSymlink{Attr: n.attr, Data: []byte(target)}
+		out.Attr = link.Attr
+		out.Mode = fuse.S_IFLNK | 0555
+		return n.NewInode(ctx, link, fs.StableAttr{Mode: fuse.S_IFLNK}), fs.OK
+	}
+	if name == "HEAD" && n.symlinkHead {
+		link := commitSymlink(n.from, nil)
+		out.Attr = link.Attr
+		out.Mode = fuse.S_IFLNK | 0555
+		return n.NewInode(ctx, link, fs.StableAttr{Mode: fuse.S_IFLNK}), fs.OK
+	}
+
+	hash := plumbing.NewHash(name)
+	ok, err := n.contains(hash)
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	if !ok || hash.String() != name {
+		return nil, syscall.ENOENT
+	}
+	commit, err := n.repo.CommitObject(hash)
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get commit object %v: %w", hash, err))
+	}
+	if n.basePath == nil {
+		out.Attr = utils.CommitAttr(commit)
+		out.Mode = fuse.S_IFDIR | 0555
+		return newCommitNode(ctx, commit, n), fs.OK
+	}
+	link := commitSymlink(commit, n.basePath)
+	out.Attr = link.Attr
+	out.Mode = fuse.S_IFLNK | 0555
+	return n.NewInode(ctx, link, fs.StableAttr{Mode: fuse.S_IFLNK}), fs.OK
+}
+
+// isMovable returns true if the node represents a branch which can be moved by replacing HEAD.
+func (n *commitLogNode) isMovable() bool {
+	return n.branch != "" && n.symlinkHead && n.writableRefs
+}
+
+// pendingTarget returns the target of the symlink `name` created in the node, if it has not been renamed yet.
+func (n *commitLogNode) pendingTarget(name string) (string, bool) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	target, ok := n.pending[name]
+	return target, ok
+}
+
+// Symlink creates a symlink, which can then be renamed to HEAD to move the branch. The target is validated,
+// but the branch is not moved until the symlink is renamed.
+func (n *commitLogNode) Symlink(
+	ctx context.Context,
+	target, name string,
+	out *fuse.EntryOut,
+) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"target": target, "name": name})
+	defer logging.Benchmark(time.Now())
+	if !n.isMovable() {
+		return nil, syscall.EROFS
+	}
+	if _, err := parseRefTarget(strings.TrimPrefix(target, "+")); err != nil {
+		return nil, handleRefError(ctx, n, err)
+	}
+	n.lock.Lock()
+	if n.pending == nil {
+		n.pending = make(map[string]string)
+	}
+	n.pending[name] = target
+	n.lock.Unlock()
+	link := &fs.MemSymlink{Attr: n.attr, Data: []byte(target)}
+	out.Attr = link.Attr
+	out.Mode = fuse.S_IFLNK | 0555
+	return n.NewInode(ctx, link, fs.StableAttr{Mode: fuse.S_IFLNK}), fs.OK
+}
+
+// Rename moves the branch to the target of the symlink `name`, if it is renamed to HEAD. Afterward, the kernel is
+// notified to drop the entry of the branch, so that its new state is visible immediately.
+func (n *commitLogNode) Rename(
+	ctx context.Context,
+	name string,
+	newParent fs.InodeEmbedder,
+	newName string,
+	flags uint32,
+) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name, "newName": newName, "flags": flags})
+	defer logging.Benchmark(time.Now())
+	if !n.isMovable() {
+		return syscall.EROFS
+	}
+	target, ok := n.pendingTarget(name)
+	if !ok || newName != "HEAD" || newParent.EmbeddedInode() != n.EmbeddedInode() || flags != 0 {
+		logging.WarningLog.Printf("Only symlinks can be renamed to HEAD of branch %v", n.branch.Short())
+		return syscall.EPERM
+	}
+	_, err := n.moveRef(n.branch, target)
+	if err != nil {
+		return handleRefError(ctx, n, err)
+	}
+	n.lock.Lock()
+	delete(n.pending, name)
+	n.lock.Unlock()
+	if branchName, parent := n.Parent(); parent != nil {
+		// notifying the kernel while it handles the rename may deadlock, so it's done asynchronously
+		go func() {
+			_ = parent.NotifyEntry(branchName)
+		}()
+	}
+	return fs.OK
+}
+
+// Unlink removes a symlink created by Symlink which has not been renamed to HEAD.
+func (n *commitLogNode) Unlink(ctx context.Context, name string) syscall.Errno {
+	logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if _, ok := n.pending[name]; !ok && n.isMovable() {
+		return syscall.EPERM
+	} else if !ok {
+		return syscall.EROFS
+	}
+	delete(n.pending, name)
+	return fs.OK
 }
 
 // getBasePath creates a path that leads linkLevels directories up. If linkLevels == 0, returns nil,
@@ -138,13 +343,13 @@ type commitLogNodeOpts struct {
 }
 
 // newCommitLogNode creates a node commitLogNode from the git log starting at the commit `from`.
-func newCommitLogNode(repo *git.Repository, from *object.Commit, nodeOpts commitLogNodeOpts) (*commitLogNode, error) {
-	opts := &git.LogOptions{From: from.Hash}
-	iter, err := repo.Log(opts)
+// In shallow clones, the log ends at shallow commits.
+func newCommitLogNode(fsCtx *fsContext, from *object.Commit, nodeOpts commitLogNodeOpts) (*commitLogNode, error) {
+	iter, err := fsCtx.log(from)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get commit log: %w", err)
 	}
-	node := newCommitLogNodeFromIter(iter, repo, from, nodeOpts)
+	node := newCommitLogNodeFromIter(iter, fsCtx, from, nodeOpts)
 	return node, nil
 }
 
@@ -152,12 +357,12 @@ func newCommitLogNode(repo *git.Repository, from *object.Commit, nodeOpts commit
 // which may or may not contain `from`.
 func newCommitLogNodeFromIter(
 	iter object.CommitIter,
-	repo *git.Repository,
+	fsCtx *fsContext,
 	from *object.Commit,
 	nodeOpts commitLogNodeOpts,
 ) *commitLogNode {
-	node := &commitLogNode{}
-	node.repo = repo
+	node := &commitLogNode{lock: &sync.Mutex{}, loadLock: &sync.Mutex{}}
+	node.fsContext = fsCtx
 	node.from = from
 	node.iter = iter
 	node.includeHead = nodeOpts.includeHead
@@ -168,5 +373,26 @@ func newCommitLogNodeFromIter(
 	return node
 }
 
-var _ fs.NodeOnAdder = (*commitLogNode)(nil)
+// newCommitLogNodeLinkingCommits creates a commitLogNode from a CommitIter, with symlinks pointing to the directories
+// in `commits`. depth is the depth of the created node below the mount root.
+func newCommitLogNodeLinkingCommits(
+	iter object.CommitIter,
+	fsCtx *fsContext,
+	from *object.Commit,
+	depth int,
+) *commitLogNode {
+	nodeOpts := commitLogNodeOpts{linkLevels: depth, includeHead: true}
+	node := newCommitLogNodeFromIter(iter, fsCtx, from, nodeOpts)
+	basePath := path.Join(*node.basePath, "commits")
+	node.basePath = &basePath
+	return node
+}
+
+var _ fs.NodeLookuper = (*commitLogNode)(nil)
+var _ fs.NodeReaddirer = (*commitLogNode)(nil)
 var _ fs.NodeGetattrer = (*commitLogNode)(nil)
+var _ fs.NodeGetxattrer = (*commitLogNode)(nil)
+var _ fs.NodeListxattrer = (*commitLogNode)(nil)
+var _ fs.NodeSymlinker = (*commitLogNode)(nil)
+var _ fs.NodeRenamer = (*commitLogNode)(nil)
+var _ fs.NodeUnlinker = (*commitLogNode)(nil)
@@ -1,10 +1,13 @@
 package gitfs
 
 import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"path"
 	"testing"
+	"time"
 )
 
 func Test_commitSymlink(t *testing.T) {
@@ -117,6 +120,16 @@ func commitLogNodeTestCase(t *testing.T, extras repoExtras, node *commitLogNode,
 		assert.Equal(t, expected.headLink, p, "incorrect HEAD symlink path")
 	})
 
+	t.Run("xattr", func(t *testing.T) {
+		if expected.expectSymlinks {
+			// symlinks point outside the mounted node
+			return
+		}
+		for _, c := range expected.commits {
+			assertCommitXattrs(t, path.Join(mountPath, extras.commits[c].String()), extras, c)
+		}
+	})
+
 	t.Run("symlinks", func(t *testing.T) {
 		for _, c := range expectedCommits {
 			p := path.Join(mountPath, c)
@@ -136,7 +149,6 @@ func commitLogNodeTestCase(t *testing.T, extras repoExtras, node *commitLogNode,
 }
 
 func Test_CommitLogNode(t *testing.T) {
-	Init()
 	repo, extras := makeRepo(t)
 	type args struct {
 		from string
@@ -201,9 +213,60 @@ func Test_CommitLogNode(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Error during commit retrieval: %v", err)
 			}
-			node, err := newCommitLogNode(repo, commitObj, tc.opts)
+			node, err := newCommitLogNode(newFsContext(repo), commitObj, tc.opts)
 			assert.NoError(t, err, "unexpected error during node creation")
 			commitLogNodeTestCase(t, extras, node, tc.expected)
 		})
 	}
 }
+
+// blockingCommitIter is a CommitIter which blocks until `release` is closed, after signalling on `started`.
+type blockingCommitIter struct {
+	object.CommitIter
+	started chan struct{}
+	release chan struct{}
+}
+
+func (i *blockingCommitIter) ForEach(cb func(*object.Commit) error) error {
+	close(i.started)
+	<-i.release
+	return i.CommitIter.ForEach(cb)
+}
+
+func Test_commitLogNode_load(t *testing.T) {
+	repo, extras := makeRepo(t)
+	fsCtx := newFsContext(repo)
+	commit, err := repo.CommitObject(extras.commits["bar"])
+	if err != nil {
+		t.Fatalf("Error during commit retrieval: %v", err)
+	}
+	log, err := fsCtx.log(commit)
+	if err != nil {
+		t.Fatalf("Error during log retrieval: %v", err)
+	}
+	iter := &blockingCommitIter{CommitIter: log, started: make(chan struct{}), release: make(chan struct{})}
+	node := newCommitLogNodeFromIter(iter, fsCtx, commit, commitLogNodeOpts{includeHead: true})
+
+	loaded := make(chan []plumbing.Hash)
+	go func() {
+		hashes, _ := node.load()
+		loaded <- hashes
+	}()
+	<-iter.started
+	done := make(chan struct{})
+	go func() {
+		node.pendingTarget("foo")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("the node should not be locked while the log is read")
+	}
+	close(iter.release)
+	expected := []plumbing.Hash{extras.commits["bar"], extras.commits["foo"]}
+	assert.Equal(t, expected, <-loaded, "incorrect commits")
+	hashes, err := node.load()
+	assert.NoError(t, err, "unexpected error when loading the log again")
+	assert.Equal(t, expected, hashes, "the stored commits should be returned")
+}
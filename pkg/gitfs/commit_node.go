@@ -9,17 +9,28 @@ import (
 	"github.com/hanwen/go-fuse/v2/fuse"
 	"gogitfs/pkg/error_handler"
 	"gogitfs/pkg/gitfs/internal/utils"
+	"gogitfs/pkg/inode_manager"
 	"gogitfs/pkg/logging"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
 // commitNode represents a single commit. It has subdirectories representing the git log starting from this commit,
 // the commit's parents, a symlink representing the first parent of this commit, as well as text files
-// containing the hash and message of the commit.
+// containing the hash and message of the commit. Directories containing the blame of each file
+// in the commit's tree, as well as archives of the tree, are also available. If the commit contains submodules,
+// they are represented in the directory `submodules`. Shallow commits of a shallow clone are treated as root commits,
+// and are marked by an empty file called `shallow`.
+// The children are created on lookup, so that the kernel can forget them.
 type commitNode struct {
 	repoNode
+	inode_manager.ForgetHook
 	commit *object.Commit
+	// submodules are the submodules of the commit, read by loadSubmodules
+	submodules     []submodule
+	submodulesOnce sync.Once
 }
 
 func (n *commitNode) GetCallCtx() logging.CallCtx {
@@ -31,72 +42,177 @@ func (n *commitNode) GetCallCtx() logging.CallCtx {
 
 // Getattr returns attributes corresponding to those of the commit - the modification, access and creation times
 // are all set to the timestamp of the commit.
-func (n *commitNode) Getattr(_ context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
-	logging.LogCall(n, nil)
+func (n *commitNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
 	out.Attr = utils.CommitAttr(n.commit)
 	out.Mode = 0555
 	return 0
 }
 
-// addHashMsg creates the child nodes containing the hash and the commit's message.
-func (n *commitNode) addHashMsg(ctx context.Context) {
+// textFile creates a node of a read-only text file with the given contents.
+func (n *commitNode) textFile(data string) fs.InodeEmbedder {
 	attr := utils.CommitAttr(n.commit)
 	attr.Mode = 0444
-	hashNode := &fs.MemRegularFile{Attr: attr, Data: []byte(n.commit.Hash.String())}
-	child := n.NewPersistentInode(ctx, hashNode, fs.StableAttr{Mode: fuse.S_IFREG})
-	n.AddChild("hash", child, false)
-
-	msgNode := &fs.MemRegularFile{Attr: attr, Data: []byte(n.commit.Message)}
-	child = n.NewPersistentInode(ctx, msgNode, fs.StableAttr{Mode: fuse.S_IFREG})
-	n.AddChild("message", child, false)
+	return &fs.MemRegularFile{Attr: attr, Data: []byte(data)}
 }
 
-// addParent adds the symlink to the commit's parent. Note that the symlink always points to a sibling directory.
-func (n *commitNode) addParent(ctx context.Context) {
+// parentLink creates the symlink to the commit's parent. Note that the symlink always points to a sibling directory.
+// If the commit has no parents or is shallow, nil is returned.
+func (n *commitNode) parentLink() (fs.InodeEmbedder, error) {
+	shallow, err := n.isShallow(n.commit)
+	if err != nil {
+		return nil, err
+	}
+	if shallow {
+		return nil, nil
+	}
 	parent, err := n.commit.Parent(0)
-	if err == nil {
-		parentAttr := utils.CommitAttr(parent)
-		parentAttr.Mode = 0555
-		path := fmt.Sprintf("../%v", parent.Hash.String())
-		parentNode := &fs.MemSymlink{Attr: parentAttr, Data: []byte(path)}
-		child := n.NewPersistentInode(ctx, parentNode, fs.StableAttr{Mode: fuse.S_IFLNK})
-		n.AddChild("parent", child, false)
-	} else if !errors.Is(err, object.ErrParentNotFound) {
-		error_handler.Fatal.HandleError(fmt.Errorf("cannot get commit parent: %w", err))
+	if errors.Is(err, object.ErrParentNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot get commit parent: %w", err)
 	}
+	parentAttr := utils.CommitAttr(parent)
+	parentAttr.Mode = 0555
+	path := fmt.Sprintf("../%v", parent.Hash.String())
+	return &fs.MemSymlink{Attr: parentAttr, Data: []byte(path)}, nil
 }
 
-// addParents adds a commitLogNode representing all the commit's parents.
-func (n *commitNode) addParents(ctx context.Context) {
+// parentsNode creates a commitLogNode representing all the commit's parents.
+func (n *commitNode) parentsNode() (fs.InodeEmbedder, error) {
+	parents, err := n.commitParents(n.commit)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get commit parents: %w", err)
+	}
 	nodeOpts := commitLogNodeOpts{linkLevels: 2}
-	iter := n.commit.Parents()
-	logNode := newCommitLogNodeFromIter(iter, n.repo, n.commit, nodeOpts)
-	child := n.NewPersistentInode(ctx, logNode, fs.StableAttr{Mode: fuse.S_IFDIR})
-	n.AddChild("parents", child, false)
+	return newCommitLogNodeFromIter(parents, n.fsContext, n.commit, nodeOpts), nil
 }
 
-// addLog adds a commitLogNode representing the git log starting from the commit.
-func (n *commitNode) addLog(ctx context.Context) {
+// logNode creates a commitLogNode representing the git log starting from the commit.
+func (n *commitNode) logNode() (fs.InodeEmbedder, error) {
 	nodeOpts := commitLogNodeOpts{linkLevels: 2}
-	logNode, err := newCommitLogNode(n.repo, n.commit, nodeOpts)
+	logNode, err := newCommitLogNode(n.fsContext, n.commit, nodeOpts)
 	if err != nil {
-		error_handler.Fatal.HandleError(fmt.Errorf("cannot create log node: %w", err))
+		return nil, fmt.Errorf("cannot create log node: %w", err)
 	}
-	child := n.NewPersistentInode(ctx, logNode, fs.StableAttr{Mode: fuse.S_IFDIR})
-	n.AddChild("log", child, false)
+	return logNode, nil
 }
 
-// OnAdd creates all the child nodes.
-func (n *commitNode) OnAdd(ctx context.Context) {
-	logging.LogCall(n, nil)
-	n.addHashMsg(ctx)
-	n.addParent(ctx)
-	n.addParents(ctx)
-	n.addLog(ctx)
+// loadSubmodules reads the submodules of the commit. This is only done once.
+func (n *commitNode) loadSubmodules() []submodule {
+	n.submodulesOnce.Do(func() {
+		submodules, err := commitSubmodules(n.repo, n.commit)
+		if err != nil {
+			error_handler.Logging.HandleError(fmt.Errorf("cannot get submodules of commit %v: %w", n.commit.Hash, err))
+		}
+		n.submodules = submodules
+	})
+	return n.submodules
+}
+
+// submodulesNode creates a directory representing the submodules of the commit. If there are no submodules,
+// nil is returned.
+func (n *commitNode) submodulesNode() fs.InodeEmbedder {
+	submodules := n.loadSubmodules()
+	if len(submodules) == 0 {
+		return nil
+	}
+	return &submoduleDirNode{
+		attr:           utils.CommitAttr(n.commit),
+		submodules:     submodules,
+		rawLFSPointers: n.rawLFSPointers,
+	}
+}
+
+// Readdir returns the children of the node. The symlink `parent` and the directory `submodules` are only listed
+// if the commit has parents and submodules, respectively. The file `shallow` is only listed for shallow commits.
+func (n *commitNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	shallow, err := n.isShallow(n.commit)
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	entries := []fuse.DirEntry{
+		{Name: "hash", Mode: fuse.S_IFREG},
+		{Name: "message", Mode: fuse.S_IFREG},
+		{Name: "parents", Mode: fuse.S_IFDIR},
+		{Name: "log", Mode: fuse.S_IFDIR},
+		{Name: "blame", Mode: fuse.S_IFDIR},
+		{Name: "blame-porcelain", Mode: fuse.S_IFDIR},
+	}
+	for _, format := range []archiveFormat{archiveTar, archiveTarGz, archiveZip} {
+		entries = append(entries, fuse.DirEntry{Name: archiveNames[format], Mode: fuse.S_IFREG})
+	}
+	if shallow {
+		entries = append(entries, fuse.DirEntry{Name: "shallow", Mode: fuse.S_IFREG})
+	} else if n.commit.NumParents() > 0 {
+		entries = append(entries, fuse.DirEntry{Name: "parent", Mode: fuse.S_IFLNK})
+	}
+	if len(n.loadSubmodules()) > 0 {
+		entries = append(entries, fuse.DirEntry{Name: "submodules", Mode: fuse.S_IFDIR})
+	}
+	return fs.NewListDirStream(entries), fs.OK
+}
+
+// Lookup creates the child node with the given name.
+func (n *commitNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	var node fs.InodeEmbedder
+	var mode uint32 = fuse.S_IFDIR
+	var err error
+	switch name {
+	case "hash":
+		node, mode = n.textFile(n.commit.Hash.String()), fuse.S_IFREG
+	case "message":
+		node, mode = n.textFile(n.commit.Message), fuse.S_IFREG
+	case "parent":
+		node, err = n.parentLink()
+		mode = fuse.S_IFLNK
+	case "parents":
+		node, err = n.parentsNode()
+	case "shallow":
+		var shallow bool
+		shallow, err = n.isShallow(n.commit)
+		if shallow {
+			node, mode = n.textFile(""), fuse.S_IFREG
+		}
+	case "log":
+		node, err = n.logNode()
+	case "blame":
+		node = newBlameNode(n.fsContext, n.commit, "", blameHuman)
+	case "blame-porcelain":
+		node = newBlameNode(n.fsContext, n.commit, "", blamePorcelain)
+	case "submodules":
+		node = n.submodulesNode()
+	default:
+		for format, archiveName := range archiveNames {
+			if name == archiveName {
+				archive := &archiveFileNode{commit: n.commit, format: format}
+				archive.fsContext = n.fsContext
+				node, mode = archive, fuse.S_IFREG
+			}
+		}
+	}
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	if node == nil {
+		return nil, syscall.ENOENT
+	}
+
+	child := n.NewInode(ctx, node, fs.StableAttr{Mode: mode})
+	var attrOut fuse.AttrOut
+	errno := node.(fs.NodeGetattrer).Getattr(ctx, nil, &attrOut)
+	out.Attr = attrOut.Attr
+	return child, errno
 }
 
 // newCommitNode creates a commit node representing the given commit.
 func newCommitNode(ctx context.Context, commit *object.Commit, parent repoNodeEmbedder) *fs.Inode {
+	fsCtx := parent.embeddedRepoNode().fsContext
 	builder := func() (fs.InodeEmbedder, error) {
 		logging.InfoLog.Printf(
 			"Creating new node for commit %v (%v)",
@@ -104,12 +220,29 @@ func newCommitNode(ctx context.Context, commit *object.Commit, parent repoNodeEm
 			strings.Replace(commit.Message, "\n", ";", -1),
 		)
 		node := commitNode{commit: commit}
-		node.repo = parent.embeddedRepoNode().repo
+		node.fsContext = fsCtx
 		return &node, nil
 	}
-	node, _ := commitCache.GetOrInsert(ctx, commit.Hash.String(), fuse.S_IFDIR, parent, builder, false)
+	node, _ := fsCtx.commitCache.GetOrInsert(ctx, commit.Hash.String(), fuse.S_IFDIR, parent, builder, false)
 	return node
 }
 
-var _ fs.NodeOnAdder = (*commitNode)(nil)
+// Getxattr returns extended attributes describing the commit, see utils.CommitXattrs.
+func (n *commitNode) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	logging.LogCall(ctx, n, logging.CallCtx{"attr": attr})
+	defer logging.Benchmark(time.Now())
+	return utils.CommitXattrs(n.commit).GetXattr(attr, dest)
+}
+
+// Listxattr lists extended attributes describing the commit.
+func (n *commitNode) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	return utils.CommitXattrs(n.commit).ListXattr(dest)
+}
+
+var _ fs.NodeLookuper = (*commitNode)(nil)
+var _ fs.NodeReaddirer = (*commitNode)(nil)
 var _ fs.NodeGetattrer = (*commitNode)(nil)
+var _ fs.NodeGetxattrer = (*commitNode)(nil)
+var _ fs.NodeListxattrer = (*commitNode)(nil)
@@ -1,10 +1,14 @@
 package gitfs
 
 import (
+	"fmt"
 	"github.com/go-git/go-git/v5"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
 	"os"
 	"path"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -16,9 +20,41 @@ func catFile(t *testing.T, path string) string {
 	return string(data)
 }
 
+// getXattr returns the value of the extended attribute `name` of the file specified by `path`.
+// Also asserts that the reading completed successfully.
+func getXattr(t *testing.T, path string, name string) string {
+	dest := make([]byte, 256)
+	n, err := unix.Getxattr(path, name, dest)
+	if !assert.NoError(t, err, "unexpected error when reading attribute %v of %v", name, path) {
+		return ""
+	}
+	return string(dest[:n])
+}
+
+// listXattrs returns the sorted names of extended attributes of the file specified by `path`.
+// Also asserts that the listing completed successfully.
+func listXattrs(t *testing.T, path string) []string {
+	dest := make([]byte, 1024)
+	n, err := unix.Listxattr(path, dest)
+	if !assert.NoError(t, err, "unexpected error when listing attributes of %v", path) {
+		return nil
+	}
+	names := strings.Split(strings.TrimSuffix(string(dest[:n]), "\x00"), "\x00")
+	sort.Strings(names)
+	return names
+}
+
+// assertCommitXattrs checks if the extended attributes of the file specified by `path` describe the commit
+func assertCommitXattrs(t *testing.T, path string, extras repoExtras, commit string) {
+	sig := commitSignatures[commit]
+	assert.Equal(t, extras.commits[commit].String(), getXattr(t, path, "user.git.hash"), "incorrect hash")
+	assert.Equal(t, fmt.Sprintf("%v <%v>", sig.Name, sig.Email), getXattr(t, path, "user.git.author"),
+		"incorrect author")
+}
+
 func commitNodeTestCase(t *testing.T, repo *git.Repository, extras repoExtras, commit string, hasParent bool) {
 	node := &commitNode{}
-	node.repo = repo
+	node.fsContext = newFsContext(repo)
 	commitObj, err := repo.CommitObject(extras.commits[commit])
 	if err != nil {
 		t.Fatalf("Error during commit retrieval: %v", err)
@@ -29,11 +65,11 @@ func commitNodeTestCase(t *testing.T, repo *git.Repository, extras repoExtras, c
 		_ = server.Unmount()
 	}()
 
-	var children []string
+	children := []string{
+		"message", "hash", "log", "parents", "blame", "blame-porcelain", "archive.tar", "archive.tar.gz", "archive.zip",
+	}
 	if hasParent {
-		children = []string{"message", "hash", "log", "parent", "parents"}
-	} else {
-		children = []string{"message", "hash", "log", "parents"}
+		children = append(children, "parent")
 	}
 	t.Run("ls", func(t *testing.T) {
 		assertDirEntries(t, mountPath, children, "incorrect commit directory entries")
@@ -52,6 +88,13 @@ func commitNodeTestCase(t *testing.T, repo *git.Repository, extras repoExtras, c
 			})
 		}
 	})
+	t.Run("xattr", func(t *testing.T) {
+		assertCommitXattrs(t, mountPath, extras, commit)
+		expected := []string{"user.git.author", "user.git.committer", "user.git.hash", "user.git.tree"}
+		assert.Equal(t, expected, listXattrs(t, mountPath), "incorrect attribute names")
+		_, err := unix.Getxattr(mountPath, "user.git.nonexistent", make([]byte, 256))
+		assert.ErrorIs(t, err, unix.ENODATA, "expected ENODATA for a nonexistent attribute")
+	})
 	t.Run("cat", func(t *testing.T) {
 		t.Run("message", func(t *testing.T) {
 			result := catFile(t, path.Join(mountPath, "message"))
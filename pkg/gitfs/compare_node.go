@@ -0,0 +1,334 @@
+package gitfs
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"gogitfs/pkg/error_handler"
+	"gogitfs/pkg/gitfs/internal/utils"
+	"gogitfs/pkg/logging"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// compareSeparator separates the compared revisions in names of compareNodes.
+const compareSeparator = "..."
+
+// compareListNode represents the directory containing comparisons of revisions. Looking up a name of the form
+// <base>...<head>, where base and head are branch names or commit hashes, returns a compareNode.
+type compareListNode struct {
+	repoNode
+}
+
+func (n *compareListNode) GetCallCtx() logging.CallCtx {
+	return utils.NodeCallCtx(n)
+}
+
+// resolveCommit returns the commit corresponding to a branch name or a (possibly abbreviated) hash.
+func resolveCommit(repo *git.Repository, rev string) (*object.Commit, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve revision %v: %w", rev, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get commit object %v: %w", hash, err)
+	}
+	return commit, nil
+}
+
+// Lookup resolves both revisions and returns a compareNode representing their comparison.
+func (n *compareListNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	baseRev, headRev, found := strings.Cut(name, compareSeparator)
+	if !found {
+		logging.WarningLog.Printf("Invalid comparison %v: expected <base>%v<head>", name, compareSeparator)
+		return nil, syscall.EINVAL
+	}
+	var commits [2]*object.Commit
+	for i, rev := range []string{baseRev, headRev} {
+		commit, err := resolveCommit(n.repo, rev)
+		if errors.Is(err, plumbing.ErrReferenceNotFound) || errors.Is(err, plumbing.ErrObjectNotFound) {
+			logging.WarningLog.Printf("Revision %v not found", rev)
+			return nil, syscall.ENOENT
+		} else if err != nil {
+			return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+		}
+		commits[i] = commit
+	}
+
+	node, err := newCompareNode(n.fsContext, commits[0], commits[1])
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot compare %v: %w", name, err))
+	}
+	out.Attr = node.attr()
+	out.Mode = fuse.S_IFDIR | 0555
+	out.SetEntryTimeout(BranchValid)
+	out.SetAttrTimeout(BranchValid)
+	return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFDIR}), fs.OK
+}
+
+// Getattr returns attributes corresponding to the current HEAD commit.
+func (n *compareListNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	attr, err := headAttr(n)
+	if err != nil {
+		return error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get HEAD commit attributes: %w", err))
+	}
+	out.Attr = attr
+	out.Attr.Mode = 0555
+	out.SetTimeout(HeadAttrValid)
+	return fs.OK
+}
+
+func newCompareListNode(fsCtx *fsContext) *compareListNode {
+	node := &compareListNode{}
+	node.fsContext = fsCtx
+	return node
+}
+
+var _ fs.NodeLookuper = (*compareListNode)(nil)
+var _ fs.NodeGetattrer = (*compareListNode)(nil)
+
+// compareNode represents a comparison of two commits, base and head. It contains:
+// * merge-base - a symlink to the merge base of the commits, if one exists
+// * ahead - symlinks to commits reachable from head, but not from base
+// * behind - symlinks to commits reachable from base, but not from head
+// * summary - a text file containing the hashes of the commits and the numbers of commits ahead and behind
+type compareNode struct {
+	repoNode
+	base, head *object.Commit
+	// mergeBase is nil if the commits do not have a common ancestor
+	mergeBase     *object.Commit
+	ahead, behind []plumbing.Hash
+}
+
+func (n *compareNode) GetCallCtx() logging.CallCtx {
+	info := utils.NodeCallCtx(n)
+	info["base"] = n.base.Hash.String()
+	info["head"] = n.head.Hash.String()
+	return info
+}
+
+// attr returns the attributes of the node, which correspond to the head commit.
+func (n *compareNode) attr() fuse.Attr {
+	attr := utils.CommitAttr(n.head)
+	attr.Mode = 0555
+	return attr
+}
+
+// Getattr returns attributes corresponding to the head commit.
+func (n *compareNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	out.Attr = n.attr()
+	return fs.OK
+}
+
+// summary returns the contents of the summary file.
+func (n *compareNode) summary() string {
+	mergeBase := "none"
+	if n.mergeBase != nil {
+		mergeBase = n.mergeBase.Hash.String()
+	}
+	return fmt.Sprintf(
+		"base: %v\nhead: %v\nmerge-base: %v\nahead: %d\nbehind: %d\n",
+		n.base.Hash,
+		n.head.Hash,
+		mergeBase,
+		len(n.ahead),
+		len(n.behind),
+	)
+}
+
+// hashIter creates a CommitIter over the commits with the given hashes.
+func (n *compareNode) hashIter(hashes []plumbing.Hash) object.CommitIter {
+	lookupIter := storer.NewEncodedObjectLookupIter(n.repo.Storer, plumbing.CommitObject, hashes)
+	return object.NewCommitIter(n.repo.Storer, lookupIter)
+}
+
+// children returns the names and modes of the entries of the directory.
+func (n *compareNode) children() []fuse.DirEntry {
+	var entries []fuse.DirEntry
+	if n.mergeBase != nil {
+		entries = append(entries, fuse.DirEntry{Name: "merge-base", Mode: fuse.S_IFLNK})
+	}
+	return append(
+		entries,
+		fuse.DirEntry{Name: "ahead", Mode: fuse.S_IFDIR},
+		fuse.DirEntry{Name: "behind", Mode: fuse.S_IFDIR},
+		fuse.DirEntry{Name: "summary", Mode: fuse.S_IFREG},
+	)
+}
+
+// Readdir returns the entries of the directory.
+func (n *compareNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	return fs.NewListDirStream(n.children()), fs.OK
+}
+
+// Lookup creates the child node with the given name. The children are not persistent, so that they can be
+// freed once the kernel forgets them.
+func (n *compareNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	var node fs.InodeEmbedder
+	var mode uint32
+	switch {
+	case name == "merge-base" && n.mergeBase != nil:
+		basePath := path.Join(*getBasePath(2), "commits")
+		link := commitSymlink(n.mergeBase, &basePath)
+		out.Attr = link.Attr
+		node, mode = link, fuse.S_IFLNK
+	case name == "ahead":
+		// compareNode is located in compare/<base>...<head>, so the logs are 3 directories below the mount root
+		node = newCommitLogNodeLinkingCommits(n.hashIter(n.ahead), n.fsContext, n.head, 3)
+		out.Attr = n.attr()
+		mode = fuse.S_IFDIR
+	case name == "behind":
+		node = newCommitLogNodeLinkingCommits(n.hashIter(n.behind), n.fsContext, n.base, 3)
+		out.Attr = utils.CommitAttr(n.base)
+		out.Attr.Mode = 0555
+		mode = fuse.S_IFDIR
+	case name == "summary":
+		attr := n.attr()
+		attr.Mode = 0444
+		file := &fs.MemRegularFile{Attr: attr, Data: []byte(n.summary())}
+		out.Attr = attr
+		out.Attr.Size = uint64(len(file.Data))
+		node, mode = file, fuse.S_IFREG
+	default:
+		return nil, syscall.ENOENT
+	}
+	out.Mode |= mode
+	return n.NewInode(ctx, node, fs.StableAttr{Mode: mode}), fs.OK
+}
+
+// commitHeap is a max-heap of commits ordered by commit time, used by divergentCommits.
+type commitHeap []*object.Commit
+
+func (h commitHeap) Len() int { return len(h) }
+func (h commitHeap) Less(i, j int) bool {
+	return h[i].Committer.When.After(h[j].Committer.When)
+}
+func (h commitHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *commitHeap) Push(x any)   { *h = append(*h, x.(*object.Commit)) }
+func (h *commitHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// Flags used by compareCommits. A commit is marked with the sides it is reachable from, and as stale if it is
+// reachable from a common ancestor of both sides.
+const (
+	reachableFromA = 1 << iota
+	reachableFromB
+	reachableFromStale
+	reachableFromBoth = reachableFromA | reachableFromB
+)
+
+// compareCommits returns the hashes of commits reachable from `a`, but not from `b`, and those reachable from `b`,
+// but not from `a`, newest first, as well as the merge base of the commits (nil if there is none).
+// As in `git rev-list a...b`, both histories are walked at the same time, newest commits first, marking each commit
+// with the sides it is reachable from. The first commits found to be reachable from both sides are the merge bases,
+// and the walk stops once all remaining commits are their ancestors, instead of visiting the whole history.
+func (c *fsContext) compareCommits(a, b *object.Commit) ([]plumbing.Hash, []plumbing.Hash, *object.Commit, error) {
+	shallow, err := c.shallowCommits()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	flags := make(map[plumbing.Hash]int)
+	var order []plumbing.Hash
+	var candidates []*object.Commit
+	queue := &commitHeap{}
+	// mark adds flags to the commit, queueing it again if they changed, so that they reach its ancestors
+	mark := func(commit *object.Commit, f int) {
+		old, seen := flags[commit.Hash]
+		if old|f == old {
+			return
+		}
+		if !seen {
+			order = append(order, commit.Hash)
+		}
+		flags[commit.Hash] = old | f
+		heap.Push(queue, commit)
+	}
+	hasNonStale := func() bool {
+		for _, commit := range *queue {
+			if flags[commit.Hash]&reachableFromStale == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	mark(a, reachableFromA)
+	mark(b, reachableFromB)
+	for hasNonStale() {
+		commit := heap.Pop(queue).(*object.Commit)
+		f := flags[commit.Hash]
+		if f&reachableFromBoth == reachableFromBoth && f&reachableFromStale == 0 {
+			candidates = append(candidates, commit)
+			f |= reachableFromStale
+		}
+		if shallow[commit.Hash] {
+			continue
+		}
+		err := commit.Parents().ForEach(func(parent *object.Commit) error {
+			mark(parent, f)
+			return nil
+		})
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("cannot get parents of %v: %w", commit.Hash, err)
+		}
+	}
+
+	var onlyA, onlyB []plumbing.Hash
+	for _, hash := range order {
+		switch flags[hash] & reachableFromBoth {
+		case reachableFromA:
+			onlyA = append(onlyA, hash)
+		case reachableFromB:
+			onlyB = append(onlyB, hash)
+		}
+	}
+	// candidates which turned out to be reachable from other candidates are not merge bases
+	var mergeBase *object.Commit
+	for _, commit := range candidates {
+		if flags[commit.Hash]&reachableFromStale == 0 {
+			mergeBase = commit
+			break
+		}
+	}
+	return onlyA, onlyB, mergeBase, nil
+}
+
+// newCompareNode creates a compareNode comparing head with base.
+func newCompareNode(fsCtx *fsContext, base, head *object.Commit) (*compareNode, error) {
+	node := &compareNode{base: base, head: head}
+	node.fsContext = fsCtx
+	var err error
+	node.ahead, node.behind, node.mergeBase, err = fsCtx.compareCommits(head, base)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compare %v with %v: %w", head.Hash, base.Hash, err)
+	}
+	return node, nil
+}
+
+var _ fs.NodeLookuper = (*compareNode)(nil)
+var _ fs.NodeReaddirer = (*compareNode)(nil)
+var _ fs.NodeGetattrer = (*compareNode)(nil)
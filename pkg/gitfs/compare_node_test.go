@@ -0,0 +1,109 @@
+package gitfs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+func Test_compareListNode(t *testing.T) {
+	repo, extras := makeRepo(t)
+	node := newCompareListNode(newFsContext(repo))
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+
+	hashes := func(commits ...string) []string {
+		var result []string
+		for _, c := range commits {
+			result = append(result, extras.commits[c].String())
+		}
+		return result
+	}
+
+	testCases := []struct {
+		name          string
+		comparison    string
+		ahead, behind []string
+	}{
+		{"branches", "main...branch", []string{"baz"}, []string{"bar"}},
+		{"same branch", "main...main", nil, nil},
+		{"ancestor", extras.commits["foo"].String() + "...main", []string{"bar"}, nil},
+		{"abbreviated hash", extras.commits["bar"].String()[:8] + "..." + extras.commits["foo"].String(), nil, []string{"bar"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := path.Join(mountPath, tc.comparison)
+			assertDirEntries(t, path.Join(p, "ahead"), hashes(tc.ahead...), "incorrect commits ahead")
+			assertDirEntries(t, path.Join(p, "behind"), hashes(tc.behind...), "incorrect commits behind")
+			for _, c := range hashes(tc.ahead...) {
+				target, err := os.Readlink(path.Join(p, "ahead", c))
+				assert.NoError(t, err, "unexpected Readlink error")
+				assert.Equal(t, "../../../commits/"+c, target, "incorrect symlink path")
+			}
+			summary := catFile(t, path.Join(p, "summary"))
+			assert.Contains(t, summary, fmt.Sprintf("ahead: %d\nbehind: %d\n", len(tc.ahead), len(tc.behind)),
+				"incorrect summary")
+		})
+	}
+
+	t.Run("merge base", func(t *testing.T) {
+		target, err := os.Readlink(path.Join(mountPath, "main...branch", "merge-base"))
+		assert.NoError(t, err, "unexpected Readlink error")
+		assert.Equal(t, "../../commits/"+extras.commits["foo"].String(), target, "incorrect merge base")
+	})
+	t.Run("nonexistent branch", func(t *testing.T) {
+		_, err := os.Stat(path.Join(mountPath, "main...nonexistent"))
+		assert.True(t, os.IsNotExist(err), "error should be an ErrNotExist")
+	})
+	t.Run("invalid name", func(t *testing.T) {
+		_, err := os.Stat(path.Join(mountPath, "main..branch"))
+		assert.True(t, errors.Is(err, syscall.EINVAL), "error should be EINVAL")
+	})
+}
+
+func Test_fsContext_compareCommits(t *testing.T) {
+	repo, extras := makeRepo(t)
+	fsCtx := newFsContext(repo)
+	commit := func(name string) *object.Commit {
+		c, err := repo.CommitObject(extras.commits[name])
+		assert.NoError(t, err, "unexpected error when getting commit")
+		return c
+	}
+
+	testCases := []struct {
+		name         string
+		a, b         string
+		onlyA, onlyB []plumbing.Hash
+		mergeBase    string
+	}{
+		{
+			"diverged",
+			"baz",
+			"bar",
+			[]plumbing.Hash{extras.commits["baz"]},
+			[]plumbing.Hash{extras.commits["bar"]},
+			"foo",
+		},
+		{"ancestor", "bar", "foo", []plumbing.Hash{extras.commits["bar"]}, nil, "foo"},
+		{"same commit", "foo", "foo", nil, nil, "foo"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			onlyA, onlyB, mergeBase, err := fsCtx.compareCommits(commit(tc.a), commit(tc.b))
+			assert.NoError(t, err, "unexpected error when comparing commits")
+			assert.Equal(t, tc.onlyA, onlyA, "incorrect commits reachable only from a")
+			assert.Equal(t, tc.onlyB, onlyB, "incorrect commits reachable only from b")
+			if assert.NotNil(t, mergeBase, "merge base should be found") {
+				assert.Equal(t, extras.commits[tc.mergeBase], mergeBase.Hash, "incorrect merge base")
+			}
+		})
+	}
+}
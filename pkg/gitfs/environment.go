@@ -1,15 +1,17 @@
 package gitfs
 
-import "gogitfs/pkg/inode_manager"
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"gogitfs/pkg/inode_manager"
+)
 
-// commitCache is an InodeCache storing all commit nodes. This allows us to avoid duplication of commitNode objects.
-var commitCache *inode_manager.InodeCache
+// blameCacheSize is the maximum number of blame results stored in blameResults.
+const blameCacheSize = 64
 
-// branchCache is a branchNodeCache storing all branch nodes and updating them as needed.
-var branchCache *branchNodeCache
-
-// initRun tells us whether Init() has been called.
-var initRun = false
+// nodeCacheSize is the maximum number of nodes stored in commitCache and branchCache. The nodes are usually removed
+// from the caches when the kernel forgets them, the limit bounds the memory used if the kernel keeps many of them.
+const nodeCacheSize = 4096
 
 // commitIno is the initial inode number for the commit nodes.
 var commitIno uint64 = 2 << 60
@@ -17,13 +19,50 @@ var commitIno uint64 = 2 << 60
 // branchIno is the initial inode number for the branch nodes.
 var branchIno uint64 = 2 << 59
 
-func Init() {
-	if initRun {
-		return
-	}
-	commitCache = &inode_manager.InodeCache{}
-	commitCache.Init(commitIno)
-	branchCache = &branchNodeCache{}
-	branchCache.init(branchIno)
-	initRun = true
+// inoHashBits is the number of bits of inode numbers derived from commit hashes and branch names.
+// This makes the inode numbers stable across remounts, while keeping the ranges of commits and branches disjoint.
+const inoHashBits = 59
+
+// fsContext contains the state of a single filesystem, shared by all of its nodes: the repository and the caches.
+// Each RootNode has its own fsContext, so multiple filesystems can be used independently in one process.
+type fsContext struct {
+	repo *git.Repository
+	// commitCache is an InodeCache storing all commit nodes. This allows us to avoid duplication of commitNode
+	// objects. Nodes forgotten by the kernel and the least recently used nodes above nodeCacheSize are removed
+	// from the cache, while their inode numbers remain stable.
+	commitCache *inode_manager.InodeCache
+	// branchCache is a branchNodeCache storing all branch nodes and updating them as needed.
+	branchCache *branchNodeCache
+	// blameResults is a blameCache storing the computed blames of files.
+	blameResults *blameCache
+	// searchResults is a searchCache storing the results of commit searches.
+	searchResults *searchCache
+	// info describes how the filesystem was mounted, see infoNode.
+	info MountInfo
+	// writableRefs enables creating and deleting branches and tags, see RootNode.SetWritableRefs.
+	writableRefs bool
+	// author is the author of commits created in staging areas, see RootNode.SetCommitAuthor.
+	author object.Signature
+	// rawLFSPointers disables replacing Git LFS pointers with the objects, see RootNode.SetRawLFSPointers.
+	rawLFSPointers bool
+	// lfsStats is an lfsStatCache storing the descriptions of blobs served by lfs.
+	lfsStats *lfsStatCache
+}
+
+// newFsContext creates an fsContext for the given repository, with empty caches.
+// Object reads are measured, see instrumentRepo.
+func newFsContext(repo *git.Repository) *fsContext {
+	c := &fsContext{repo: instrumentRepo(repo)}
+	c.commitCache = &inode_manager.InodeCache{}
+	c.commitCache.InitHashed(commitIno, inoHashBits)
+	c.commitCache.InodeStore.SetLimit(nodeCacheSize)
+	c.branchCache = &branchNodeCache{}
+	c.branchCache.initHashed(branchIno, inoHashBits)
+	c.branchCache.InodeStore.SetLimit(nodeCacheSize)
+	c.blameResults = &blameCache{}
+	c.blameResults.init(blameCacheSize)
+	c.searchResults = &searchCache{}
+	c.searchResults.init(SearchValid)
+	c.lfsStats = newLFSStatCache()
+	return c
 }
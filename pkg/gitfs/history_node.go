@@ -0,0 +1,178 @@
+package gitfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"gogitfs/pkg/error_handler"
+	"gogitfs/pkg/gitfs/internal/utils"
+	"gogitfs/pkg/logging"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// historyLogName is the name of the directory containing the log of a directory path.
+const historyLogName = ".log"
+
+// historyNode represents a directory in the file tree of the HEAD commit. Its entries mirror the entries of the tree,
+// except that each file is represented by a commitLogNode containing the commits which modified this file.
+// The log of the directory itself is available in the subdirectory .log.
+// Readdir and Lookup always consider the current HEAD commit.
+type historyNode struct {
+	repoNode
+	// path is the path of the represented directory, relative to the repository root. Empty for the root directory.
+	path string
+	// depth is the number of directories between the mount root and this node, including this node.
+	depth int
+}
+
+func (n *historyNode) GetCallCtx() logging.CallCtx {
+	info := utils.NodeCallCtx(n)
+	info["path"] = n.path
+	return info
+}
+
+// headTree returns the HEAD commit and its subtree corresponding to the node's path.
+func (n *historyNode) headTree() (commit *object.Commit, tree *object.Tree, err error) {
+	commit, err = headCommit(n)
+	if err != nil {
+		return
+	}
+	tree, err = commit.Tree()
+	if err != nil {
+		err = fmt.Errorf("cannot get tree of commit %v: %w", commit.Hash, err)
+		return
+	}
+	if n.path != "" {
+		tree, err = tree.Tree(n.path)
+		if err != nil {
+			err = fmt.Errorf("cannot get tree %v: %w", n.path, err)
+		}
+	}
+	return
+}
+
+// Readdir returns the entries of the represented tree and the .log directory.
+func (n *historyNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	_, tree, err := n.headTree()
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	entries := []fuse.DirEntry{{Name: historyLogName, Mode: fuse.S_IFDIR}}
+	for _, e := range tree.Entries {
+		if e.Name == historyLogName {
+			logging.WarningLog.Printf("Tree entry %v is hidden by the log directory", path.Join(n.path, e.Name))
+			continue
+		}
+		entries = append(entries, fuse.DirEntry{Name: e.Name, Mode: fuse.S_IFDIR})
+	}
+	return fs.NewListDirStream(entries), fs.OK
+}
+
+// Lookup returns the log of the directory if `name == ".log"`. Otherwise, it returns a historyNode for subdirectories
+// or a commitLogNode for other entries of the tree.
+func (n *historyNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	commit, tree, err := n.headTree()
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+
+	var node fs.InodeEmbedder
+	if name == historyLogName {
+		node, err = newHistoryLogNode(n.fsContext, commit, n.path, true, n.depth+1)
+	} else {
+		var entry *object.TreeEntry
+		entry, err = tree.FindEntry(name)
+		if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+			return nil, syscall.ENOENT
+		} else if err != nil {
+			err = fmt.Errorf("cannot get tree entry %v: %w", name, err)
+			return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+		}
+		p := path.Join(n.path, name)
+		if entry.Mode == filemode.Dir {
+			node = newHistoryNode(n.fsContext, p, n.depth+1)
+		} else {
+			node, err = newHistoryLogNode(n.fsContext, commit, p, false, n.depth+1)
+		}
+	}
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+
+	out.Attr = utils.CommitAttr(commit)
+	out.Mode = fuse.S_IFDIR | 0555
+	out.SetAttrTimeout(HeadAttrValid)
+	out.SetEntryTimeout(HeadAttrValid)
+	return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFDIR}), fs.OK
+}
+
+// Getattr returns attributes corresponding to the current HEAD commit.
+func (n *historyNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	attr, err := headAttr(n)
+	if err != nil {
+		return error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get HEAD commit attributes: %w", err))
+	}
+	out.Attr = attr
+	out.Attr.Mode = 0555
+	out.SetTimeout(HeadAttrValid)
+	return fs.OK
+}
+
+// historyPathFilter returns a function matching paths which modify the given path.
+// If isDir is true, all paths inside the directory are matched.
+func historyPathFilter(p string, isDir bool) func(string) bool {
+	if !isDir {
+		return func(s string) bool {
+			return s == p
+		}
+	}
+	if p == "" {
+		return nil
+	}
+	prefix := p + "/"
+	return func(s string) bool {
+		return strings.HasPrefix(s, prefix)
+	}
+}
+
+// newHistoryLogNode creates a commitLogNode containing commits starting from `head` which modified the path `p`.
+// The commits are symlinks to the corresponding directories in `commits`, see newCommitLogNodeLinkingCommits.
+func newHistoryLogNode(
+	fsCtx *fsContext,
+	head *object.Commit,
+	p string,
+	isDir bool,
+	depth int,
+) (*commitLogNode, error) {
+	opts := &git.LogOptions{From: head.Hash, PathFilter: historyPathFilter(p, isDir)}
+	iter, err := fsCtx.repo.Log(opts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get commit log of %v: %w", p, err)
+	}
+	return newCommitLogNodeLinkingCommits(iter, fsCtx, head, depth), nil
+}
+
+// newHistoryNode creates a historyNode representing the directory `p`, located `depth` levels below the mount root.
+func newHistoryNode(fsCtx *fsContext, p string, depth int) *historyNode {
+	node := &historyNode{path: p, depth: depth}
+	node.fsContext = fsCtx
+	return node
+}
+
+var _ fs.NodeLookuper = (*historyNode)(nil)
+var _ fs.NodeReaddirer = (*historyNode)(nil)
+var _ fs.NodeGetattrer = (*historyNode)(nil)
@@ -0,0 +1,83 @@
+package gitfs
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path"
+	"testing"
+)
+
+func Test_historyNode(t *testing.T) {
+	repo, extras := makeRepo(t)
+	node := newHistoryNode(newFsContext(repo), "", 1)
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+
+	commitLink := func(levels int, commit string) string {
+		return path.Join(*getBasePath(levels), "commits", extras.commits[commit].String())
+	}
+	assertLog := func(t *testing.T, p string, levels int, commits ...string) {
+		var expected []string
+		for _, c := range commits {
+			expected = append(expected, extras.commits[c].String())
+		}
+		assertDirEntries(t, p, expected, "incorrect log entries")
+		for _, c := range commits {
+			target, err := os.Readlink(path.Join(p, extras.commits[c].String()))
+			assert.NoError(t, err, "unexpected Readlink error")
+			assert.Equal(t, commitLink(levels, c), target, "incorrect symlink path")
+		}
+	}
+
+	t.Run("ls", func(t *testing.T) {
+		assertDirEntries(t, mountPath, []string{".log", "foo", "bar"}, "incorrect directory entries")
+	})
+	t.Run("file log", func(t *testing.T) {
+		assertLog(t, path.Join(mountPath, "foo"), 2, "foo")
+		assertLog(t, path.Join(mountPath, "bar"), 2, "bar")
+	})
+	t.Run("root log", func(t *testing.T) {
+		assertLog(t, path.Join(mountPath, ".log"), 2, "foo", "bar")
+	})
+	t.Run("lookup nonexistent", func(t *testing.T) {
+		_, err := os.Stat(path.Join(mountPath, "baz"))
+		assert.Error(t, err, "expected an error on running os.Stat on a path absent from HEAD")
+		assert.True(t, os.IsNotExist(err), "error should be an ErrNotExist")
+	})
+
+	// the repository is modified while it is not mounted, since the filesystem reads it concurrently
+	_ = server.Unmount()
+	err := extras.fs.MkdirAll("dir", 0755)
+	if err != nil {
+		t.Fatalf("Cannot create directory: %v", err)
+	}
+	f, err := extras.fs.Create("dir/new")
+	if err != nil {
+		t.Fatalf("Cannot create file: %v", err)
+	}
+	_ = f.Close()
+	_, err = extras.worktree.Add("dir/new")
+	if err != nil {
+		t.Fatalf("Cannot add file: %v", err)
+	}
+	sig := commitSignatures["new"]
+	extras.commits["new"], err = extras.worktree.Commit("new", &git.CommitOptions{Author: &sig})
+	if err != nil {
+		t.Fatalf("Cannot create commit: %v", err)
+	}
+	node = newHistoryNode(newFsContext(repo), "", 1)
+	server, mountPath = mountNode(t, node, noOpCb)
+
+	t.Run("ls with added directory", func(t *testing.T) {
+		assertDirEntries(t, mountPath, []string{".log", "foo", "bar", "dir"}, "incorrect directory entries")
+		assertDirEntries(t, path.Join(mountPath, "dir"), []string{".log", "new"}, "incorrect directory entries")
+	})
+	t.Run("nested log", func(t *testing.T) {
+		assertLog(t, path.Join(mountPath, "dir", ".log"), 3, "new")
+		assertLog(t, path.Join(mountPath, "dir", "new"), 3, "new")
+		assertLog(t, path.Join(mountPath, "foo"), 2, "foo")
+	})
+}
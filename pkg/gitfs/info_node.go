@@ -0,0 +1,327 @@
+package gitfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"gogitfs/pkg/error_handler"
+	"gogitfs/pkg/gitfs/internal/utils"
+	"gogitfs/pkg/logging"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Version is the version of gogitfs, shown in .gogitfs/version. It can be set at build time with
+// -ldflags "-X gogitfs/pkg/gitfs.Version=<version>". If empty, the version is taken from the build info.
+var Version string
+
+// version returns Version, or the module version and VCS revision from the build info.
+func version() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "unknown"
+	}
+	v := info.Main.Version
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			v += " " + setting.Value
+		}
+	}
+	return v
+}
+
+// MountInfo describes how the filesystem was mounted. It is shown in the directory .gogitfs.
+type MountInfo struct {
+	// RepoPath is the path or URL of the mounted repository.
+	RepoPath string
+	// Options describe the mount options, one per line, e.g. as command line flags.
+	Options []string
+}
+
+// infoFile describes a file in .gogitfs.
+type infoFile struct {
+	// read generates the contents of the file
+	read func(n *infoNode) []byte
+	// write executes a command written to the file, or is nil if the file is read-only
+	write func(n *infoNode, command string) error
+}
+
+// infoFiles maps the names of files in .gogitfs to their descriptions.
+var infoFiles = map[string]infoFile{
+	"version": {read: func(_ *infoNode) []byte {
+		return []byte(version() + "\n")
+	}},
+	"repo_path": {read: func(n *infoNode) []byte {
+		return []byte(n.info.RepoPath + "\n")
+	}},
+	"options": {read: func(n *infoNode) []byte {
+		return joinLines(n.info.Options)
+	}},
+	"stats": {read: func(n *infoNode) []byte {
+		return n.stats()
+	}},
+	"log": {read: func(_ *infoNode) []byte {
+		return joinLines(logging.RecentLines())
+	}},
+	"control": {
+		read: func(_ *infoNode) []byte {
+			return joinLines([]string{"refresh"})
+		},
+		write: func(n *infoNode, command string) error {
+			if command != "refresh" {
+				return fmt.Errorf("unknown command %q: %w", command, syscall.EINVAL)
+			}
+			logging.InfoLog.Printf("Refreshing the filesystem")
+			_, root := n.Parent()
+			n.refresh(root)
+			return nil
+		},
+	},
+	"loglevel": {
+		read: func(_ *infoNode) []byte {
+			level := logging.Level()
+			return []byte(level.String() + "\n")
+		},
+		write: func(_ *infoNode, command string) error {
+			var level logging.LogLevelFlag
+			if err := level.Set(command); err != nil {
+				return fmt.Errorf("%w: %w", err, syscall.EINVAL)
+			}
+			logging.InfoLog.Printf("Changing log level to %v", level.String())
+			logging.SetLevel(level)
+			return nil
+		},
+	},
+	"caches": {
+		read: func(_ *infoNode) []byte {
+			return joinLines([]string{"drop"})
+		},
+		write: func(n *infoNode, command string) error {
+			if command != "drop" {
+				return fmt.Errorf("unknown command %q: %w", command, syscall.EINVAL)
+			}
+			logging.InfoLog.Printf("Dropping caches")
+			_, root := n.Parent()
+			n.dropCaches(root)
+			return nil
+		},
+	},
+}
+
+// joinLines joins the lines, terminating each one with a newline.
+func joinLines(lines []string) []byte {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// infoNode represents the hidden directory .gogitfs, which provides information about the running filesystem.
+// It contains the following read-only files:
+// * version - the version of gogitfs
+// * repo_path - the path or URL of the mounted repository
+// * options - the mount options
+// * stats - sizes of the caches, the number of live inodes and counts of operations and errors
+// * log - the most recent log lines, see logging.KeepRecentLines
+// The contents are generated when a file is opened. Additionally, the following files accept commands,
+// one per line, and list the accepted commands when read:
+// * control - `refresh` makes the filesystem reflect the current state of the repository, see RootNode.Refresh
+// * loglevel - a log level, e.g. `DEBUG`, changes the level of the loggers. Reading the file returns
+// the current level
+// * caches - `drop` removes all nodes and results from the caches
+type infoNode struct {
+	repoNode
+}
+
+func (n *infoNode) GetCallCtx() logging.CallCtx {
+	return utils.NodeCallCtx(n)
+}
+
+// stats generates the contents of the file stats, as lines of the form `<name> <value>`.
+// Counts of operations and errors are collected from all filesystems served by the process.
+func (n *infoNode) stats() []byte {
+	var buf bytes.Buffer
+	_, _ = fmt.Fprintf(&buf, "commit_nodes %d\n", n.commitCache.InodeStore.Len())
+	_, _ = fmt.Fprintf(&buf, "branch_nodes %d\n", n.branchCache.InodeStore.Len())
+	_, _ = fmt.Fprintf(&buf, "blame_results %d\n", n.blameResults.len())
+	_, _ = fmt.Fprintf(&buf, "search_results %d\n", n.searchResults.len())
+	_, _ = fmt.Fprintf(&buf, "live_inodes %d\n", countInodes(n.Root()))
+	writeCounts(&buf, "operations.", logging.OperationCounts())
+	writeCounts(&buf, "errors.", error_handler.Fuse.Failures())
+	return buf.Bytes()
+}
+
+// writeCounts writes the counts sorted by key, prefixing the keys with `prefix`.
+func writeCounts(buf *bytes.Buffer, prefix string, counts map[string]uint64) {
+	var keys []string
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		_, _ = fmt.Fprintf(buf, "%s%s %d\n", prefix, k, counts[k])
+	}
+}
+
+// Getattr returns attributes corresponding to the current HEAD commit.
+func (n *infoNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	attr, err := headAttr(n)
+	if err != nil {
+		return error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get HEAD commit attributes: %w", err))
+	}
+	out.Attr = attr
+	out.Attr.Mode = 0555
+	return fs.OK
+}
+
+// Readdir lists the files.
+func (n *infoNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	var entries []fuse.DirEntry
+	for name := range infoFiles {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFREG})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return fs.NewListDirStream(entries), fs.OK
+}
+
+// Lookup returns the file with the given name.
+func (n *infoNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	file, ok := infoFiles[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	node := &infoFileNode{dir: n, name: name, file: file}
+	// the contents change, so the attributes must not be cached
+	out.SetAttrTimeout(0)
+	out.SetEntryTimeout(0)
+	node.fillAttr(&out.Attr)
+	return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFREG}), fs.OK
+}
+
+// infoFileNode represents a file in .gogitfs. The contents are generated when the file is opened,
+// so its size is reported as 0 and it is read using direct I/O. Commands written to writable files
+// are executed immediately.
+type infoFileNode struct {
+	fs.Inode
+	dir  *infoNode
+	name string
+	file infoFile
+}
+
+func (n *infoFileNode) GetCallCtx() logging.CallCtx {
+	info := utils.NodeCallCtx(n)
+	info["name"] = n.name
+	return info
+}
+
+// fillAttr sets the attributes of the file. Since the contents are generated on demand,
+// the times are set to the current time.
+func (n *infoFileNode) fillAttr(attr *fuse.Attr) {
+	now := time.Now()
+	attr.SetTimes(&now, &now, &now)
+	attr.Mode = 0444
+	if n.file.write != nil {
+		attr.Mode = 0644
+	}
+}
+
+// Getattr returns the attributes of the file.
+func (n *infoFileNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	out.SetTimeout(0)
+	n.fillAttr(&out.Attr)
+	return fs.OK
+}
+
+// Setattr allows writable files to be truncated, which happens when they are opened with O_TRUNC,
+// e.g. by `echo refresh > control`. The contents are not affected.
+func (n *infoFileNode) Setattr(
+	ctx context.Context,
+	_ fs.FileHandle,
+	_ *fuse.SetAttrIn,
+	out *fuse.AttrOut,
+) syscall.Errno {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	if n.file.write == nil {
+		return syscall.EROFS
+	}
+	out.SetTimeout(0)
+	n.fillAttr(&out.Attr)
+	return fs.OK
+}
+
+// Open generates the contents of the file. Writable files may be opened for writing.
+func (n *infoFileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	logging.LogCall(ctx, n, logging.CallCtx{"flags": flags})
+	defer logging.Benchmark(time.Now())
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 && n.file.write == nil {
+		return nil, 0, syscall.EROFS
+	}
+	handle := &infoFileHandle{node: n}
+	handle.data = n.file.read(n.dir)
+	return handle, fuse.FOPEN_DIRECT_IO, fs.OK
+}
+
+// infoFileHandle is a handle of an open infoFileNode. The contents generated when the file was opened are read
+// as in bytesFileHandle, while written data is interpreted as commands.
+type infoFileHandle struct {
+	bytesFileHandle
+	node *infoFileNode
+}
+
+// Write executes each non-empty line of data as a command. The offset is ignored.
+// If a command is invalid, EINVAL is returned and the following commands are not executed.
+func (h *infoFileHandle) Write(ctx context.Context, data []byte, _ int64) (uint32, syscall.Errno) {
+	ctx = logging.LogCall(ctx, h.node, logging.CallCtx{"size": len(data)})
+	defer logging.Benchmark(time.Now())
+	for _, line := range strings.Split(string(data), "\n") {
+		command := strings.TrimSpace(line)
+		if command == "" {
+			continue
+		}
+		err := h.node.file.write(h.node.dir, command)
+		if errors.Is(err, syscall.EINVAL) {
+			logging.WarningLog.Printf("Invalid command written to %v: %v", h.node.name, err)
+			return 0, syscall.EINVAL
+		} else if err != nil {
+			return 0, error_handler.Fuse.HandleNodeError(ctx, h.node, err)
+		}
+	}
+	return uint32(len(data)), fs.OK
+}
+
+func newInfoNode(fsCtx *fsContext) *infoNode {
+	node := &infoNode{}
+	node.fsContext = fsCtx
+	return node
+}
+
+var _ fs.NodeLookuper = (*infoNode)(nil)
+var _ fs.NodeReaddirer = (*infoNode)(nil)
+var _ fs.NodeGetattrer = (*infoNode)(nil)
+var _ fs.NodeOpener = (*infoFileNode)(nil)
+var _ fs.NodeGetattrer = (*infoFileNode)(nil)
+var _ fs.NodeSetattrer = (*infoFileNode)(nil)
+var _ fs.FileReader = (*infoFileHandle)(nil)
+var _ fs.FileWriter = (*infoFileHandle)(nil)
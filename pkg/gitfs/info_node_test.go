@@ -0,0 +1,110 @@
+package gitfs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"gogitfs/pkg/logging"
+	"os"
+	"path"
+	"testing"
+)
+
+func Test_infoNode(t *testing.T) {
+	repo, extras := makeRepo(t)
+	node := NewRootNodeFromRepo(repo)
+	node.SetMountInfo(MountInfo{RepoPath: "/path/to/repo", Options: []string{"--foo=bar", "--baz=1"}})
+	logging.KeepRecentLines(1000)
+	defer logging.KeepRecentLines(0)
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+	infoPath := path.Join(mountPath, ".gogitfs")
+	// create some nodes, so that the stats are non-trivial
+	_, err := os.ReadDir(path.Join(mountPath, "commits", extras.commits["foo"].String()))
+	assert.NoError(t, err, "unexpected error when reading commit directory")
+	logging.InfoLog.Printf("test message")
+
+	readFile := func(name string) string {
+		data, err := os.ReadFile(path.Join(infoPath, name))
+		assert.NoError(t, err, "unexpected error when reading %v", name)
+		return string(data)
+	}
+
+	t.Run("ls", func(t *testing.T) {
+		expected := []string{"caches", "control", "log", "loglevel", "options", "repo_path", "stats", "version"}
+		assertDirEntries(t, infoPath, expected)
+	})
+	t.Run("repo_path", func(t *testing.T) {
+		assert.Equal(t, "/path/to/repo\n", readFile("repo_path"), "incorrect repository path")
+	})
+	t.Run("options", func(t *testing.T) {
+		assert.Equal(t, "--foo=bar\n--baz=1\n", readFile("options"), "incorrect options")
+	})
+	t.Run("version", func(t *testing.T) {
+		assert.NotEmpty(t, readFile("version"), "version should not be empty")
+	})
+	t.Run("stats", func(t *testing.T) {
+		stats := readFile("stats")
+		assert.Contains(t, stats, "commit_nodes 1\n", "incorrect number of commit nodes")
+		assert.Contains(t, stats, "search_results 0\n", "incorrect number of search results")
+		assert.Regexp(t, `(?m)^live_inodes \d+$`, stats, "live inodes should be reported")
+		assert.Regexp(t, `(?m)^operations\.allCommitsNode\.Lookup \d+$`, stats, "operations should be counted")
+	})
+	t.Run("log", func(t *testing.T) {
+		assert.Contains(t, readFile("log"), "test message", "recent log lines should be shown")
+	})
+	t.Run("read-only", func(t *testing.T) {
+		err := os.WriteFile(path.Join(infoPath, "options"), []byte("foo"), 0644)
+		assert.Error(t, err, "files should not be writable")
+	})
+}
+
+func Test_NewRootNode_repoPath(t *testing.T) {
+	_, repoPath, _ := makeDiskRepo(t)
+	node, err := NewRootNode(repoPath)
+	if !assert.NoError(t, err, "unexpected error when creating root node") {
+		return
+	}
+	assert.Equal(t, repoPath, node.MountInfo().RepoPath, "incorrect repository path")
+}
+
+func Test_infoNode_control(t *testing.T) {
+	repo, extras := makeRepo(t)
+	node := NewRootNodeFromRepo(repo)
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+	infoPath := path.Join(mountPath, ".gogitfs")
+	writeCommand := func(name, command string) error {
+		return os.WriteFile(path.Join(infoPath, name), []byte(command+"\n"), 0644)
+	}
+
+	t.Run("loglevel", func(t *testing.T) {
+		defer logging.SetLevel(logging.Level())
+		assert.NoError(t, writeCommand("loglevel", "WARNING"), "unexpected error when setting log level")
+		assert.Equal(t, logging.Warning, logging.Level(), "log level should be changed")
+		data, err := os.ReadFile(path.Join(infoPath, "loglevel"))
+		assert.NoError(t, err, "unexpected error when reading log level")
+		assert.Equal(t, "WARNING\n", string(data), "current log level should be shown")
+		assert.Error(t, writeCommand("loglevel", "VERBOSE"), "invalid log level should be rejected")
+		assert.Equal(t, logging.Warning, logging.Level(), "log level should not be changed")
+	})
+	t.Run("caches", func(t *testing.T) {
+		_, err := os.ReadDir(path.Join(mountPath, "commits", extras.commits["foo"].String()))
+		assert.NoError(t, err, "unexpected error when reading commit directory")
+		assert.Equal(t, 1, node.commitCache.InodeStore.Len(), "commit node should be cached")
+		assert.NoError(t, writeCommand("caches", "drop"), "unexpected error when dropping caches")
+		assert.Equal(t, 0, node.commitCache.InodeStore.Len(), "commit cache should be empty")
+		assertDirEntries(t, path.Join(mountPath, "commits", extras.commits["foo"].String(), "parents"), nil)
+	})
+	t.Run("control", func(t *testing.T) {
+		node.searchResults.insert("grep=foo", nil)
+		assert.NoError(t, writeCommand("control", "refresh"), "unexpected error when refreshing")
+		assert.Equal(t, 0, node.searchResults.len(), "search results should be cleared")
+		assert.Error(t, writeCommand("control", "reboot"), "unknown command should be rejected")
+	})
+	t.Run("read-only", func(t *testing.T) {
+		assert.Error(t, writeCommand("stats", "drop"), "read-only files should not be writable")
+	})
+}
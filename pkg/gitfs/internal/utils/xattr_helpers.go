@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"sort"
+	"syscall"
+)
+
+// Xattrs maps names of extended attributes to their values.
+type Xattrs map[string]string
+
+// CommitXattrs creates extended attributes describing a commit.
+func CommitXattrs(commit *object.Commit) Xattrs {
+	return Xattrs{
+		"user.git.hash":      commit.Hash.String(),
+		"user.git.tree":      commit.TreeHash.String(),
+		"user.git.author":    fmt.Sprintf("%v <%v>", commit.Author.Name, commit.Author.Email),
+		"user.git.committer": fmt.Sprintf("%v <%v>", commit.Committer.Name, commit.Committer.Email),
+	}
+}
+
+// GetXattr copies the value of the attribute to dest, as required by fs.NodeGetxattrer.
+func (x Xattrs) GetXattr(attr string, dest []byte) (uint32, syscall.Errno) {
+	value, ok := x[attr]
+	if !ok {
+		return 0, syscall.ENODATA
+	}
+	if len(dest) < len(value) {
+		return uint32(len(value)), syscall.ERANGE
+	}
+	return uint32(copy(dest, value)), 0
+}
+
+// ListXattr copies the null-terminated names of the attributes to dest, as required by fs.NodeListxattrer.
+func (x Xattrs) ListXattr(dest []byte) (uint32, syscall.Errno) {
+	var names []string
+	for k := range x {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var data []byte
+	for _, name := range names {
+		data = append(data, name...)
+		data = append(data, 0)
+	}
+	if len(dest) < len(data) {
+		return uint32(len(data)), syscall.ERANGE
+	}
+	return uint32(copy(dest, data)), 0
+}
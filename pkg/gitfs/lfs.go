@@ -0,0 +1,279 @@
+package gitfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"gogitfs/pkg/gitfs/internal/utils"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// lfsPointerMaxSize is the size limit of Git LFS pointer files. Larger blobs are never treated as pointers.
+const lfsPointerMaxSize = 1024
+
+// lfsVersion is the first line of Git LFS pointer files.
+const lfsVersion = "version https://git-lfs.github.com/spec/v1"
+
+// lfsPointer describes a Git LFS object referenced by a pointer file.
+type lfsPointer struct {
+	// oid is the SHA-256 hash of the object, as a hex string
+	oid  string
+	size int64
+}
+
+// parseLFSPointer parses the contents of a Git LFS pointer file. If the data is not a valid pointer, false is returned.
+func parseLFSPointer(data []byte) (lfsPointer, bool) {
+	var pointer lfsPointer
+	if len(data) >= lfsPointerMaxSize {
+		return pointer, false
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) < 3 || lines[0] != lfsVersion {
+		return pointer, false
+	}
+	var hasOid, hasSize bool
+	for _, line := range lines[1:] {
+		key, value, found := strings.Cut(line, " ")
+		if !found {
+			return pointer, false
+		}
+		switch key {
+		case "oid":
+			oid, ok := strings.CutPrefix(value, "sha256:")
+			if _, err := hex.DecodeString(oid); !ok || err != nil || len(oid) != 2*sha256.Size {
+				return pointer, false
+			}
+			pointer.oid, hasOid = oid, true
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return pointer, false
+			}
+			pointer.size, hasSize = size, true
+		}
+	}
+	return pointer, hasOid && hasSize
+}
+
+// encode returns the contents of the pointer file.
+func (p lfsPointer) encode() []byte {
+	return []byte(fmt.Sprintf("%v\noid sha256:%v\nsize %d\n", lfsVersion, p.oid, p.size))
+}
+
+// objectPath returns the path of the object relative to the git directory.
+func (p lfsPointer) objectPath() string {
+	return path.Join("lfs", "objects", p.oid[0:2], p.oid[2:4], p.oid)
+}
+
+// lfsBlob describes the contents of a blob served by lfsResolver.
+type lfsBlob struct {
+	// size is the size of the served contents
+	size int64
+	// pointer is the pointer stored in the blob, or nil if the blob is not a Git LFS pointer
+	pointer *lfsPointer
+	// resolved is true if the contents of the Git LFS object are served instead of the pointer
+	resolved bool
+}
+
+// addXattrs adds extended attributes describing Git LFS pointers: user.git.lfs.oid with the hash of the object,
+// and user.git.lfs, which is "object" if the contents of the object are served and "pointer" otherwise.
+func (b lfsBlob) addXattrs(xattrs utils.Xattrs) {
+	if b.pointer == nil {
+		return
+	}
+	xattrs["user.git.lfs.oid"] = "sha256:" + b.pointer.oid
+	xattrs["user.git.lfs"] = "pointer"
+	if b.resolved {
+		xattrs["user.git.lfs"] = "object"
+	}
+}
+
+// lfsStatCacheSize is the maximum number of blobs described by an lfsStatCache.
+const lfsStatCacheSize = 16384
+
+// lfsStatCache stores the results of lfsResolver.stat by blob hash, so that listing a directory
+// does not read every small blob again. When maxEntries is reached, all results are removed.
+type lfsStatCache struct {
+	lock       *sync.Mutex
+	maxEntries int
+	results    map[plumbing.Hash]lfsBlob
+}
+
+// newLFSStatCache creates an empty lfsStatCache storing at most lfsStatCacheSize results.
+func newLFSStatCache() *lfsStatCache {
+	return &lfsStatCache{
+		lock:       &sync.Mutex{},
+		maxEntries: lfsStatCacheSize,
+		results:    make(map[plumbing.Hash]lfsBlob),
+	}
+}
+
+// get returns the cached description of the blob with the given hash. If it is absent, ok is set to false.
+func (c *lfsStatCache) get(hash plumbing.Hash) (info lfsBlob, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	info, ok = c.results[hash]
+	return info, ok
+}
+
+// insert saves the description of the blob with the given hash.
+func (c *lfsStatCache) insert(hash plumbing.Hash, info lfsBlob) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.results) >= c.maxEntries {
+		c.results = make(map[plumbing.Hash]lfsBlob)
+	}
+	c.results[hash] = info
+}
+
+// remove removes the description of the blob with the given hash.
+func (c *lfsStatCache) remove(hash plumbing.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.results, hash)
+}
+
+// clear removes all results, e.g. when Git LFS objects may have been fetched.
+func (c *lfsStatCache) clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.results = make(map[plumbing.Hash]lfsBlob)
+}
+
+// lfsResolver serves the contents of blobs of `repo`. Git LFS pointers are replaced with the objects they point to,
+// if the objects are present in lfs/objects in the git directory. Pointers to missing objects are served as they are.
+// If raw is true, pointers are never replaced. The results of stat are stored in stats, which must only be shared
+// by resolvers of the same repository.
+type lfsResolver struct {
+	repo  *git.Repository
+	raw   bool
+	stats *lfsStatCache
+}
+
+// lfs returns the lfsResolver serving the blobs of the repository, see RootNode.SetRawLFSPointers.
+func (c *fsContext) lfs() lfsResolver {
+	return lfsResolver{repo: c.repo, raw: c.rawLFSPointers, stats: c.lfsStats}
+}
+
+// hasObject checks whether the object referenced by the pointer is present. Only repositories stored on disk
+// can contain Git LFS objects.
+func (r lfsResolver) hasObject(pointer lfsPointer) bool {
+	storage := filesystemStorage(r.repo)
+	if storage == nil {
+		return false
+	}
+	info, err := storage.Filesystem().Stat(pointer.objectPath())
+	return err == nil && info.Size() == pointer.size
+}
+
+// stat describes the contents of the blob with the given hash. Only blobs small enough to be pointers are read.
+// The result is cached, see lfsStatCache.
+func (r lfsResolver) stat(hash plumbing.Hash) (lfsBlob, error) {
+	if info, ok := r.stats.get(hash); ok {
+		return info, nil
+	}
+	info, err := r.statBlob(hash)
+	if err != nil {
+		return info, err
+	}
+	r.stats.insert(hash, info)
+	return info, nil
+}
+
+// statBlob describes the contents of the blob with the given hash, see stat.
+func (r lfsResolver) statBlob(hash plumbing.Hash) (lfsBlob, error) {
+	blob, err := r.repo.BlobObject(hash)
+	if err != nil {
+		return lfsBlob{}, fmt.Errorf("cannot get blob %v: %w", hash, err)
+	}
+	info := lfsBlob{size: blob.Size}
+	if blob.Size >= lfsPointerMaxSize {
+		return info, nil
+	}
+	data, err := readBlob(r.repo, hash)
+	if err != nil {
+		return info, err
+	}
+	pointer, ok := parseLFSPointer(data)
+	if !ok {
+		return info, nil
+	}
+	info.pointer = &pointer
+	if !r.raw && r.hasObject(pointer) {
+		info.size = pointer.size
+		info.resolved = true
+	}
+	return info, nil
+}
+
+// open returns a reader of the contents of the blob with the given hash, see stat.
+func (r lfsResolver) open(hash plumbing.Hash) (io.ReadCloser, lfsBlob, error) {
+	info, err := r.stat(hash)
+	if err != nil {
+		return nil, info, err
+	}
+	if info.resolved {
+		file, err := filesystemStorage(r.repo).Filesystem().Open(info.pointer.objectPath())
+		if err != nil {
+			return nil, info, fmt.Errorf("cannot open Git LFS object %v: %w", info.pointer.oid, err)
+		}
+		return file, info, nil
+	}
+	blob, err := r.repo.BlobObject(hash)
+	if err != nil {
+		return nil, info, fmt.Errorf("cannot get blob %v: %w", hash, err)
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, info, fmt.Errorf("cannot read blob %v: %w", hash, err)
+	}
+	return reader, info, nil
+}
+
+// read returns the contents of the blob with the given hash, see stat.
+func (r lfsResolver) read(hash plumbing.Hash) ([]byte, lfsBlob, error) {
+	reader, info, err := r.open(hash)
+	if err != nil {
+		return nil, info, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, info, fmt.Errorf("cannot read blob %v: %w", hash, err)
+	}
+	return data, info, nil
+}
+
+// store saves `data` as a Git LFS object, like the clean filter of Git LFS, and returns the contents
+// of the pointer file referencing it.
+func (r lfsResolver) store(data []byte) ([]byte, error) {
+	storage := filesystemStorage(r.repo)
+	if storage == nil {
+		return nil, fmt.Errorf("cannot store Git LFS objects in a repository not stored on disk")
+	}
+	sum := sha256.Sum256(data)
+	pointer := lfsPointer{oid: hex.EncodeToString(sum[:]), size: int64(len(data))}
+	if !r.hasObject(pointer) {
+		p := pointer.objectPath()
+		err := storage.Filesystem().MkdirAll(path.Dir(p), 0755)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create directory for Git LFS object %v: %w", pointer.oid, err)
+		}
+		err = util.WriteFile(storage.Filesystem(), p, data, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("cannot store Git LFS object %v: %w", pointer.oid, err)
+		}
+		// a blob with this pointer might have been described before the object was present
+		r.stats.remove(plumbing.ComputeHash(plumbing.BlobObject, pointer.encode()))
+	}
+	return pointer.encode(), nil
+}
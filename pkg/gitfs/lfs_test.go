@@ -0,0 +1,188 @@
+package gitfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// addLFSObject stores `data` as a Git LFS object in the repository located at repoPath and returns its pointer.
+func addLFSObject(t *testing.T, repoPath string, data string) lfsPointer {
+	sum := sha256.Sum256([]byte(data))
+	pointer := lfsPointer{oid: hex.EncodeToString(sum[:]), size: int64(len(data))}
+	writeFile(t, path.Join(repoPath, ".git", pointer.objectPath()), data)
+	return pointer
+}
+
+// makeLFSRepo creates a repository stored on disk with the branch `lfs`, pointing to a commit containing
+// the Git LFS pointers `present.bin`, whose object is available, and `missing.bin`, whose object is not.
+func makeLFSRepo(t *testing.T) (*git.Repository, string, lfsPointer, lfsPointer) {
+	repo, repoPath, _ := makeDiskRepo(t)
+	present := addLFSObject(t, repoPath, "large file")
+	missing := lfsPointer{oid: strings.Repeat("ab", sha256.Size), size: 100}
+	hash := storeCommit(t, repo.Storer, []object.TreeEntry{
+		{Name: "missing.bin", Mode: filemode.Regular, Hash: storeBlob(t, repo.Storer, string(missing.encode()))},
+		{Name: "present.bin", Mode: filemode.Regular, Hash: storeBlob(t, repo.Storer, string(present.encode()))},
+	}, "add LFS files")
+	err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("lfs"), hash))
+	if err != nil {
+		t.Fatalf("Error during branch creation: %v", err)
+	}
+	return repo, repoPath, present, missing
+}
+
+// branchHash returns the hash of the commit the branch points to.
+func branchHash(t *testing.T, repo *git.Repository, branch string) plumbing.Hash {
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(branch), false)
+	if err != nil {
+		t.Fatalf("Error during branch retrieval: %v", err)
+	}
+	return ref.Hash()
+}
+
+func Test_parseLFSPointer(t *testing.T) {
+	oid := strings.Repeat("0a", sha256.Size)
+	testCases := []struct {
+		name  string
+		data  string
+		valid bool
+	}{
+		{"valid", lfsVersion + "\noid sha256:" + oid + "\nsize 12345\n", true},
+		{"extension", lfsVersion + "\next-0-foo sha256:" + oid + "\noid sha256:" + oid + "\nsize 1\n", true},
+		{"no version", "oid sha256:" + oid + "\nsize 12345\n", false},
+		{"no size", lfsVersion + "\noid sha256:" + oid + "\n", false},
+		{"short oid", lfsVersion + "\noid sha256:0a\nsize 1\n", false},
+		{"other hash", lfsVersion + "\noid sha1:" + oid + "\nsize 1\n", false},
+		{"regular file", "foo\nbar\nbaz\n", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pointer, ok := parseLFSPointer([]byte(tc.data))
+			assert.Equal(t, tc.valid, ok, "incorrect validity")
+			if tc.valid {
+				assert.Equal(t, oid, pointer.oid, "incorrect oid")
+			}
+		})
+	}
+}
+
+func Test_lfsResolver(t *testing.T) {
+	repo, repoPath, present, missing := makeLFSRepo(t)
+	commit, err := repo.CommitObject(branchHash(t, repo, "lfs"))
+	if err != nil {
+		t.Fatalf("Error during commit retrieval: %v", err)
+	}
+	blobs := func(name string) plumbing.Hash {
+		file, err := commit.File(name)
+		if err != nil {
+			t.Fatalf("Error during file retrieval: %v", err)
+		}
+		return file.Hash
+	}
+
+	t.Run("present object", func(t *testing.T) {
+		data, info, err := lfsResolver{repo: repo, stats: newLFSStatCache()}.read(blobs("present.bin"))
+		assert.NoError(t, err, "unexpected error when reading blob")
+		assert.Equal(t, "large file", string(data), "object contents should be served")
+		assert.Equal(t, present.size, info.size, "incorrect size")
+		xattrs := map[string]string{}
+		info.addXattrs(xattrs)
+		assert.Equal(t, "object", xattrs["user.git.lfs"], "incorrect xattr")
+		assert.Equal(t, "sha256:"+present.oid, xattrs["user.git.lfs.oid"], "incorrect xattr")
+	})
+	t.Run("missing object", func(t *testing.T) {
+		data, info, err := lfsResolver{repo: repo, stats: newLFSStatCache()}.read(blobs("missing.bin"))
+		assert.NoError(t, err, "unexpected error when reading blob")
+		assert.Equal(t, missing.encode(), data, "pointer should be served")
+		assert.Equal(t, int64(len(data)), info.size, "incorrect size")
+		xattrs := map[string]string{}
+		info.addXattrs(xattrs)
+		assert.Equal(t, "pointer", xattrs["user.git.lfs"], "incorrect xattr")
+	})
+	t.Run("raw pointers", func(t *testing.T) {
+		data, info, err := lfsResolver{repo: repo, raw: true, stats: newLFSStatCache()}.read(blobs("present.bin"))
+		assert.NoError(t, err, "unexpected error when reading blob")
+		assert.Equal(t, present.encode(), data, "pointer should be served")
+		assert.False(t, info.resolved, "pointer should not be resolved")
+	})
+	t.Run("archive", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := archiveTar.write(&buf, commit, lfsResolver{repo: repo, stats: newLFSStatCache()})
+		assert.NoError(t, err, "unexpected error when creating archive")
+		tr := tar.NewReader(&buf)
+		header, err := tr.Next()
+		assert.NoError(t, err, "unexpected error when reading archive")
+		header, err = tr.Next()
+		if assert.NoError(t, err, "unexpected error when reading archive") {
+			assert.Equal(t, "present.bin", header.Name, "incorrect file name")
+			data, _ := io.ReadAll(tr)
+			assert.Equal(t, "large file", string(data), "object should be archived")
+		}
+	})
+	t.Run("cached stat", func(t *testing.T) {
+		resolver := lfsResolver{repo: repo, stats: newLFSStatCache()}
+		info, err := resolver.stat(blobs("present.bin"))
+		assert.NoError(t, err, "unexpected error when describing blob")
+		assert.True(t, info.resolved, "pointer should be resolved")
+		err = os.Remove(path.Join(repoPath, ".git", present.objectPath()))
+		assert.NoError(t, err, "cannot remove object")
+		info, err = resolver.stat(blobs("present.bin"))
+		assert.NoError(t, err, "unexpected error when describing blob")
+		assert.True(t, info.resolved, "description should be cached")
+		resolver.stats.clear()
+		info, err = resolver.stat(blobs("present.bin"))
+		assert.NoError(t, err, "unexpected error when describing blob")
+		assert.False(t, info.resolved, "pointer to a removed object should not be resolved")
+	})
+}
+
+func Test_stagingListNode_lfs(t *testing.T) {
+	repo, repoPath, _, missing := makeLFSRepo(t)
+	node := NewRootNodeFromRepo(repo)
+	node.SetWritableRefs(true)
+	node.SetCommitAuthor("Eee Fff", "eee@fff.com")
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+	areaPath := path.Join(mountPath, "staging", "lfs")
+	assert.NoError(t, os.Mkdir(areaPath, 0755), "unexpected error when creating staging area")
+	assert.Equal(t, "large file", catFile(t, path.Join(areaPath, "present.bin")), "object should be served")
+
+	err := os.WriteFile(path.Join(areaPath, "present.bin"), []byte("changed large file"), 0644)
+	assert.NoError(t, err, "cannot modify file")
+	err = os.WriteFile(path.Join(areaPath, commitFileName), []byte("Change LFS file"), 0644)
+	assert.NoError(t, err, "unexpected error when committing")
+
+	commit, err := repo.CommitObject(branchHash(t, repo, "lfs"))
+	if !assert.NoError(t, err, "unexpected error when getting commit") {
+		return
+	}
+	file, err := commit.File("present.bin")
+	if !assert.NoError(t, err, "unexpected error when getting file") {
+		return
+	}
+	contents, _ := file.Contents()
+	pointer, ok := parseLFSPointer([]byte(contents))
+	if assert.True(t, ok, "a pointer should be committed") {
+		data, err := os.ReadFile(path.Join(repoPath, ".git", pointer.objectPath()))
+		assert.NoError(t, err, "object should be stored")
+		assert.Equal(t, "changed large file", string(data), "incorrect object contents")
+	}
+	file, err = commit.File("missing.bin")
+	if assert.NoError(t, err, "unexpected error when getting file") {
+		contents, _ := file.Contents()
+		assert.Equal(t, string(missing.encode()), contents, "unchanged pointer should be kept")
+	}
+}
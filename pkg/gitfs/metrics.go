@@ -0,0 +1,163 @@
+package gitfs
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"gogitfs/pkg/metrics"
+	"sync"
+	"time"
+)
+
+// objectReadDuration is the histogram of the time of reading objects from the repository storage.
+var objectReadDuration = metrics.Default.NewHistogramVec(
+	"gogitfs_object_read_duration_seconds",
+	"Time of reading objects from the repository storage, by object type.",
+	metrics.DefaultBuckets,
+	"type",
+)
+
+// objectReadErrors counts the errors returned when reading objects from the repository storage.
+var objectReadErrors = metrics.Default.NewCounterVec(
+	"gogitfs_object_read_errors_total",
+	"Errors returned when reading objects from the repository storage, by object type.",
+	"type",
+)
+
+// instrumentedStorer wraps the storage of a repository, measuring the time of reading objects.
+// Objects read through the repository, including the trees and blobs of commits, are read using EncodedObject.
+// Reads of objects and references are also synchronized with writes, e.g. of commits created in staging areas,
+// and with reindex, which reloads the index of packfiles.
+type instrumentedStorer struct {
+	storage.Storer
+	// lock is held for reading while objects and references are looked up, and for writing while they are stored
+	// or the index is reloaded
+	lock *sync.RWMutex
+}
+
+// EncodedObject reads the object from the wrapped storage and records the time and the result.
+func (s *instrumentedStorer) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	start := time.Now()
+	s.lock.RLock()
+	obj, err := s.Storer.EncodedObject(t, h)
+	s.lock.RUnlock()
+	objectReadDuration.Observe(time.Since(start).Seconds(), t.String())
+	if err != nil {
+		objectReadErrors.Inc(t.String())
+	}
+	return obj, err
+}
+
+// HasEncodedObject checks whether the object is present in the wrapped storage.
+func (s *instrumentedStorer) HasEncodedObject(h plumbing.Hash) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.Storer.HasEncodedObject(h)
+}
+
+// EncodedObjectSize returns the size of the object in the wrapped storage.
+func (s *instrumentedStorer) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.Storer.EncodedObjectSize(h)
+}
+
+// IterEncodedObjects returns an iterator over the objects of the given type in the wrapped storage.
+func (s *instrumentedStorer) IterEncodedObjects(t plumbing.ObjectType) (storer.EncodedObjectIter, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.Storer.IterEncodedObjects(t)
+}
+
+// SetEncodedObject stores the object in the wrapped storage, while no objects are read.
+func (s *instrumentedStorer) SetEncodedObject(obj plumbing.EncodedObject) (plumbing.Hash, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.Storer.SetEncodedObject(obj)
+}
+
+// Reference returns the reference from the wrapped storage.
+func (s *instrumentedStorer) Reference(name plumbing.ReferenceName) (*plumbing.Reference, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.Storer.Reference(name)
+}
+
+// IterReferences returns an iterator over the references in the wrapped storage.
+func (s *instrumentedStorer) IterReferences() (storer.ReferenceIter, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.Storer.IterReferences()
+}
+
+// SetReference stores the reference in the wrapped storage, while no references are read.
+func (s *instrumentedStorer) SetReference(ref *plumbing.Reference) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.Storer.SetReference(ref)
+}
+
+// CheckAndSetReference stores the reference in the wrapped storage if `old` is its current value,
+// while no references are read.
+func (s *instrumentedStorer) CheckAndSetReference(ref, old *plumbing.Reference) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.Storer.CheckAndSetReference(ref, old)
+}
+
+// RemoveReference removes the reference from the wrapped storage, while no references are read.
+func (s *instrumentedStorer) RemoveReference(name plumbing.ReferenceName) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.Storer.RemoveReference(name)
+}
+
+// update calls `f` with the wrapped storage while holding the lock for writing, so that the references and objects
+// read and written by `f` are not accessed concurrently through the instrumentedStorer. `f` must not use it.
+func (s *instrumentedStorer) update(f func(s storage.Storer) error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return f(s.Storer)
+}
+
+// reindex reloads the index of packfiles of the wrapped filesystem storage, so that packfiles written by other
+// git.Repository instances or processes (e.g. by a fetch) become visible. Object reads wait until the index
+// is loaded.
+func (s *instrumentedStorer) reindex() {
+	fsStorage, ok := s.Storer.(*filesystem.Storage)
+	if !ok {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	fsStorage.Reindex()
+	// looking up a missing object loads the index, so that readers do not load it concurrently
+	_ = fsStorage.HasEncodedObject(plumbing.ZeroHash)
+}
+
+// instrumentRepo returns a copy of the repository which reads objects through instrumentedStorer.
+// The original repository is not modified.
+func instrumentRepo(repo *git.Repository) *git.Repository {
+	if _, ok := repo.Storer.(*instrumentedStorer); ok {
+		return repo
+	}
+	instrumented := *repo
+	instrumented.Storer = &instrumentedStorer{Storer: repo.Storer, lock: &sync.RWMutex{}}
+	return &instrumented
+}
+
+// filesystemStorage returns the filesystem storage of the repository, or nil if the repository is not stored
+// in a filesystem. Storage wrapped by instrumentRepo is unwrapped.
+func filesystemStorage(repo *git.Repository) *filesystem.Storage {
+	s := repo.Storer
+	if instrumented, ok := s.(*instrumentedStorer); ok {
+		s = instrumented.Storer
+	}
+	fsStorage, ok := s.(*filesystem.Storage)
+	if !ok {
+		return nil
+	}
+	return fsStorage
+}
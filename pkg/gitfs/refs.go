@@ -0,0 +1,224 @@
+package gitfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage"
+	"gogitfs/pkg/error_handler"
+	"gogitfs/pkg/logging"
+	"path"
+	"strings"
+	"syscall"
+)
+
+// parseRefTarget returns the hash of the commit pointed to by `target`, the target of a symlink created
+// in the branches or tags directory. The target must be a commit hash, optionally preceded by the path
+// of the commits directory, e.g. ../commits/<hash>.
+func parseRefTarget(target string) (plumbing.Hash, error) {
+	dir, base := path.Split(path.Clean(target))
+	if !plumbing.IsHash(base) {
+		return plumbing.ZeroHash, fmt.Errorf("%q does not point to a commit: %w", target, syscall.EINVAL)
+	}
+	if dir != "" && path.Base(dir) != "commits" {
+		return plumbing.ZeroHash, fmt.Errorf("%q does not point to the commits directory: %w", target, syscall.EINVAL)
+	}
+	return plumbing.NewHash(base), nil
+}
+
+// createRef creates the reference `name` pointing to the commit which the symlink target `target` points to,
+// see parseRefTarget. Fails with EROFS if the references are not writable, EINVAL if the name or target
+// is invalid, ENOENT if the commit does not exist and EEXIST if the reference already exists.
+func (c *fsContext) createRef(name plumbing.ReferenceName, target string) (*object.Commit, error) {
+	if !c.writableRefs {
+		return nil, fmt.Errorf("cannot create %v: %w", name, syscall.EROFS)
+	}
+	if err := name.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v: %w", err, name, syscall.EINVAL)
+	}
+	hash, err := parseRefTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := c.repo.CommitObject(hash)
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return nil, fmt.Errorf("commit %v not found: %w", hash, syscall.ENOENT)
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot get commit object %v: %w", hash, err)
+	}
+	err = c.updateRefs(func(refs storage.Storer) error {
+		_, err := refs.Reference(name)
+		if err == nil {
+			return fmt.Errorf("%v already exists: %w", name, syscall.EEXIST)
+		} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return fmt.Errorf("cannot get reference %v: %w", name, err)
+		}
+		err = refs.SetReference(plumbing.NewHashReference(name, hash))
+		if err != nil {
+			return fmt.Errorf("cannot create reference %v: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logging.InfoLog.Printf("Created %v at %v", name, hash)
+	return commit, nil
+}
+
+// deleteRef deletes the reference `name`. Fails with EROFS if the references are not writable, ENOENT if
+// the reference does not exist and EBUSY if it is a branch checked out in the repository or one of its
+// linked worktrees.
+func (c *fsContext) deleteRef(name plumbing.ReferenceName) error {
+	if !c.writableRefs {
+		return fmt.Errorf("cannot delete %v: %w", name, syscall.EROFS)
+	}
+	err := c.updateRefs(func(refs storage.Storer) error {
+		_, err := refs.Reference(name)
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return fmt.Errorf("%v not found: %w", name, syscall.ENOENT)
+		} else if err != nil {
+			return fmt.Errorf("cannot get reference %v: %w", name, err)
+		}
+		if name.IsBranch() {
+			checkedOut, err := c.isCheckedOut(refs, name, true)
+			if err != nil {
+				return err
+			}
+			if checkedOut {
+				return fmt.Errorf("%v is checked out: %w", name, syscall.EBUSY)
+			}
+		}
+		err = refs.RemoveReference(name)
+		if err != nil {
+			return fmt.Errorf("cannot delete reference %v: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logging.InfoLog.Printf("Deleted %v", name)
+	return nil
+}
+
+// moveRef moves the branch `name` to the commit which the symlink target `target` points to, see parseRefTarget.
+// Unless the target is prefixed with "+", as in git refspecs, only fast-forwards are allowed. Fails with EROFS
+// if the references are not writable, EINVAL if the target is invalid, ENOENT if the branch or the commit
+// does not exist, EPERM if the move is not a fast-forward and EBUSY if the branch is checked out in a working tree.
+func (c *fsContext) moveRef(name plumbing.ReferenceName, target string) (*object.Commit, error) {
+	if !c.writableRefs {
+		return nil, fmt.Errorf("cannot move %v: %w", name, syscall.EROFS)
+	}
+	target, force := strings.CutPrefix(target, "+")
+	hash, err := parseRefTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := c.repo.CommitObject(hash)
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return nil, fmt.Errorf("commit %v not found: %w", hash, syscall.ENOENT)
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot get commit object %v: %w", hash, err)
+	}
+	old, err := c.repo.Reference(name, false)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, fmt.Errorf("%v not found: %w", name, syscall.ENOENT)
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot get reference %v: %w", name, err)
+	}
+	if old.Hash() == hash {
+		return commit, nil
+	}
+	if !force {
+		oldCommit, err := c.repo.CommitObject(old.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("cannot get commit object %v: %w", old.Hash(), err)
+		}
+		ff, err := oldCommit.IsAncestor(commit)
+		if err != nil {
+			return nil, fmt.Errorf("cannot check if %v is an ancestor of %v: %w", old.Hash(), hash, err)
+		}
+		if !ff {
+			return nil, fmt.Errorf("moving %v to %v is not a fast-forward: %w", name, hash, syscall.EPERM)
+		}
+	}
+	err = c.updateRefs(func(refs storage.Storer) error {
+		checkedOut, err := c.isCheckedOut(refs, name, false)
+		if err != nil {
+			return err
+		}
+		if checkedOut {
+			return fmt.Errorf("%v is checked out: %w", name, syscall.EBUSY)
+		}
+		// fails if the branch was moved since it was read
+		err = refs.CheckAndSetReference(plumbing.NewHashReference(name, hash), old)
+		if err != nil {
+			return fmt.Errorf("cannot update reference %v: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logging.InfoLog.Printf("Moved %v from %v to %v", name, old.Hash(), hash)
+	return commit, nil
+}
+
+// updateRefs calls `update` with the storage of the repository, so that the references it checks do not change
+// until it updates them. Objects and references are not read through the repository in the meantime,
+// see instrumentedStorer.update.
+func (c *fsContext) updateRefs(update func(refs storage.Storer) error) error {
+	if instrumented, ok := c.repo.Storer.(*instrumentedStorer); ok {
+		return instrumented.update(update)
+	}
+	return update(c.repo.Storer)
+}
+
+// isCheckedOut returns true if HEAD of the repository or of one of its linked worktrees points to the branch.
+// HEAD of the repository is read from `refs`. HEAD of a bare repository is only considered if includeBare is true.
+func (c *fsContext) isCheckedOut(
+	refs storer.ReferenceStorer,
+	branch plumbing.ReferenceName,
+	includeBare bool,
+) (bool, error) {
+	head, err := refs.Reference(plumbing.HEAD)
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return false, fmt.Errorf("cannot get HEAD reference: %w", err)
+	}
+	if head != nil && head.Type() == plumbing.SymbolicReference && head.Target() == branch {
+		_, err := c.repo.Worktree()
+		if includeBare || !errors.Is(err, git.ErrIsBareRepository) {
+			return true, nil
+		}
+	}
+	names, err := c.worktreeNames()
+	if err != nil {
+		return false, err
+	}
+	for _, name := range names {
+		headData, err := readWorktreeFile(c.worktreeStorage(), name, "HEAD")
+		if err != nil {
+			return false, fmt.Errorf("cannot read HEAD of worktree %v: %w", name, err)
+		}
+		if target, ok := strings.CutPrefix(headData, "ref: "); ok && plumbing.ReferenceName(target) == branch {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// handleRefError returns the errno for an error from createRef, moveRef or deleteRef. Errors caused by the request,
+// which wrap an errno, are logged as warnings, other errors are handled by error_handler.Fuse.
+func handleRefError(ctx context.Context, n logging.CallCtxGetter, err error) syscall.Errno {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		logging.WarningLog.Printf("%v", err)
+		return errno
+	}
+	return error_handler.Fuse.HandleNodeError(ctx, n, err)
+}
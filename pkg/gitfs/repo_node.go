@@ -3,7 +3,6 @@ package gitfs
 
 import (
 	"fmt"
-	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
@@ -12,9 +11,10 @@ import (
 )
 
 // repoNode is the base class for all repository-related nodes.
+// The fsContext of the filesystem is embedded, so that the repository and the caches are directly accessible.
 type repoNode struct {
 	fs.Inode
-	repo *git.Repository
+	*fsContext
 }
 
 // repoNodeEmbedder is an interface for Inodes which embed repoNode.
@@ -126,7 +126,7 @@ func makeRepo(t *testing.T) (repo *git.Repository, extras repoExtras) {
 
 func Test_headCommit(t *testing.T) {
 	repo, extras := makeRepo(t)
-	n := &repoNode{repo: repo}
+	n := &repoNode{fsContext: newFsContext(repo)}
 
 	c, err := headCommit(n)
 	assert.NoError(t, err, "unexpected error in headCommit")
@@ -136,7 +136,7 @@ func Test_headCommit(t *testing.T) {
 
 func Test_headAttr(t *testing.T) {
 	repo, _ := makeRepo(t)
-	n := &repoNode{repo: repo}
+	n := &repoNode{fsContext: newFsContext(repo)}
 
 	attr, err := headAttr(n)
 	assert.NoError(t, err, "unexpected error in headAttr")
@@ -4,17 +4,27 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
 	"gogitfs/pkg/error_handler"
 	"gogitfs/pkg/gitfs/internal/utils"
 	"gogitfs/pkg/logging"
+	"path/filepath"
 	"syscall"
+	"time"
 )
 
 // RootNode represents the root directory of the FUSE filesystem. It contains the following subdirectories:
 // * branches - contains a representation of each branch in the repository
 // * commits - contains a representation of each commit in the repository
+// * tags - contains a symlink to the tagged commit for each tag in the repository
+// * compare - contains comparisons of pairs of branches or commits
+// * search - contains the results of commit searches
+// * history - mirrors the file tree of the HEAD commit, containing the commits which modified each path
+// * worktrees - contains a representation of each linked worktree of the repository
+// * staging - contains staging areas, in which new commits can be prepared, see stagingListNode
+// * .gogitfs - a hidden directory with information about the running filesystem
 type RootNode struct {
 	repoNode
 }
@@ -24,12 +34,12 @@ func (n *RootNode) GetCallCtx() logging.CallCtx {
 }
 
 // Getattr returns attributes corresponding to the current HEAD commit.
-func (n *RootNode) Getattr(_ context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
-	logging.LogCall(n, nil)
+func (n *RootNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
 	attr, err := headAttr(n)
 	if err != nil {
-		error_handler.Logging.HandleError(fmt.Errorf("cannot get HEAD commit attributes: %w", err))
-		return syscall.EIO
+		return error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get HEAD commit attributes: %w", err))
 	}
 	out.Attr = attr
 	out.Attr.Mode = 0555
@@ -38,32 +48,179 @@ func (n *RootNode) Getattr(_ context.Context, _ fs.FileHandle, out *fuse.AttrOut
 
 // OnAdd creates the child nodes.
 func (n *RootNode) OnAdd(ctx context.Context) {
-	logging.LogCall(n, nil)
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
 	logging.InfoLog.Println("Adding commit list")
-	acNode := newAllCommitsNode(n.repo)
+	acNode := newAllCommitsNode(n.fsContext)
 	child := n.NewPersistentInode(ctx, acNode, fs.StableAttr{Mode: fuse.S_IFDIR})
 	n.AddChild("commits", child, false)
 
 	logging.InfoLog.Println("Adding branch list")
-	blNode := newBranchListNode(n.repo)
+	blNode := newBranchListNode(n.fsContext)
 	child = n.NewPersistentInode(ctx, blNode, fs.StableAttr{Mode: fuse.S_IFDIR})
 	n.AddChild("branches", child, false)
+
+	logging.InfoLog.Println("Adding tag list")
+	tlNode := newTagListNode(n.fsContext)
+	child = n.NewPersistentInode(ctx, tlNode, fs.StableAttr{Mode: fuse.S_IFDIR})
+	n.AddChild("tags", child, false)
+
+	logging.InfoLog.Println("Adding comparisons")
+	cNode := newCompareListNode(n.fsContext)
+	child = n.NewPersistentInode(ctx, cNode, fs.StableAttr{Mode: fuse.S_IFDIR})
+	n.AddChild("compare", child, false)
+
+	logging.InfoLog.Println("Adding commit search")
+	sNode := newSearchListNode(n.fsContext)
+	child = n.NewPersistentInode(ctx, sNode, fs.StableAttr{Mode: fuse.S_IFDIR})
+	n.AddChild("search", child, false)
+
+	logging.InfoLog.Println("Adding path history")
+	hNode := newHistoryNode(n.fsContext, "", 1)
+	child = n.NewPersistentInode(ctx, hNode, fs.StableAttr{Mode: fuse.S_IFDIR})
+	n.AddChild("history", child, false)
+
+	logging.InfoLog.Println("Adding worktree list")
+	wNode := newWorktreeListNode(n.fsContext)
+	child = n.NewPersistentInode(ctx, wNode, fs.StableAttr{Mode: fuse.S_IFDIR})
+	n.AddChild("worktrees", child, false)
+
+	logging.InfoLog.Println("Adding staging areas")
+	stNode := newStagingListNode(n.fsContext)
+	child = n.NewPersistentInode(ctx, stNode, fs.StableAttr{Mode: fuse.S_IFDIR})
+	n.AddChild("staging", child, false)
+
+	logging.InfoLog.Println("Adding filesystem information")
+	iNode := newInfoNode(n.fsContext)
+	child = n.NewPersistentInode(ctx, iNode, fs.StableAttr{Mode: fuse.S_IFDIR})
+	n.AddChild(".gogitfs", child, false)
+}
+
+// SetMountInfo sets the information shown in the directory .gogitfs. It should be called before mounting.
+// By default, the repository path is set by the constructors and the options are empty.
+func (n *RootNode) SetMountInfo(info MountInfo) {
+	n.info = info
+}
+
+// SetWritableRefs enables creating and deleting branches and tags by creating and removing symlinks
+// in the directories branches and tags, as well as creating commits in the directory staging.
+// It should be called before mounting. By default, the filesystem is read-only.
+func (n *RootNode) SetWritableRefs(writable bool) {
+	n.writableRefs = writable
+}
+
+// SetCommitAuthor sets the author of commits created in staging areas. If the name or email is empty,
+// it is taken from the git config of the repository, or the global git config.
+func (n *RootNode) SetCommitAuthor(name, email string) {
+	n.author = object.Signature{Name: name, Email: email}
+}
+
+// MountInfo returns the information shown in the directory .gogitfs.
+func (n *RootNode) MountInfo() MountInfo {
+	return n.info
+}
+
+// Refresh makes the filesystem reflect the current state of the repository immediately, instead of waiting for
+// cached entries to expire. The kernel is notified to drop the entries of the top-level directories
+// (such as branches) and the cached search results are removed. Packfiles added to the repository by other
+// processes or git.Repository instances, e.g. by a fetch, become visible, as do fetched Git LFS objects.
+func (n *RootNode) Refresh() {
+	logging.LogCall(context.Background(), n, nil)
+	n.refresh(n.EmbeddedInode())
+}
+
+// refresh reloads the index of packfiles, clears the cached search results and Git LFS descriptions of blobs,
+// and notifies the kernel to drop the entries of the subdirectories of `root`, see RootNode.Refresh.
+func (c *fsContext) refresh(root *fs.Inode) {
+	if instrumented, ok := c.repo.Storer.(*instrumentedStorer); ok {
+		instrumented.reindex()
+	}
+	c.searchResults.clear()
+	c.lfsStats.clear()
+	for _, dir := range root.Children() {
+		for name := range dir.Children() {
+			_ = dir.NotifyEntry(name)
+		}
+	}
+}
+
+// dropCaches removes all nodes and results from the caches, so that they are recreated from the repository
+// when accessed again. Inode numbers remain the same. The entries of the subdirectories of `root` are dropped
+// as in refresh.
+func (c *fsContext) dropCaches(root *fs.Inode) {
+	c.commitCache.Clear()
+	c.branchCache.Clear()
+	c.blameResults.clear()
+	c.refresh(root)
+}
+
+// LiveInodes returns the number of inodes currently reachable from the root, including the root itself.
+// These are the inodes known to the kernel, as well as the persistent ones. Nodes reachable through multiple
+// paths, such as commits, are counted once.
+func (n *RootNode) LiveInodes() int {
+	return countInodes(n.EmbeddedInode())
+}
+
+// countInodes returns the number of inodes reachable from `root`, each counted once.
+func countInodes(root *fs.Inode) int {
+	visited := map[*fs.Inode]bool{}
+	stack := []*fs.Inode{root}
+	for len(stack) > 0 {
+		inode := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[inode] {
+			continue
+		}
+		visited[inode] = true
+		for _, child := range inode.Children() {
+			stack = append(stack, child)
+		}
+	}
+	return len(visited)
 }
 
 // NewRootNode creates a RootNode for a git repository specified by path. If the repository cannot be accessed
 // or the path does not point to a valid repository, an error is returned.
+// The path may point to a bare repository or to a linked worktree.
+// Each RootNode has its own caches, so multiple filesystems can be served by one process.
 func NewRootNode(path string) (node *RootNode, err error) {
-	Init()
-	repo, err := git.PlainOpen(path)
+	return NewRootNodeWithOptions(path, &git.PlainOpenOptions{EnableDotGitCommonDir: true})
+}
+
+// NewRootNodeWithOptions works like NewRootNode, but the repository is opened using git.PlainOpenWithOptions.
+// This allows e.g. opening a repository from its subdirectory (DetectDotGit) or a linked worktree
+// (EnableDotGitCommonDir).
+func NewRootNodeWithOptions(path string, opts *git.PlainOpenOptions) (node *RootNode, err error) {
+	repo, err := git.PlainOpenWithOptions(path, opts)
 	if err != nil {
 		err = fmt.Errorf("cannot open the Git repository: %w", err)
 		return
 	}
-
-	node = &RootNode{}
-	node.repo = repo
+	node = NewRootNodeFromRepo(repo)
+	if absPath, err := filepath.Abs(path); err == nil {
+		path = absPath
+	}
+	node.info.RepoPath = path
 	return
 }
 
+// NewRootNodeFromRepo creates a RootNode for an already opened repository. The repository may use any storage,
+// e.g. one created by memory.NewStorage.
+func NewRootNodeFromRepo(repo *git.Repository) *RootNode {
+	node := &RootNode{}
+	node.fsContext = newFsContext(repo)
+	if storage := filesystemStorage(repo); storage != nil {
+		node.info.RepoPath = storage.Filesystem().Root()
+	}
+	return node
+}
+
+// SetRawLFSPointers makes the filesystem serve Git LFS pointer files as they are stored in the repository.
+// By default, pointers are replaced with the contents of the objects, if present in lfs/objects in the git directory.
+// It should be called before mounting.
+func (n *RootNode) SetRawLFSPointers(raw bool) {
+	n.rawLFSPointers = raw
+}
+
 var _ fs.NodeOnAdder = (*RootNode)(nil)
 var _ fs.NodeGetattrer = (*RootNode)(nil)
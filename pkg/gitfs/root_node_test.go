@@ -2,6 +2,8 @@ package gitfs
 
 import (
 	"context"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
 	"github.com/stretchr/testify/assert"
@@ -62,15 +64,14 @@ func assertDirEntries(t *testing.T, path string, expected []string, msgAndArgs .
 }
 
 func Test_RootNode(t *testing.T) {
-	node := &RootNode{}
 	repo, _ := makeRepo(t)
-	node.repo = repo
+	node := NewRootNodeFromRepo(repo)
 	server, mountPath := mountNode(t, node, noOpCb)
 	defer func() {
 		_ = server.Unmount()
 	}()
 	t.Run("ls", func(t *testing.T) {
-		expected := []string{"branches", "commits"}
+		expected := []string{".gogitfs", "branches", "commits", "compare", "history", "search", "staging", "tags", "worktrees"}
 		assertDirEntries(t, mountPath, expected, "incorrect root diretory entries")
 	})
 	t.Run("stat", func(t *testing.T) {
@@ -79,3 +80,56 @@ func Test_RootNode(t *testing.T) {
 		assert.Equal(t, commitSignatures["bar"].When, stat.ModTime().UTC(), "incorrect modification time")
 	})
 }
+
+func Test_RootNode_independent(t *testing.T) {
+	repos := make([]repoExtras, 2)
+	mountPaths := make([]string, 2)
+	var hash plumbing.Hash
+	for i := range repos {
+		node := &RootNode{}
+		var repo *git.Repository
+		repo, repos[i] = makeRepo(t)
+		if i == 1 {
+			hash = addCommit(t, repos[i].worktree, repos[i].fs, "new")
+		}
+		node.fsContext = newFsContext(repo)
+		server, mountPath := mountNode(t, node, noOpCb)
+		defer func() {
+			_ = server.Unmount()
+		}()
+		mountPaths[i] = mountPath
+	}
+	// the same commit in both repositories must be represented by separate nodes
+	for _, mountPath := range mountPaths {
+		p := path.Join(mountPath, "commits", repos[0].commits["foo"].String())
+		assertDirEntries(t, p, []string{
+			"message", "hash", "log", "parents", "blame", "blame-porcelain", "archive.tar", "archive.tar.gz", "archive.zip",
+		}, "incorrect commit directory entries")
+	}
+
+	p := path.Join(mountPaths[1], "commits", hash.String())
+	_, err := os.Stat(p)
+	assert.NoError(t, err, "unexpected error on running os.Stat")
+	p = path.Join(mountPaths[0], "commits", hash.String())
+	_, err = os.Stat(p)
+	assert.ErrorIs(t, err, os.ErrNotExist, "commit from another repository should not be visible")
+}
+
+func Test_NewRootNodeWithOptions(t *testing.T) {
+	repoPath := t.TempDir()
+	_, err := git.PlainInit(repoPath, false)
+	if err != nil {
+		t.Fatalf("Error during repository creation: %v", err)
+	}
+	subdir := path.Join(repoPath, "subdir")
+	err = os.Mkdir(subdir, 0755)
+	if err != nil {
+		t.Fatalf("Error during directory creation: %v", err)
+	}
+
+	_, err = NewRootNode(subdir)
+	assert.Error(t, err, "repository should not be detected by default")
+	node, err := NewRootNodeWithOptions(subdir, &git.PlainOpenOptions{DetectDotGit: true})
+	assert.NoError(t, err, "repository should be detected in a parent directory")
+	assert.NotNil(t, node, "node should be created")
+}
@@ -0,0 +1,66 @@
+package gitfs
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"sync"
+	"time"
+)
+
+// searchCacheEntry contains the results of a single query.
+type searchCacheEntry struct {
+	hashes  []plumbing.Hash
+	created time.Time
+}
+
+// searchCache stores the results of commit searches, so that repeated listing of a search directory does not require
+// reading all commits again. The results expire after the specified time.
+type searchCache struct {
+	lock    *sync.Mutex
+	ttl     time.Duration
+	entries map[string]searchCacheEntry
+}
+
+// init performs initialization. ttl specifies how long the results are valid.
+func (c *searchCache) init(ttl time.Duration) {
+	c.lock = &sync.Mutex{}
+	c.ttl = ttl
+	c.entries = make(map[string]searchCacheEntry)
+}
+
+// get returns the results of the given query. If the results are absent or expired, ok is set to false.
+func (c *searchCache) get(query string) (hashes []plumbing.Hash, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.entries[query]
+	if ok && time.Since(entry.created) > c.ttl {
+		delete(c.entries, query)
+		return nil, false
+	}
+	return entry.hashes, ok
+}
+
+// insert saves the results of the given query. Expired entries are removed.
+func (c *searchCache) insert(query string, hashes []plumbing.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for k, v := range c.entries {
+		if time.Since(v.created) > c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[query] = searchCacheEntry{hashes: hashes, created: time.Now()}
+}
+
+// clear removes all results.
+func (c *searchCache) clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = make(map[string]searchCacheEntry)
+}
+
+// len returns the number of cached results, including expired ones which were not removed yet.
+func (c *searchCache) len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.entries)
+}
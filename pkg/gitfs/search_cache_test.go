@@ -0,0 +1,25 @@
+package gitfs
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_searchCache(t *testing.T) {
+	cache := &searchCache{}
+	cache.init(50 * time.Millisecond)
+	hashes := []plumbing.Hash{plumbing.NewHash("a1b2c3")}
+
+	_, ok := cache.get("foo")
+	assert.False(t, ok, "results should be absent before insertion")
+	cache.insert("foo", hashes)
+	result, ok := cache.get("foo")
+	assert.True(t, ok, "results should be present after insertion")
+	assert.Equal(t, hashes, result, "incorrect cached results")
+
+	time.Sleep(100 * time.Millisecond)
+	_, ok = cache.get("foo")
+	assert.False(t, ok, "results should expire")
+}
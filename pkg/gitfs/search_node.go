@@ -0,0 +1,290 @@
+package gitfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"gogitfs/pkg/error_handler"
+	"gogitfs/pkg/gitfs/internal/utils"
+	"gogitfs/pkg/logging"
+	"io"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SearchValid represents expiration time for the results of commit searches
+const SearchValid = 5 * time.Minute
+
+// errInvalidQuery is returned when a search query cannot be parsed.
+var errInvalidQuery = errors.New("invalid search query")
+
+// searchQuery describes the criteria of a commit search. Empty values match all commits.
+type searchQuery struct {
+	// author is matched against the author in the format "Name <email>"
+	author string
+	// grep is matched against the commit message
+	grep string
+	// since is the earliest matching author date (inclusive)
+	since time.Time
+	// until is the latest matching author date (exclusive)
+	until time.Time
+}
+
+// parseSearchDate parses dates given either as YYYY-MM-DD (interpreted as midnight UTC) or in RFC 3339 format.
+func parseSearchDate(s string) (t time.Time, err error) {
+	t, err = time.Parse(time.DateOnly, s)
+	if err == nil {
+		return
+	}
+	t, err = time.Parse(time.RFC3339, s)
+	if err != nil {
+		err = fmt.Errorf("%w: cannot parse date %v", errInvalidQuery, s)
+	}
+	return
+}
+
+// parseSearchQuery parses a query of the form key1=value1,key2=value2,...
+// Allowed keys are: author, grep, since and until.
+func parseSearchQuery(s string) (query searchQuery, err error) {
+	for _, part := range strings.Split(s, ",") {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			err = fmt.Errorf("%w: expected key=value, got %v", errInvalidQuery, part)
+			return
+		}
+		switch key {
+		case "author":
+			query.author = value
+		case "grep":
+			query.grep = value
+		case "since":
+			query.since, err = parseSearchDate(value)
+		case "until":
+			query.until, err = parseSearchDate(value)
+		default:
+			err = fmt.Errorf("%w: unknown key %v", errInvalidQuery, key)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// matches checks whether the commit fulfills all criteria of the query.
+func (q *searchQuery) matches(commit *object.Commit) bool {
+	author := fmt.Sprintf("%v <%v>", commit.Author.Name, commit.Author.Email)
+	if !strings.Contains(author, q.author) {
+		return false
+	}
+	if !strings.Contains(commit.Message, q.grep) {
+		return false
+	}
+	if !q.since.IsZero() && commit.Author.When.Before(q.since) {
+		return false
+	}
+	if !q.until.IsZero() && !commit.Author.When.Before(q.until) {
+		return false
+	}
+	return true
+}
+
+// searchCommitIter filters the commits returned by another iterator, returning only those matching the query.
+// After all commits have been read, the hashes of the matching commits are passed to onDone.
+type searchCommitIter struct {
+	iter    object.CommitIter
+	query   searchQuery
+	matched []plumbing.Hash
+	onDone  func(hashes []plumbing.Hash)
+}
+
+// Next returns the next matching commit.
+func (it *searchCommitIter) Next() (*object.Commit, error) {
+	for {
+		commit, err := it.iter.Next()
+		if err == io.EOF && it.onDone != nil {
+			it.onDone(it.matched)
+			it.onDone = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if it.query.matches(commit) {
+			it.matched = append(it.matched, commit.Hash)
+			return commit, nil
+		}
+	}
+}
+
+// ForEach calls cb for each matching commit. Iteration stops when cb returns an error. If the error is
+// storer.ErrStop, nil is returned.
+func (it *searchCommitIter) ForEach(cb func(*object.Commit) error) error {
+	defer it.Close()
+	for {
+		commit, err := it.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		err = cb(commit)
+		if errors.Is(err, storer.ErrStop) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Close releases the underlying iterator.
+func (it *searchCommitIter) Close() {
+	it.iter.Close()
+}
+
+var _ object.CommitIter = (*searchCommitIter)(nil)
+
+// searchListNode represents the directory containing commit searches. Looking up a name of the form
+// key1=value1,key2=value2,... returns a searchNode containing the commits matching the query.
+type searchListNode struct {
+	repoNode
+}
+
+func (n *searchListNode) GetCallCtx() logging.CallCtx {
+	return utils.NodeCallCtx(n)
+}
+
+// Lookup parses the query and returns a node representing its results.
+func (n *searchListNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	query, err := parseSearchQuery(name)
+	if err != nil {
+		logging.WarningLog.Printf("Cannot parse search query: %v", err)
+		return nil, syscall.EINVAL
+	}
+	out.Attr, err = headAttr(n)
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get HEAD commit attributes: %w", err))
+	}
+	out.Mode = fuse.S_IFDIR | 0555
+	out.SetEntryTimeout(SearchValid)
+	out.SetAttrTimeout(HeadAttrValid)
+	node := &searchNode{queryString: name, query: query}
+	node.fsContext = n.fsContext
+	return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFDIR}), fs.OK
+}
+
+// Getattr returns attributes corresponding to the current HEAD commit.
+func (n *searchListNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	attr, err := headAttr(n)
+	if err != nil {
+		return error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get HEAD commit attributes: %w", err))
+	}
+	out.Attr = attr
+	out.Attr.Mode = 0555
+	out.SetTimeout(HeadAttrValid)
+	return fs.OK
+}
+
+func newSearchListNode(fsCtx *fsContext) *searchListNode {
+	node := &searchListNode{}
+	node.fsContext = fsCtx
+	return node
+}
+
+var _ fs.NodeLookuper = (*searchListNode)(nil)
+var _ fs.NodeGetattrer = (*searchListNode)(nil)
+
+// searchBasePath is the path from a searchNode to the directory containing all commits.
+const searchBasePath = "../../commits"
+
+// searchNode represents the results of a single commit search. Each matching commit is represented by
+// a symlink to the corresponding directory in `commits`. The results are stored in fsContext.searchResults.
+type searchNode struct {
+	repoNode
+	queryString string
+	query       searchQuery
+}
+
+func (n *searchNode) GetCallCtx() logging.CallCtx {
+	info := utils.NodeCallCtx(n)
+	info["query"] = n.queryString
+	return info
+}
+
+// searchEntry creates an entry for the symlink representing a search result.
+func searchEntry(commit *object.Commit) fuse.DirEntry {
+	return fuse.DirEntry{Name: commit.Hash.String(), Mode: fuse.S_IFLNK}
+}
+
+// Readdir returns symlinks to the matching commits. If the results are not cached, they are computed while
+// the directory is being read and saved afterward.
+func (n *searchNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	hashes, ok := n.searchResults.get(n.queryString)
+	if ok {
+		logging.DebugLog.Printf("Using cached results of query %v", n.queryString)
+		lookupIter := storer.NewEncodedObjectLookupIter(n.repo.Storer, plumbing.CommitObject, hashes)
+		iter := object.NewCommitIter(n.repo.Storer, lookupIter)
+		return newCommitDirStream(iter, nil, searchEntry), fs.OK
+	}
+
+	allIter, err := n.repo.CommitObjects()
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get commit objects: %w", err))
+	}
+	iter := &searchCommitIter{iter: allIter, query: n.query}
+	iter.onDone = func(hashes []plumbing.Hash) {
+		n.searchResults.insert(n.queryString, hashes)
+	}
+	return newCommitDirStream(iter, nil, searchEntry), fs.OK
+}
+
+// Lookup returns the symlink to the commit with the given hash, provided that it matches the query.
+func (n *searchNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	hash := plumbing.NewHash(name)
+	commit, err := n.repo.CommitObject(hash)
+	if err != nil {
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			return nil, syscall.ENOENT
+		}
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get commit object %v: %w", hash, err))
+	}
+	if !n.query.matches(commit) {
+		return nil, syscall.ENOENT
+	}
+	basePath := searchBasePath
+	link := commitSymlink(commit, &basePath)
+	out.Attr = link.Attr
+	out.Mode = fuse.S_IFLNK | 0555
+	return n.NewInode(ctx, link, fs.StableAttr{Mode: fuse.S_IFLNK}), fs.OK
+}
+
+// Getattr returns attributes corresponding to the current HEAD commit.
+func (n *searchNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	attr, err := headAttr(n)
+	if err != nil {
+		return error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get HEAD commit attributes: %w", err))
+	}
+	out.Attr = attr
+	out.Attr.Mode = 0555
+	out.SetTimeout(HeadAttrValid)
+	return fs.OK
+}
+
+var _ fs.NodeLookuper = (*searchNode)(nil)
+var _ fs.NodeReaddirer = (*searchNode)(nil)
+var _ fs.NodeGetattrer = (*searchNode)(nil)
@@ -0,0 +1,108 @@
+package gitfs
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_parseSearchQuery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		expected searchQuery
+		isValid  bool
+	}{
+		{
+			"author",
+			"author=foo@bar.com",
+			searchQuery{author: "foo@bar.com"},
+			true,
+		},
+		{
+			"dates",
+			"since=2023-01-01,until=2023-02-01T12:00:00Z",
+			searchQuery{
+				since: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+				until: time.Date(2023, 2, 1, 12, 0, 0, 0, time.UTC),
+			},
+			true,
+		},
+		{
+			"all keys",
+			"grep=abc,author=Foo",
+			searchQuery{author: "Foo", grep: "abc"},
+			true,
+		},
+		{"missing value", "author", searchQuery{}, false},
+		{"unknown key", "foo=bar", searchQuery{}, false},
+		{"invalid date", "since=yesterday", searchQuery{}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := parseSearchQuery(tc.query)
+			if tc.isValid {
+				assert.NoError(t, err, "unexpected error during query parsing")
+				assert.Equal(t, tc.expected, query, "incorrect parsed query")
+			} else {
+				assert.Error(t, err, "expected an error")
+				assert.True(t, errors.Is(err, errInvalidQuery), "error should be errInvalidQuery")
+			}
+		})
+	}
+}
+
+func Test_searchListNode(t *testing.T) {
+	repo, extras := makeRepo(t)
+	node := newSearchListNode(newFsContext(repo))
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+
+	testCases := []struct {
+		name    string
+		query   string
+		commits []string
+	}{
+		{"author email", "author=foo@bar.com", []string{"foo"}},
+		{"author name", "author=Ccc", []string{"bar"}},
+		{"grep", "grep=ba", []string{"bar", "baz"}},
+		{"since", "since=2023-02-01", []string{"bar", "baz"}},
+		{"since and until", "since=2023-02-01,until=2023-02-06", []string{"bar"}},
+		{"no results", "author=nobody", nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var expected []string
+			for _, c := range tc.commits {
+				expected = append(expected, extras.commits[c].String())
+			}
+			p := path.Join(mountPath, tc.query)
+			assertDirEntries(t, p, expected, "incorrect search results")
+			cached, ok := node.searchResults.get(tc.query)
+			assert.True(t, ok, "search results should be cached")
+			assert.Len(t, cached, len(expected), "incorrect number of cached results")
+			assertDirEntries(t, p, expected, "incorrect cached search results")
+
+			for _, c := range expected {
+				target, err := os.Readlink(path.Join(p, c))
+				assert.NoError(t, err, "unexpected Readlink error")
+				assert.Equal(t, "../../commits/"+c, target, "incorrect symlink path")
+			}
+		})
+	}
+
+	t.Run("lookup non-matching", func(t *testing.T) {
+		_, err := os.Lstat(path.Join(mountPath, "author=foo@bar.com", extras.commits["bar"].String()))
+		assert.True(t, os.IsNotExist(err), "error should be an ErrNotExist")
+	})
+	t.Run("invalid query", func(t *testing.T) {
+		_, err := os.Stat(path.Join(mountPath, "foo=bar"))
+		assert.True(t, errors.Is(err, syscall.EINVAL), "error should be EINVAL")
+	})
+}
@@ -0,0 +1,61 @@
+package gitfs
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// shallowCommits returns the set of shallow commits of the repository (listed in .git/shallow), i.e. the commits
+// of a shallow clone whose parents are not available. The set is empty for complete repositories.
+// The file is read each time, since fetching may deepen the clone.
+func (c *fsContext) shallowCommits() (map[plumbing.Hash]bool, error) {
+	hashes, err := c.repo.Storer.Shallow()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read shallow commits: %w", err)
+	}
+	result := make(map[plumbing.Hash]bool, len(hashes))
+	for _, hash := range hashes {
+		result[hash] = true
+	}
+	return result, nil
+}
+
+// isShallow checks whether the commit is a shallow commit. Shallow commits are treated as if they had no parents.
+func (c *fsContext) isShallow(commit *object.Commit) (bool, error) {
+	shallow, err := c.shallowCommits()
+	if err != nil {
+		return false, err
+	}
+	return shallow[commit.Hash], nil
+}
+
+// commitParents returns an iterator over the parents of the commit. If the commit is shallow, the iterator is empty.
+func (c *fsContext) commitParents(commit *object.Commit) (object.CommitIter, error) {
+	shallow, err := c.isShallow(commit)
+	if err != nil {
+		return nil, err
+	}
+	if shallow {
+		return object.NewCommitIter(c.repo.Storer, storer.NewEncodedObjectSliceIter(nil)), nil
+	}
+	return commit.Parents(), nil
+}
+
+// log returns an iterator over the git log starting at the commit `from`. In shallow clones,
+// the log stops at shallow commits instead of failing on missing parents.
+func (c *fsContext) log(from *object.Commit) (object.CommitIter, error) {
+	shallow, err := c.shallowCommits()
+	if err != nil {
+		return nil, err
+	}
+	if len(shallow) == 0 {
+		return c.repo.Log(&git.LogOptions{From: from.Hash})
+	}
+	var isLimit object.CommitFilter = func(commit *object.Commit) bool {
+		return shallow[commit.Hash]
+	}
+	return object.NewFilterCommitIter(from, nil, &isLimit), nil
+}
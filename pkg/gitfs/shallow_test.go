@@ -0,0 +1,81 @@
+package gitfs
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path"
+	"testing"
+)
+
+// makeShallowRepo creates the sample repository and turns it into a shallow clone: the commit foo is removed,
+// and its children bar and baz become shallow commits.
+func makeShallowRepo(t *testing.T) (*git.Repository, repoExtras) {
+	repo, extras := makeRepo(t)
+	storage := repo.Storer.(*memory.Storage)
+	foo := extras.commits["foo"]
+	delete(storage.Objects, foo)
+	delete(storage.Commits, foo)
+	err := storage.SetShallow([]plumbing.Hash{extras.commits["bar"], extras.commits["baz"]})
+	if err != nil {
+		t.Fatalf("Error during setting shallow commits: %v", err)
+	}
+	return repo, extras
+}
+
+func Test_shallow(t *testing.T) {
+	repo, extras := makeShallowRepo(t)
+	bar, err := repo.CommitObject(extras.commits["bar"])
+	if err != nil {
+		t.Fatalf("Error during commit retrieval: %v", err)
+	}
+	node := &commitNode{commit: bar}
+	node.fsContext = newFsContext(repo)
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+
+	t.Run("commit", func(t *testing.T) {
+		assertDirEntries(t, mountPath, []string{
+			"message", "hash", "log", "parents", "blame", "blame-porcelain", "archive.tar", "archive.tar.gz",
+			"archive.zip", "shallow",
+		}, "incorrect commit directory entries")
+		_, err := os.Lstat(path.Join(mountPath, "parent"))
+		assert.ErrorIs(t, err, os.ErrNotExist, "shallow commit should have no parent link")
+		data, err := os.ReadFile(path.Join(mountPath, "shallow"))
+		assert.NoError(t, err, "unexpected error when reading shallow marker")
+		assert.Empty(t, data, "shallow marker should be empty")
+	})
+	t.Run("parents", func(t *testing.T) {
+		assertDirEntries(t, path.Join(mountPath, "parents"), nil, "shallow commit should have no parents")
+	})
+	t.Run("log", func(t *testing.T) {
+		assertDirEntries(t, path.Join(mountPath, "log"), nil, "log should end at the shallow commit")
+	})
+}
+
+func Test_shallow_branch(t *testing.T) {
+	repo, extras := makeShallowRepo(t)
+	node := newBranchListNode(newFsContext(repo))
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+
+	expected := []string{extras.commits["bar"].String(), "HEAD"}
+	assertDirEntries(t, path.Join(mountPath, "main"), expected, "branch should end at the shallow commit")
+}
+
+func Test_shallow_complete(t *testing.T) {
+	repo, extras := makeRepo(t)
+	bar, err := repo.CommitObject(extras.commits["bar"])
+	if err != nil {
+		t.Fatalf("Error during commit retrieval: %v", err)
+	}
+	shallow, err := newFsContext(repo).isShallow(bar)
+	assert.NoError(t, err, "unexpected error when reading shallow commits")
+	assert.False(t, shallow, "commits of a complete repository should not be shallow")
+}
@@ -0,0 +1,428 @@
+package gitfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"gogitfs/pkg/error_handler"
+	"gogitfs/pkg/gitfs/internal/utils"
+	"gogitfs/pkg/logging"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// commitFileName is the name of the file in the top directory of a staging area, which creates commits
+// when a message is written to it.
+const commitFileName = "COMMIT"
+
+// stagingArea describes a staging area, a directory seeded from the tree of a commit, in which the files can be
+// edited. The contents are kept in memory until a commit is created.
+type stagingArea struct {
+	*fsContext
+	// lock protects the contents of the staging area and base
+	lock sync.Mutex
+	name string
+	// branch is the branch advanced by new commits, or an empty name if commits are not added to any branch
+	branch plumbing.ReferenceName
+	// base is the parent of the next commit - the commit the area was seeded from, or the last commit created
+	base *object.Commit
+}
+
+// commit creates a commit from the contents of the staging area, with `root` being its top directory. If the area
+// has a branch, the branch is advanced to the new commit, or created if it does not exist. Fails with EINVAL if
+// the message is empty or the author is unknown, ESTALE if the branch was moved since the area was seeded
+// or the last commit, and EBUSY if the branch is checked out in a working tree.
+func (a *stagingArea) commit(root *stagingDirNode, message string) (*object.Commit, error) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return nil, fmt.Errorf("empty commit message: %w", syscall.EINVAL)
+	}
+	signature, err := a.commitSignature()
+	if err != nil {
+		return nil, err
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	var oldRef *plumbing.Reference
+	if a.branch != "" {
+		oldRef, err = a.repo.Reference(a.branch, false)
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			oldRef = nil
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot get reference %v: %w", a.branch, err)
+		} else if oldRef.Hash() != a.base.Hash {
+			return nil, fmt.Errorf("%v was moved to %v: %w", a.branch, oldRef.Hash(), syscall.ESTALE)
+		}
+		checkedOut, err := a.isCheckedOut(a.repo.Storer, a.branch, false)
+		if err != nil {
+			return nil, err
+		}
+		if checkedOut {
+			return nil, fmt.Errorf("%v is checked out: %w", a.branch, syscall.EBUSY)
+		}
+	}
+
+	treeHash, err := root.buildTree()
+	if err != nil {
+		return nil, err
+	}
+	commit := &object.Commit{
+		Author:       *signature,
+		Committer:    *signature,
+		Message:      message + "\n",
+		TreeHash:     treeHash,
+		ParentHashes: []plumbing.Hash{a.base.Hash},
+	}
+	obj := a.repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return nil, fmt.Errorf("cannot encode commit: %w", err)
+	}
+	hash, err := a.storeObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	commit, err = a.repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get commit object %v: %w", hash, err)
+	}
+	if a.branch != "" {
+		err = a.repo.Storer.CheckAndSetReference(plumbing.NewHashReference(a.branch, hash), oldRef)
+		if err != nil {
+			return nil, fmt.Errorf("cannot update reference %v: %w", a.branch, err)
+		}
+	}
+	logging.InfoLog.Printf("Created commit %v in staging area %v", hash, a.name)
+	a.base = commit
+	return commit, nil
+}
+
+// commitSignature returns the signature of new commits, with the current time. The author set with
+// RootNode.SetCommitAuthor takes precedence over the one configured in the repository or the global git config.
+// If the author is unknown, an error wrapping EINVAL is returned.
+func (c *fsContext) commitSignature() (*object.Signature, error) {
+	signature := &object.Signature{Name: c.author.Name, Email: c.author.Email, When: time.Now()}
+	if signature.Name == "" || signature.Email == "" {
+		cfg, err := c.repo.ConfigScoped(config.GlobalScope)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read git config: %w", err)
+		}
+		for _, user := range []struct{ Name, Email string }{cfg.Author, cfg.User} {
+			if signature.Name == "" {
+				signature.Name = user.Name
+			}
+			if signature.Email == "" {
+				signature.Email = user.Email
+			}
+		}
+	}
+	if signature.Name == "" || signature.Email == "" {
+		return nil, fmt.Errorf("unknown commit author, set user.name and user.email in git config: %w", syscall.EINVAL)
+	}
+	return signature, nil
+}
+
+// stagingListNode represents the directory staging, containing staging areas, in which new commits can be prepared
+// without a working copy. If references are not writable (see RootNode.SetWritableRefs), it is always empty.
+// A staging area is created with `mkdir staging/<name>`, in which case it is seeded from the branch `<name>`,
+// or HEAD if there is no such branch, and new commits advance (or create) the branch. Alternatively,
+// `ln -s ../commits/<hash> staging/<name>` creates a staging area seeded from the commit, whose commits are not
+// added to any branch. Writing a message to COMMIT in the area creates a commit, see stagingCommitNode.
+// Removing the directory of a staging area discards it, along with any changes which have not been committed.
+type stagingListNode struct {
+	repoNode
+	lock sync.Mutex
+	// areas maps the names of the staging areas to their top directories
+	areas map[string]*fs.Inode
+}
+
+func (n *stagingListNode) GetCallCtx() logging.CallCtx {
+	return utils.NodeCallCtx(n)
+}
+
+// Getattr returns attributes corresponding to the current HEAD commit.
+func (n *stagingListNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	attr, err := headAttr(n)
+	if err != nil {
+		return error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get HEAD commit attributes: %w", err))
+	}
+	out.Attr = attr
+	out.Attr.Mode = 0555
+	if n.writableRefs {
+		out.Attr.Mode = 0755
+	}
+	return fs.OK
+}
+
+// Readdir lists the staging areas.
+func (n *stagingListNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	var entries []fuse.DirEntry
+	for name, area := range n.areas {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFDIR, Ino: area.StableAttr().Ino})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return fs.NewListDirStream(entries), fs.OK
+}
+
+// Lookup returns the top directory of the staging area with the given name.
+func (n *stagingListNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	n.lock.Lock()
+	area, ok := n.areas[name]
+	n.lock.Unlock()
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	var attrOut fuse.AttrOut
+	errno := area.Operations().(fs.NodeGetattrer).Getattr(ctx, nil, &attrOut)
+	out.Attr = attrOut.Attr
+	return area, errno
+}
+
+// addArea creates the staging area `name` seeded from `base`. The caller must hold the lock.
+func (n *stagingListNode) addArea(
+	ctx context.Context,
+	name string,
+	branch plumbing.ReferenceName,
+	base *object.Commit,
+) *fs.Inode {
+	area := &stagingArea{fsContext: n.fsContext, name: name, branch: branch, base: base}
+	root := area.newDir(base.TreeHash)
+	root.root = true
+	inode := n.NewPersistentInode(ctx, root, fs.StableAttr{Mode: fuse.S_IFDIR})
+	commitFile := &stagingCommitNode{root: root}
+	inode.AddChild(commitFileName, inode.NewPersistentInode(ctx, commitFile, fs.StableAttr{Mode: fuse.S_IFREG}), false)
+	if n.areas == nil {
+		n.areas = make(map[string]*fs.Inode)
+	}
+	n.areas[name] = inode
+	logging.InfoLog.Printf("Created staging area %v at %v", name, base.Hash)
+	return inode
+}
+
+// Mkdir creates a staging area seeded from the branch `name`, or HEAD if there is no such branch.
+// New commits advance the branch.
+func (n *stagingListNode) Mkdir(
+	ctx context.Context,
+	name string,
+	_ uint32,
+	out *fuse.EntryOut,
+) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	if !n.writableRefs {
+		return nil, syscall.EROFS
+	}
+	branch := plumbing.NewBranchReferenceName(name)
+	if err := branch.Validate(); err != nil {
+		return nil, handleRefError(ctx, n, fmt.Errorf("%w: %v: %w", err, branch, syscall.EINVAL))
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if _, ok := n.areas[name]; ok {
+		return nil, syscall.EEXIST
+	}
+	var base *object.Commit
+	ref, err := n.repo.Reference(branch, false)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		base, err = headCommit(n)
+	} else if err == nil {
+		base, err = n.repo.CommitObject(ref.Hash())
+	}
+	if err != nil {
+		err = fmt.Errorf("cannot get base commit of staging area %v: %w", name, err)
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	area := n.addArea(ctx, name, branch, base)
+	area.Operations().(*stagingDirNode).fillAttr(&out.Attr)
+	return area, fs.OK
+}
+
+// Symlink creates a staging area seeded from the commit which `target` points to, see parseRefTarget.
+// New commits are not added to any branch. The returned symlink is not cached, so that afterward the staging area
+// is looked up as a directory.
+func (n *stagingListNode) Symlink(
+	ctx context.Context,
+	target, name string,
+	out *fuse.EntryOut,
+) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"target": target, "name": name})
+	defer logging.Benchmark(time.Now())
+	if !n.writableRefs {
+		return nil, syscall.EROFS
+	}
+	hash, err := parseRefTarget(target)
+	if err != nil {
+		return nil, handleRefError(ctx, n, err)
+	}
+	base, err := n.repo.CommitObject(hash)
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		logging.WarningLog.Printf("Commit %v not found", hash)
+		return nil, syscall.ENOENT
+	} else if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get commit object %v: %w", hash, err))
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if _, ok := n.areas[name]; ok {
+		return nil, syscall.EEXIST
+	}
+	n.addArea(ctx, name, "", base)
+	basePath := "../commits"
+	link := commitSymlink(base, &basePath)
+	out.Attr = link.Attr
+	out.Mode = fuse.S_IFLNK | 0555
+	out.SetAttrTimeout(0)
+	out.SetEntryTimeout(0)
+	return n.NewInode(ctx, link, fs.StableAttr{Mode: fuse.S_IFLNK}), fs.OK
+}
+
+// Rmdir discards the staging area `name`. The nodes of the area are released, see stagingDirNode.release.
+func (n *stagingListNode) Rmdir(ctx context.Context, name string) syscall.Errno {
+	logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	area, ok := n.areas[name]
+	if !ok {
+		return syscall.ENOENT
+	}
+	delete(n.areas, name)
+	root := area.Operations().(*stagingDirNode)
+	root.area.lock.Lock()
+	root.release()
+	root.area.lock.Unlock()
+	area.ForgetPersistent()
+	logging.InfoLog.Printf("Discarded staging area %v", name)
+	return fs.OK
+}
+
+func newStagingListNode(fsCtx *fsContext) *stagingListNode {
+	node := &stagingListNode{}
+	node.fsContext = fsCtx
+	return node
+}
+
+// stagingCommitNode represents the file COMMIT in the top directory of a staging area. Writing a message to the file
+// creates a commit from the contents of the staging area when the file is closed, see stagingArea.commit.
+// Reading the file returns the hash of the parent of the next commit, i.e. the last commit created.
+type stagingCommitNode struct {
+	fs.Inode
+	root *stagingDirNode
+}
+
+func (n *stagingCommitNode) GetCallCtx() logging.CallCtx {
+	info := utils.NodeCallCtx(n)
+	info["area"] = n.root.area.name
+	return info
+}
+
+// fillAttr sets the attributes of the file. Its contents are generated when the file is opened,
+// so its size is reported as 0.
+func (n *stagingCommitNode) fillAttr(attr *fuse.Attr) {
+	now := time.Now()
+	attr.SetTimes(&now, &now, &now)
+	attr.Mode = fuse.S_IFREG | 0644
+}
+
+// Getattr returns the attributes of the file.
+func (n *stagingCommitNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	out.SetTimeout(0)
+	n.fillAttr(&out.Attr)
+	return fs.OK
+}
+
+// Setattr allows the file to be truncated, which happens when it is opened with O_TRUNC.
+func (n *stagingCommitNode) Setattr(
+	ctx context.Context,
+	_ fs.FileHandle,
+	_ *fuse.SetAttrIn,
+	out *fuse.AttrOut,
+) syscall.Errno {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	out.SetTimeout(0)
+	n.fillAttr(&out.Attr)
+	return fs.OK
+}
+
+// Open creates a handle collecting the commit message.
+func (n *stagingCommitNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	logging.LogCall(ctx, n, logging.CallCtx{"flags": flags})
+	defer logging.Benchmark(time.Now())
+	area := n.root.area
+	area.lock.Lock()
+	defer area.lock.Unlock()
+	handle := &stagingCommitHandle{node: n}
+	handle.data = []byte(area.base.Hash.String() + "\n")
+	return handle, fuse.FOPEN_DIRECT_IO, fs.OK
+}
+
+// stagingCommitHandle is a handle of an open stagingCommitNode. The hash generated when the file was opened is read
+// as in bytesFileHandle, while written data is collected as the commit message.
+type stagingCommitHandle struct {
+	bytesFileHandle
+	node    *stagingCommitNode
+	lock    sync.Mutex
+	message bytes.Buffer
+}
+
+// Write appends `data` to the commit message. The offset is ignored.
+func (h *stagingCommitHandle) Write(ctx context.Context, data []byte, _ int64) (uint32, syscall.Errno) {
+	logging.LogCall(ctx, h.node, logging.CallCtx{"size": len(data)})
+	defer logging.Benchmark(time.Now())
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.message.Write(data)
+	return uint32(len(data)), fs.OK
+}
+
+// Flush creates a commit with the message written so far, if any. Errors are returned by close(2).
+func (h *stagingCommitHandle) Flush(ctx context.Context) syscall.Errno {
+	ctx = logging.LogCall(ctx, h.node, nil)
+	defer logging.Benchmark(time.Now())
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.message.Len() == 0 {
+		return fs.OK
+	}
+	message := h.message.String()
+	h.message.Reset()
+	_, err := h.node.root.area.commit(h.node.root, message)
+	if err != nil {
+		return handleRefError(ctx, h.node, err)
+	}
+	return fs.OK
+}
+
+var _ fs.NodeGetattrer = (*stagingListNode)(nil)
+var _ fs.NodeReaddirer = (*stagingListNode)(nil)
+var _ fs.NodeLookuper = (*stagingListNode)(nil)
+var _ fs.NodeMkdirer = (*stagingListNode)(nil)
+var _ fs.NodeSymlinker = (*stagingListNode)(nil)
+var _ fs.NodeRmdirer = (*stagingListNode)(nil)
+var _ fs.NodeGetattrer = (*stagingCommitNode)(nil)
+var _ fs.NodeSetattrer = (*stagingCommitNode)(nil)
+var _ fs.NodeOpener = (*stagingCommitNode)(nil)
+var _ fs.FileReader = (*stagingCommitHandle)(nil)
+var _ fs.FileWriter = (*stagingCommitHandle)(nil)
+var _ fs.FileFlusher = (*stagingCommitHandle)(nil)
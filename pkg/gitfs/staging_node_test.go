@@ -0,0 +1,236 @@
+package gitfs
+
+import (
+	"context"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// treeFiles returns the contents of the files in the tree, keyed by their paths, and the paths of executable files.
+func treeFiles(t *testing.T, tree *object.Tree) (map[string]string, []string) {
+	files := make(map[string]string)
+	var executable []string
+	err := tree.Files().ForEach(func(f *object.File) error {
+		contents, err := f.Contents()
+		files[f.Name] = contents
+		if f.Mode == filemode.Executable {
+			executable = append(executable, f.Name)
+		}
+		return err
+	})
+	assert.NoError(t, err, "unexpected error when reading tree")
+	return files, executable
+}
+
+func Test_stagingListNode(t *testing.T) {
+	repo, extras := makeRepo(t)
+	node := NewRootNodeFromRepo(repo)
+	node.SetWritableRefs(true)
+	node.SetCommitAuthor("Eee Fff", "eee@fff.com")
+	// objects and references are read through the storage of the filesystem, which synchronizes them with its writes
+	repo = node.repo
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+	stagingPath := path.Join(mountPath, "staging")
+	areaPath := path.Join(stagingPath, "branch")
+	readHead := func(p string) string {
+		data, err := os.ReadFile(path.Join(p, commitFileName))
+		assert.NoError(t, err, "unexpected error when reading %v", commitFileName)
+		return strings.TrimSpace(string(data))
+	}
+
+	t.Run("mkdir", func(t *testing.T) {
+		assert.NoError(t, os.Mkdir(areaPath, 0755), "unexpected error when creating staging area")
+		assertDirEntries(t, stagingPath, []string{"branch"}, "incorrect staging areas")
+		assertDirEntries(t, areaPath, []string{commitFileName, "baz", "foo"}, "incorrect staging area contents")
+		assert.Equal(t, extras.commits["baz"].String(), readHead(areaPath), "incorrect base commit")
+		data, err := os.ReadFile(path.Join(areaPath, "foo"))
+		assert.NoError(t, err, "unexpected error when reading file")
+		assert.Equal(t, "foo", string(data), "incorrect file contents")
+	})
+	t.Run("edit", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(path.Join(areaPath, "foo"), []byte("changed"), 0644), "cannot modify file")
+		assert.NoError(t, os.Remove(path.Join(areaPath, "baz")), "cannot remove file")
+		assert.NoError(t, os.Mkdir(path.Join(areaPath, "dir"), 0755), "cannot create directory")
+		assert.NoError(t, os.Mkdir(path.Join(areaPath, "empty"), 0755), "cannot create directory")
+		assert.NoError(t, os.WriteFile(path.Join(areaPath, "dir", "new"), []byte("new"), 0644), "cannot create file")
+		assert.NoError(t, os.WriteFile(path.Join(areaPath, "run.sh"), []byte("#!/bin/sh"), 0755), "cannot create file")
+		assert.NoError(t, os.Symlink("dir/new", path.Join(areaPath, "link")), "cannot create symlink")
+		err := os.Rename(path.Join(areaPath, "run.sh"), path.Join(areaPath, "dir", "run.sh"))
+		assert.NoError(t, err, "cannot rename")
+		err = os.Remove(path.Join(areaPath, commitFileName))
+		assert.ErrorIs(t, err, syscall.EPERM, "%v should not be removable", commitFileName)
+		expected := []string{commitFileName, "dir", "empty", "foo", "link"}
+		assertDirEntries(t, areaPath, expected, "incorrect staging area contents")
+	})
+	t.Run("commit", func(t *testing.T) {
+		err := os.WriteFile(path.Join(areaPath, commitFileName), []byte("Add files\n\nDetails\n"), 0644)
+		assert.NoError(t, err, "unexpected error when committing")
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName("branch"), false)
+		if !assert.NoError(t, err, "unexpected error when getting branch") {
+			return
+		}
+		assert.Equal(t, ref.Hash().String(), readHead(areaPath), "branch should point to the new commit")
+		commit, err := repo.CommitObject(ref.Hash())
+		if !assert.NoError(t, err, "unexpected error when getting commit") {
+			return
+		}
+		assert.Equal(t, "Add files\n\nDetails\n", commit.Message, "incorrect message")
+		assert.Equal(t, "Eee Fff", commit.Author.Name, "incorrect author")
+		assert.Equal(t, []plumbing.Hash{extras.commits["baz"]}, commit.ParentHashes, "incorrect parents")
+		tree, err := commit.Tree()
+		if !assert.NoError(t, err, "unexpected error when getting tree") {
+			return
+		}
+		files, executable := treeFiles(t, tree)
+		expected := map[string]string{"foo": "changed", "dir/new": "new", "dir/run.sh": "#!/bin/sh", "link": "dir/new"}
+		assert.Equal(t, expected, files, "incorrect files in commit")
+		assert.Equal(t, []string{"dir/run.sh"}, executable, "incorrect executable files")
+	})
+	t.Run("second commit", func(t *testing.T) {
+		parent := readHead(areaPath)
+		assert.NoError(t, os.WriteFile(path.Join(areaPath, "foo"), []byte("again"), 0644), "cannot modify file")
+		err := os.WriteFile(path.Join(areaPath, commitFileName), []byte("Change foo"), 0644)
+		assert.NoError(t, err, "unexpected error when committing")
+		commit, err := repo.CommitObject(plumbing.NewHash(readHead(areaPath)))
+		if !assert.NoError(t, err, "unexpected error when getting commit") {
+			return
+		}
+		assert.Equal(t, parent, commit.ParentHashes[0].String(), "commits should be chained")
+		file, err := commit.File("dir/new")
+		assert.NoError(t, err, "unchanged files should be kept")
+		if err == nil {
+			contents, _ := file.Contents()
+			assert.Equal(t, "new", contents, "incorrect contents of unchanged file")
+		}
+	})
+	t.Run("empty message", func(t *testing.T) {
+		head := readHead(areaPath)
+		err := os.WriteFile(path.Join(areaPath, commitFileName), nil, 0644)
+		assert.NoError(t, err, "unexpected error when opening without writing")
+		assert.Equal(t, head, readHead(areaPath), "no commit should be created without a message")
+		err = os.WriteFile(path.Join(areaPath, commitFileName), []byte(" \n "), 0644)
+		assert.ErrorIs(t, err, syscall.EINVAL, "blank message should be rejected")
+	})
+	t.Run("remove and rename", func(t *testing.T) {
+		area := node.EmbeddedInode().GetChild("staging").GetChild("branch")
+		if !assert.NotNil(t, area, "staging area should be in the tree") {
+			return
+		}
+		assert.NoError(t, os.WriteFile(path.Join(areaPath, "tmp"), []byte("tmp"), 0644), "cannot create file")
+		assert.NoError(t, os.WriteFile(path.Join(areaPath, "a"), []byte("a"), 0644), "cannot create file")
+		removed := []*fs.Inode{area.GetChild("tmp"), area.GetChild("empty"), area.GetChild("a")}
+		assert.NoError(t, os.Remove(path.Join(areaPath, "tmp")), "cannot remove file")
+		assert.NoError(t, os.Remove(path.Join(areaPath, "empty")), "cannot remove directory")
+		assert.NoError(t, os.Rename(path.Join(areaPath, "foo"), path.Join(areaPath, "a")), "cannot rename")
+		errno := area.Operations().(*stagingDirNode).Unlink(context.Background(), "tmp")
+		assert.Equal(t, syscall.ENOENT, errno, "missing file should not be removable")
+		for _, inode := range removed {
+			assert.Eventually(t, inode.Forgotten, time.Second, 10*time.Millisecond, "removed node should be forgotten")
+		}
+		assertDirEntries(t, areaPath, []string{commitFileName, "a", "dir", "link"}, "incorrect staging area contents")
+
+		commitFiles := func(message string) map[string]string {
+			err := os.WriteFile(path.Join(areaPath, commitFileName), []byte(message), 0644)
+			assert.NoError(t, err, "unexpected error when committing")
+			commit, err := repo.CommitObject(plumbing.NewHash(readHead(areaPath)))
+			if !assert.NoError(t, err, "unexpected error when getting commit") {
+				return nil
+			}
+			tree, err := commit.Tree()
+			if !assert.NoError(t, err, "unexpected error when getting tree") {
+				return nil
+			}
+			files, _ := treeFiles(t, tree)
+			return files
+		}
+		expected := map[string]string{"a": "again", "dir/new": "new", "dir/run.sh": "#!/bin/sh", "link": "dir/new"}
+		assert.Equal(t, expected, commitFiles("Rename foo"), "incorrect files in commit")
+		assert.NoError(t, os.Rename(path.Join(areaPath, "a"), path.Join(areaPath, "foo")), "cannot rename")
+		expected = map[string]string{"foo": "again", "dir/new": "new", "dir/run.sh": "#!/bin/sh", "link": "dir/new"}
+		assert.Equal(t, expected, commitFiles("Rename foo back"), "incorrect files in commit")
+	})
+	t.Run("branch moved", func(t *testing.T) {
+		tmpPath := path.Join(mountPath, "branches", "branch", "tmp")
+		err := os.Symlink("+"+extras.commits["foo"].String(), tmpPath)
+		assert.NoError(t, err, "unexpected error when creating symlink")
+		err = os.Rename(tmpPath, path.Join(mountPath, "branches", "branch", "HEAD"))
+		assert.NoError(t, err, "unexpected error when moving branch")
+		err = os.WriteFile(path.Join(areaPath, commitFileName), []byte("Stale"), 0644)
+		assert.ErrorIs(t, err, syscall.ESTALE, "commit should be rejected if the branch was moved")
+	})
+	t.Run("checked out", func(t *testing.T) {
+		mainPath := path.Join(stagingPath, "main")
+		assert.NoError(t, os.Mkdir(mainPath, 0755), "unexpected error when creating staging area")
+		err := os.WriteFile(path.Join(mainPath, commitFileName), []byte("Checked out"), 0644)
+		assert.ErrorIs(t, err, syscall.EBUSY, "checked out branch should not be advanced")
+	})
+	t.Run("symlink", func(t *testing.T) {
+		p := path.Join(stagingPath, "detached")
+		err := os.Symlink("../commits/"+extras.commits["foo"].String(), p)
+		assert.NoError(t, err, "unexpected error when creating staging area")
+		assertDirEntries(t, p, []string{commitFileName, "foo"}, "incorrect staging area contents")
+		assert.NoError(t, os.WriteFile(path.Join(p, "foo"), nil, 0644), "cannot truncate file")
+		err = os.WriteFile(path.Join(p, commitFileName), []byte("Detached"), 0644)
+		assert.NoError(t, err, "unexpected error when committing")
+		commit, err := repo.CommitObject(plumbing.NewHash(readHead(p)))
+		if assert.NoError(t, err, "commit should be created") {
+			assert.Equal(t, []plumbing.Hash{extras.commits["foo"]}, commit.ParentHashes, "incorrect parents")
+		}
+		_, err = repo.Reference(plumbing.NewBranchReferenceName("detached"), false)
+		assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound, "no branch should be created")
+	})
+	t.Run("rename flags", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(path.Join(areaPath, "a"), []byte("a"), 0644), "cannot create file")
+		assert.NoError(t, os.WriteFile(path.Join(areaPath, "b"), []byte("b"), 0644), "cannot create file")
+		rename := func(from, to string, flags uint) error {
+			fromPath, toPath := path.Join(areaPath, from), path.Join(areaPath, to)
+			return unix.Renameat2(unix.AT_FDCWD, fromPath, unix.AT_FDCWD, toPath, flags)
+		}
+		err := rename("a", "b", unix.RENAME_NOREPLACE)
+		assert.ErrorIs(t, err, syscall.EEXIST, "existing file should not be replaced")
+		err = rename("a", "b", unix.RENAME_WHITEOUT)
+		assert.ErrorIs(t, err, syscall.EINVAL, "unsupported flags should be rejected")
+		assert.NoError(t, rename("a", "b", unix.RENAME_EXCHANGE), "unexpected error when exchanging files")
+		assert.Equal(t, "b", catFile(t, path.Join(areaPath, "a")), "files should be exchanged")
+		assert.Equal(t, "a", catFile(t, path.Join(areaPath, "b")), "files should be exchanged")
+		assert.NoError(t, rename("a", "c", unix.RENAME_NOREPLACE), "unexpected error when renaming")
+		assert.NoError(t, os.Remove(path.Join(areaPath, "b")), "cannot remove file")
+		assert.NoError(t, os.Remove(path.Join(areaPath, "c")), "cannot remove file")
+	})
+	t.Run("rmdir", func(t *testing.T) {
+		area := node.EmbeddedInode().GetChild("staging").GetChild("detached")
+		if !assert.NotNil(t, area, "staging area should be in the tree") {
+			return
+		}
+		file := area.GetChild("foo").Operations().(*stagingFileNode)
+		assert.NoError(t, os.Remove(path.Join(stagingPath, "detached")), "unexpected error when discarding")
+		assertDirEntries(t, stagingPath, []string{"branch", "main"}, "incorrect staging areas")
+		assert.Nil(t, node.EmbeddedInode().GetChild("staging").GetChild("detached"), "area should be removed")
+		assert.False(t, file.loaded, "buffers of discarded areas should be released")
+		assert.Nil(t, file.data, "buffers of discarded areas should be released")
+	})
+}
+
+func Test_stagingListNode_readOnly(t *testing.T) {
+	repo, _ := makeRepo(t)
+	node := NewRootNodeFromRepo(repo)
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+	err := os.Mkdir(path.Join(mountPath, "staging", "branch"), 0755)
+	assert.ErrorIs(t, err, syscall.EROFS, "staging areas should not be created by default")
+}
@@ -0,0 +1,669 @@
+package gitfs
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"gogitfs/pkg/error_handler"
+	"gogitfs/pkg/gitfs/internal/utils"
+	"gogitfs/pkg/logging"
+	"golang.org/x/sys/unix"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// stagingDirNode represents a directory in a staging area. The entries of the tree the directory was seeded from
+// are added as children on first access; afterward, the children are the source of truth. Submodules cannot be
+// edited, so they are kept in the commits, but not shown.
+type stagingDirNode struct {
+	fs.Inode
+	area *stagingArea
+	// root is true for the top directory of the staging area, which contains the COMMIT file
+	root bool
+	// treeHash is the hash of the tree the directory was seeded from, or of the last tree committed from it
+	treeHash plumbing.Hash
+	// loaded is true once the entries of the tree have been added as children
+	loaded bool
+	// hidden contains the entries of the tree which are not shown, but are kept in the commits
+	hidden map[string]object.TreeEntry
+	mtime  time.Time
+}
+
+func (n *stagingDirNode) GetCallCtx() logging.CallCtx {
+	info := utils.NodeCallCtx(n)
+	info["area"] = n.area.name
+	return info
+}
+
+// load adds the entries of the tree the directory was seeded from as children. The caller must hold the area's lock.
+func (n *stagingDirNode) load(ctx context.Context) error {
+	if n.loaded {
+		return nil
+	}
+	tree, err := n.area.repo.TreeObject(n.treeHash)
+	if err != nil {
+		return fmt.Errorf("cannot get tree object %v: %w", n.treeHash, err)
+	}
+	for _, entry := range tree.Entries {
+		var child fs.InodeEmbedder
+		var mode uint32
+		switch entry.Mode {
+		case filemode.Dir:
+			child, mode = n.area.newDir(entry.Hash), fuse.S_IFDIR
+		case filemode.Regular, filemode.Deprecated, filemode.Executable:
+			file := n.area.newFile(entry.Hash)
+			file.executable = entry.Mode == filemode.Executable
+			child, mode = file, fuse.S_IFREG
+		case filemode.Symlink:
+			target, err := readBlob(n.area.repo, entry.Hash)
+			if err != nil {
+				return err
+			}
+			child, mode = n.area.newSymlink(string(target)), fuse.S_IFLNK
+		}
+		if child == nil || (n.root && entry.Name == commitFileName) {
+			n.hidden[entry.Name] = entry
+			continue
+		}
+		n.AddChild(entry.Name, n.NewPersistentInode(ctx, child, fs.StableAttr{Mode: mode}), false)
+	}
+	n.loaded = true
+	return nil
+}
+
+// addChild adds a new child, replacing a hidden entry with the same name. The caller must hold the area's lock.
+func (n *stagingDirNode) addChild(ctx context.Context, name string, child fs.InodeEmbedder, mode uint32) *fs.Inode {
+	delete(n.hidden, name)
+	n.mtime = time.Now()
+	return n.NewPersistentInode(ctx, child, fs.StableAttr{Mode: mode})
+}
+
+// checkName returns EPERM if `name` is reserved for the COMMIT file.
+func (n *stagingDirNode) checkName(name string) syscall.Errno {
+	if n.root && name == commitFileName {
+		logging.WarningLog.Printf("%v is reserved in staging area %v", commitFileName, n.area.name)
+		return syscall.EPERM
+	}
+	return fs.OK
+}
+
+// fillAttr sets the attributes of the directory.
+func (n *stagingDirNode) fillAttr(attr *fuse.Attr) {
+	attr.SetTimes(nil, &n.mtime, &n.mtime)
+	attr.Mode = fuse.S_IFDIR | 0755
+}
+
+// Getattr returns the attributes of the directory.
+func (n *stagingDirNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	n.area.lock.Lock()
+	defer n.area.lock.Unlock()
+	n.fillAttr(&out.Attr)
+	return fs.OK
+}
+
+// Setattr accepts changes of the modification time. Other attributes are not stored.
+func (n *stagingDirNode) Setattr(
+	ctx context.Context,
+	_ fs.FileHandle,
+	in *fuse.SetAttrIn,
+	out *fuse.AttrOut,
+) syscall.Errno {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	n.area.lock.Lock()
+	defer n.area.lock.Unlock()
+	if mtime, ok := in.GetMTime(); ok {
+		n.mtime = mtime
+	}
+	n.fillAttr(&out.Attr)
+	return fs.OK
+}
+
+// Readdir lists the children, loading them first if needed.
+func (n *stagingDirNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	n.area.lock.Lock()
+	defer n.area.lock.Unlock()
+	if err := n.load(ctx); err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	var entries []fuse.DirEntry
+	for name, child := range n.Children() {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: child.Mode(), Ino: child.StableAttr().Ino})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return fs.NewListDirStream(entries), fs.OK
+}
+
+// Lookup returns the child with the given name, loading the children first if needed.
+func (n *stagingDirNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	n.area.lock.Lock()
+	err := n.load(ctx)
+	n.area.lock.Unlock()
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	child := n.GetChild(name)
+	if child == nil {
+		return nil, syscall.ENOENT
+	}
+	var attrOut fuse.AttrOut
+	errno := child.Operations().(fs.NodeGetattrer).Getattr(ctx, nil, &attrOut)
+	out.Attr = attrOut.Attr
+	return child, errno
+}
+
+// Mkdir creates an empty directory.
+func (n *stagingDirNode) Mkdir(
+	ctx context.Context,
+	name string,
+	_ uint32,
+	out *fuse.EntryOut,
+) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	if errno := n.checkName(name); errno != fs.OK {
+		return nil, errno
+	}
+	n.area.lock.Lock()
+	defer n.area.lock.Unlock()
+	dir := n.area.newDir(plumbing.ZeroHash)
+	dir.loaded = true
+	dir.mtime = time.Now()
+	dir.fillAttr(&out.Attr)
+	return n.addChild(ctx, name, dir, fuse.S_IFDIR), fs.OK
+}
+
+// Create creates an empty file. The file is executable if any of the execute bits of `mode` is set.
+func (n *stagingDirNode) Create(
+	ctx context.Context,
+	name string,
+	flags uint32,
+	mode uint32,
+	out *fuse.EntryOut,
+) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name, "flags": flags, "mode": mode})
+	defer logging.Benchmark(time.Now())
+	if errno := n.checkName(name); errno != fs.OK {
+		return nil, nil, 0, errno
+	}
+	n.area.lock.Lock()
+	defer n.area.lock.Unlock()
+	file := n.area.newFile(plumbing.ZeroHash)
+	file.loaded = true
+	file.modified = true
+	file.executable = mode&0111 != 0
+	file.mtime = time.Now()
+	_ = file.fillAttr(&out.Attr)
+	return n.addChild(ctx, name, file, fuse.S_IFREG), nil, 0, fs.OK
+}
+
+// Symlink creates a symlink.
+func (n *stagingDirNode) Symlink(
+	ctx context.Context,
+	target, name string,
+	out *fuse.EntryOut,
+) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"target": target, "name": name})
+	defer logging.Benchmark(time.Now())
+	if errno := n.checkName(name); errno != fs.OK {
+		return nil, errno
+	}
+	n.area.lock.Lock()
+	defer n.area.lock.Unlock()
+	link := n.area.newSymlink(target)
+	out.Attr = link.Attr
+	out.Mode = fuse.S_IFLNK | 0777
+	return n.addChild(ctx, name, link, fuse.S_IFLNK), fs.OK
+}
+
+// Unlink removes a file or a symlink.
+func (n *stagingDirNode) Unlink(ctx context.Context, name string) syscall.Errno {
+	logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	if errno := n.checkName(name); errno != fs.OK {
+		return errno
+	}
+	n.area.lock.Lock()
+	defer n.area.lock.Unlock()
+	child := n.GetChild(name)
+	if child == nil {
+		return syscall.ENOENT
+	}
+	releaseInode(child)
+	n.mtime = time.Now()
+	return fs.OK
+}
+
+// Rmdir removes an empty directory.
+func (n *stagingDirNode) Rmdir(ctx context.Context, name string) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	n.area.lock.Lock()
+	defer n.area.lock.Unlock()
+	child := n.GetChild(name)
+	if child == nil {
+		return syscall.ENOENT
+	}
+	if dir, ok := child.Operations().(*stagingDirNode); ok {
+		if err := dir.load(ctx); err != nil {
+			return error_handler.Fuse.HandleNodeError(ctx, n, err)
+		}
+		if len(dir.Children()) > 0 {
+			return syscall.ENOTEMPTY
+		}
+	}
+	releaseInode(child)
+	n.mtime = time.Now()
+	return fs.OK
+}
+
+// Rename moves an entry within the staging area. Non-empty directories cannot be replaced. RENAME_NOREPLACE
+// and RENAME_EXCHANGE are supported, other flags are rejected with EINVAL.
+func (n *stagingDirNode) Rename(
+	ctx context.Context,
+	name string,
+	newParent fs.InodeEmbedder,
+	newName string,
+	flags uint32,
+) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name, "newName": newName, "flags": flags})
+	defer logging.Benchmark(time.Now())
+	if flags&^(unix.RENAME_NOREPLACE|unix.RENAME_EXCHANGE) != 0 ||
+		flags&unix.RENAME_NOREPLACE != 0 && flags&unix.RENAME_EXCHANGE != 0 {
+		logging.WarningLog.Printf("Unsupported rename flags %#x in staging area %v", flags, n.area.name)
+		return syscall.EINVAL
+	}
+	dest, ok := newParent.(*stagingDirNode)
+	if !ok || dest.area != n.area {
+		return syscall.EXDEV
+	}
+	if errno := n.checkName(name); errno != fs.OK {
+		return errno
+	}
+	if errno := dest.checkName(newName); errno != fs.OK {
+		return errno
+	}
+	n.area.lock.Lock()
+	defer n.area.lock.Unlock()
+	if err := dest.load(ctx); err != nil {
+		return error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	replaced := dest.GetChild(newName)
+	if replaced != nil && flags&unix.RENAME_NOREPLACE != 0 {
+		return syscall.EEXIST
+	} else if replaced == nil && flags&unix.RENAME_EXCHANGE != 0 {
+		return syscall.ENOENT
+	}
+	if replaced != nil && flags&unix.RENAME_EXCHANGE == 0 {
+		if dir, ok := replaced.Operations().(*stagingDirNode); ok {
+			if err := dir.load(ctx); err != nil {
+				return error_handler.Fuse.HandleNodeError(ctx, n, err)
+			}
+			if len(dir.Children()) > 0 {
+				return syscall.ENOTEMPTY
+			}
+		}
+		releaseInode(replaced)
+	}
+	delete(dest.hidden, newName)
+	n.mtime = time.Now()
+	dest.mtime = n.mtime
+	return fs.OK
+}
+
+// release discards the contents of the directory: the buffers of the files are dropped and the nodes in the subtree
+// stop being persistent, so that they are removed as soon as the kernel forgets them. It is used when the staging
+// area is discarded. The caller must hold the area's lock.
+func (n *stagingDirNode) release() {
+	for _, child := range n.Children() {
+		if file, ok := child.Operations().(*stagingFileNode); ok {
+			file.data = nil
+			file.loaded = false
+			file.modified = false
+		}
+		releaseInode(child)
+	}
+}
+
+// releaseInode makes a node of a staging area, removed from its directory or discarded along with the area,
+// stop being persistent, so that it is removed as soon as the kernel forgets it. The subtree of a directory
+// is released as well. The buffers of a file are kept, since it may still be open. The caller must hold
+// the area's lock.
+func releaseInode(inode *fs.Inode) {
+	if dir, ok := inode.Operations().(*stagingDirNode); ok {
+		dir.release()
+	}
+	inode.ForgetPersistent()
+}
+
+// buildTree stores the tree object representing the directory and returns its hash. If the directory has not been
+// loaded, its tree is unchanged. Empty directories other than the root are skipped, as git cannot store them,
+// in which case plumbing.ZeroHash is returned. The caller must hold the area's lock.
+func (n *stagingDirNode) buildTree() (plumbing.Hash, error) {
+	if !n.loaded {
+		return n.treeHash, nil
+	}
+	children := n.Children()
+	var entries []object.TreeEntry
+	for name, entry := range n.hidden {
+		if _, ok := children[name]; !ok {
+			entries = append(entries, entry)
+		}
+	}
+	for name, child := range children {
+		entry := object.TreeEntry{Name: name}
+		var err error
+		switch node := child.Operations().(type) {
+		case *stagingDirNode:
+			entry.Mode = filemode.Dir
+			entry.Hash, err = node.buildTree()
+		case *stagingFileNode:
+			entry.Mode = filemode.Regular
+			if node.executable {
+				entry.Mode = filemode.Executable
+			}
+			entry.Hash, err = node.storeBlob()
+		case *fs.MemSymlink:
+			entry.Mode = filemode.Symlink
+			entry.Hash, err = n.area.storeBlob(node.Data)
+		default:
+			continue
+		}
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if entry.Hash != plumbing.ZeroHash {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 && !n.root {
+		return plumbing.ZeroHash, nil
+	}
+	// git sorts the entries as if the names of directories ended with a slash
+	sortName := func(entry object.TreeEntry) string {
+		if entry.Mode == filemode.Dir {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return sortName(entries[i]) < sortName(entries[j])
+	})
+	obj := n.area.repo.Storer.NewEncodedObject()
+	if err := (&object.Tree{Entries: entries}).Encode(obj); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("cannot encode tree: %w", err)
+	}
+	hash, err := n.area.storeObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	n.treeHash = hash
+	return hash, nil
+}
+
+// stagingFileNode represents a regular file in a staging area. The contents are read from the blob the file was
+// seeded from when the file is first read or written, and kept in memory afterward.
+type stagingFileNode struct {
+	fs.Inode
+	area *stagingArea
+	// blob is the hash of the blob the file was seeded from
+	blob plumbing.Hash
+	// loaded is true once data contains the contents of the file
+	loaded bool
+	// modified is true once the contents have been changed
+	modified bool
+	// lfs is true if the file contains a Git LFS object, which is stored as an object and a pointer when committed
+	lfs  bool
+	data []byte
+	// size is the size of the blob, or -1 if it is not known yet
+	size       int64
+	executable bool
+	mtime      time.Time
+}
+
+func (n *stagingFileNode) GetCallCtx() logging.CallCtx {
+	info := utils.NodeCallCtx(n)
+	info["area"] = n.area.name
+	info["blob"] = n.blob.String()
+	return info
+}
+
+// load reads the contents of the file from the blob, replacing a Git LFS pointer with the object, see lfsResolver.
+// The caller must hold the area's lock.
+func (n *stagingFileNode) load() error {
+	if n.loaded {
+		return nil
+	}
+	data, info, err := n.area.lfs().read(n.blob)
+	if err != nil {
+		return err
+	}
+	n.data = data
+	n.lfs = info.resolved
+	n.loaded = true
+	return nil
+}
+
+// modify loads the contents and marks the file as modified. The caller must hold the area's lock.
+func (n *stagingFileNode) modify() error {
+	if err := n.load(); err != nil {
+		return err
+	}
+	n.mtime = time.Now()
+	n.modified = true
+	return nil
+}
+
+// storeBlob stores the contents of the file as a blob, unless it has not been modified, and returns its hash.
+// If the file contains a Git LFS object, the contents are stored as an object and the blob contains the pointer.
+// The caller must hold the area's lock.
+func (n *stagingFileNode) storeBlob() (plumbing.Hash, error) {
+	if !n.modified {
+		return n.blob, nil
+	}
+	if n.lfs {
+		pointer, err := n.area.lfs().store(n.data)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		return n.area.storeBlob(pointer)
+	}
+	return n.area.storeBlob(n.data)
+}
+
+// fillAttr sets the attributes of the file. The caller must hold the area's lock.
+func (n *stagingFileNode) fillAttr(attr *fuse.Attr) error {
+	if n.loaded {
+		n.size = int64(len(n.data))
+	} else if n.size < 0 {
+		info, err := n.area.lfs().stat(n.blob)
+		if err != nil {
+			return err
+		}
+		n.size = info.size
+	}
+	attr.Size = uint64(n.size)
+	attr.SetTimes(nil, &n.mtime, &n.mtime)
+	attr.Mode = fuse.S_IFREG | 0644
+	if n.executable {
+		attr.Mode |= 0111
+	}
+	return nil
+}
+
+// Getattr returns the attributes of the file.
+func (n *stagingFileNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	n.area.lock.Lock()
+	defer n.area.lock.Unlock()
+	if err := n.fillAttr(&out.Attr); err != nil {
+		return error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	return fs.OK
+}
+
+// Setattr changes the size, the modification time or the executable bits of the file.
+func (n *stagingFileNode) Setattr(
+	ctx context.Context,
+	_ fs.FileHandle,
+	in *fuse.SetAttrIn,
+	out *fuse.AttrOut,
+) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	n.area.lock.Lock()
+	defer n.area.lock.Unlock()
+	if size, ok := in.GetSize(); ok {
+		if err := n.modify(); err != nil {
+			return error_handler.Fuse.HandleNodeError(ctx, n, err)
+		}
+		n.data = resize(n.data, int(size))
+	}
+	if mode, ok := in.GetMode(); ok {
+		n.executable = mode&0111 != 0
+	}
+	if mtime, ok := in.GetMTime(); ok {
+		n.mtime = mtime
+	}
+	if err := n.fillAttr(&out.Attr); err != nil {
+		return error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	return fs.OK
+}
+
+// resize returns `data` truncated or extended with zeros to `size` bytes.
+func resize(data []byte, size int) []byte {
+	if size <= len(data) {
+		return data[:size]
+	}
+	return append(data, make([]byte, size-len(data))...)
+}
+
+// Open opens the file. Reads and writes are handled by the node.
+func (n *stagingFileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	logging.LogCall(ctx, n, logging.CallCtx{"flags": flags})
+	defer logging.Benchmark(time.Now())
+	return nil, 0, fs.OK
+}
+
+// Read returns the requested part of the contents.
+func (n *stagingFileNode) Read(
+	ctx context.Context,
+	_ fs.FileHandle,
+	dest []byte,
+	off int64,
+) (fuse.ReadResult, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"off": off, "size": len(dest)})
+	defer logging.Benchmark(time.Now())
+	n.area.lock.Lock()
+	defer n.area.lock.Unlock()
+	if err := n.load(); err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	if off >= int64(len(n.data)) {
+		return fuse.ReadResultData(nil), fs.OK
+	}
+	// the data is copied, since it may be modified once the lock is released
+	size := copy(dest, n.data[off:])
+	return fuse.ReadResultData(dest[:size]), fs.OK
+}
+
+// Write writes `data` at the offset `off`, extending the file if needed.
+func (n *stagingFileNode) Write(ctx context.Context, _ fs.FileHandle, data []byte, off int64) (uint32, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"off": off, "size": len(data)})
+	defer logging.Benchmark(time.Now())
+	n.area.lock.Lock()
+	defer n.area.lock.Unlock()
+	if err := n.modify(); err != nil {
+		return 0, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	if end := int(off) + len(data); end > len(n.data) {
+		n.data = resize(n.data, end)
+	}
+	copy(n.data[off:], data)
+	return uint32(len(data)), fs.OK
+}
+
+// newDir creates a directory node seeded from the tree with the given hash.
+func (a *stagingArea) newDir(treeHash plumbing.Hash) *stagingDirNode {
+	return &stagingDirNode{
+		area:     a,
+		treeHash: treeHash,
+		hidden:   make(map[string]object.TreeEntry),
+		mtime:    a.base.Committer.When,
+	}
+}
+
+// newFile creates a file node seeded from the blob with the given hash.
+func (a *stagingArea) newFile(blob plumbing.Hash) *stagingFileNode {
+	return &stagingFileNode{area: a, blob: blob, size: -1, mtime: a.base.Committer.When}
+}
+
+// newSymlink creates a symlink node.
+func (a *stagingArea) newSymlink(target string) *fs.MemSymlink {
+	attr := utils.CommitAttr(a.base)
+	attr.Mode = 0777
+	return &fs.MemSymlink{Attr: attr, Data: []byte(target)}
+}
+
+// storeBlob stores `data` as a blob and returns its hash.
+func (a *stagingArea) storeBlob(data []byte) (plumbing.Hash, error) {
+	obj := a.repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(data)))
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("cannot write blob: %w", err)
+	}
+	_, err = w.Write(data)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("cannot write blob: %w", err)
+	}
+	return a.storeObject(obj)
+}
+
+// storeObject stores the object in the repository, unless it is already stored, and returns its hash.
+func (a *stagingArea) storeObject(obj plumbing.EncodedObject) (plumbing.Hash, error) {
+	hash := obj.Hash()
+	if a.repo.Storer.HasEncodedObject(hash) == nil {
+		return hash, nil
+	}
+	hash, err := a.repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("cannot store %v object: %w", obj.Type(), err)
+	}
+	return hash, nil
+}
+
+var _ fs.NodeGetattrer = (*stagingDirNode)(nil)
+var _ fs.NodeSetattrer = (*stagingDirNode)(nil)
+var _ fs.NodeReaddirer = (*stagingDirNode)(nil)
+var _ fs.NodeLookuper = (*stagingDirNode)(nil)
+var _ fs.NodeMkdirer = (*stagingDirNode)(nil)
+var _ fs.NodeCreater = (*stagingDirNode)(nil)
+var _ fs.NodeSymlinker = (*stagingDirNode)(nil)
+var _ fs.NodeUnlinker = (*stagingDirNode)(nil)
+var _ fs.NodeRmdirer = (*stagingDirNode)(nil)
+var _ fs.NodeRenamer = (*stagingDirNode)(nil)
+var _ fs.NodeGetattrer = (*stagingFileNode)(nil)
+var _ fs.NodeSetattrer = (*stagingFileNode)(nil)
+var _ fs.NodeOpener = (*stagingFileNode)(nil)
+var _ fs.NodeReader = (*stagingFileNode)(nil)
+var _ fs.NodeWriter = (*stagingFileNode)(nil)
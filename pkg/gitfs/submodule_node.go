@@ -0,0 +1,216 @@
+package gitfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"gogitfs/pkg/logging"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// submodule describes a submodule pinned in a commit.
+type submodule struct {
+	name, path, url string
+	// hash is the hash of the pinned commit
+	hash plumbing.Hash
+	// repo is the repository of the submodule, or nil if it is not available locally
+	repo *git.Repository
+}
+
+// openSubmoduleRepo opens the repository of the submodule called `name`, stored in .git/modules/<name>.
+// If the repository is not available, nil is returned.
+func openSubmoduleRepo(repo *git.Repository, name string) *git.Repository {
+	storage := filesystemStorage(repo)
+	if storage == nil {
+		return nil
+	}
+	p := path.Join("modules", name)
+	if _, err := storage.Filesystem().Stat(p); err != nil {
+		return nil
+	}
+	moduleFs, err := storage.Filesystem().Chroot(p)
+	if err != nil {
+		logging.WarningLog.Printf("Cannot access repository of submodule %v: %v", name, err)
+		return nil
+	}
+	moduleRepo, err := git.Open(filesystem.NewStorage(moduleFs, cache.NewObjectLRUDefault()), nil)
+	if err != nil {
+		logging.WarningLog.Printf("Cannot open repository of submodule %v: %v", name, err)
+		return nil
+	}
+	return moduleRepo
+}
+
+// commitSubmodules returns the submodules described by the .gitmodules file of the commit, sorted by path.
+// Submodules absent from the commit's tree are skipped.
+func commitSubmodules(repo *git.Repository, commit *object.Commit) ([]submodule, error) {
+	file, err := commit.File(".gitmodules")
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot get .gitmodules: %w", err)
+	}
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read .gitmodules: %w", err)
+	}
+	modules := config.NewModules()
+	err = modules.Unmarshal([]byte(contents))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse .gitmodules: %w", err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get tree of commit %v: %w", commit.Hash, err)
+	}
+
+	var result []submodule
+	for name, module := range modules.Submodules {
+		entry, err := tree.FindEntry(module.Path)
+		if err != nil || entry.Mode != filemode.Submodule {
+			logging.WarningLog.Printf("Submodule %v not found in commit %v", name, commit.Hash)
+			continue
+		}
+		s := submodule{
+			name: name,
+			path: path.Clean(module.Path),
+			url:  module.URL,
+			hash: entry.Hash,
+			repo: openSubmoduleRepo(repo, name),
+		}
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].path < result[j].path
+	})
+	return result, nil
+}
+
+// pinnedTree returns the tree of the pinned commit, or nil if the submodule repository or the commit
+// is not available locally.
+func (s submodule) pinnedTree() *object.Tree {
+	if s.repo == nil {
+		return nil
+	}
+	commit, err := s.repo.CommitObject(s.hash)
+	if err != nil {
+		logging.WarningLog.Printf("Cannot get commit %v of submodule %v: %v", s.hash, s.name, err)
+		return nil
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		logging.WarningLog.Printf("Cannot get tree of commit %v of submodule %v: %v", s.hash, s.name, err)
+		return nil
+	}
+	return tree
+}
+
+// submoduleDirNode represents a directory containing submodules. If the submodule repository is available locally,
+// the directory corresponding to the path of a submodule is a treeNode showing the tree of the pinned commit.
+// Otherwise, it is a submoduleDirNode containing the file `commit` with the hash of the pinned commit and `url`
+// with the URL of the submodule. Other directories contain subdirectories leading to the submodules.
+type submoduleDirNode struct {
+	fs.Inode
+	// attr is used as the attributes of all nodes
+	attr fuse.Attr
+	// submodules are the submodules located below this directory
+	submodules []submodule
+	// path is the path of the directory relative to the repository root. Empty for the root directory.
+	path string
+	// rawLFSPointers disables replacing Git LFS pointers in the trees of submodules, see RootNode.SetRawLFSPointers.
+	rawLFSPointers bool
+}
+
+// Getattr returns the attributes given on creation.
+func (n *submoduleDirNode) Getattr(_ context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Attr = n.attr
+	out.Mode = 0555
+	return fs.OK
+}
+
+// files returns the contents of the files describing the submodule located at the directory's path, if any.
+func (n *submoduleDirNode) files() map[string]string {
+	for _, s := range n.submodules {
+		if s.path == n.path {
+			return map[string]string{"commit": s.hash.String(), "url": s.url}
+		}
+	}
+	return nil
+}
+
+// subdirs returns the submodules located below the directory, grouped by the name of the subdirectory
+// containing them.
+func (n *submoduleDirNode) subdirs() map[string][]submodule {
+	result := make(map[string][]submodule)
+	for _, s := range n.submodules {
+		rest := s.path
+		if n.path != "" {
+			var found bool
+			rest, found = strings.CutPrefix(s.path, n.path+"/")
+			if !found {
+				continue
+			}
+		}
+		name, _, _ := strings.Cut(rest, "/")
+		result[name] = append(result[name], s)
+	}
+	return result
+}
+
+// Readdir returns the files describing the submodule and the subdirectories leading to other submodules.
+func (n *submoduleDirNode) Readdir(_ context.Context) (fs.DirStream, syscall.Errno) {
+	var entries []fuse.DirEntry
+	for name := range n.files() {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFREG})
+	}
+	for name := range n.subdirs() {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFDIR})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return fs.NewListDirStream(entries), fs.OK
+}
+
+// Lookup returns a file describing the submodule or a subdirectory. The directory of an available submodule
+// is a treeNode.
+func (n *submoduleDirNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	out.Attr = n.attr
+	if data, ok := n.files()[name]; ok {
+		node := &fs.MemRegularFile{Attr: n.attr, Data: []byte(data)}
+		node.Attr.Mode = 0444
+		out.Mode = fuse.S_IFREG | 0444
+		out.Size = uint64(len(data))
+		return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFREG}), fs.OK
+	}
+	if submodules, ok := n.subdirs()[name]; ok {
+		p := path.Join(n.path, name)
+		out.Mode = fuse.S_IFDIR | 0555
+		if len(submodules) == 1 && submodules[0].path == p {
+			if tree := submodules[0].pinnedTree(); tree != nil {
+				blobs := lfsResolver{repo: submodules[0].repo, raw: n.rawLFSPointers, stats: newLFSStatCache()}
+				node := &treeNode{blobs: blobs, tree: tree, attr: n.attr}
+				return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFDIR}), fs.OK
+			}
+		}
+		node := &submoduleDirNode{attr: n.attr, submodules: submodules, path: p, rawLFSPointers: n.rawLFSPointers}
+		return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFDIR}), fs.OK
+	}
+	return nil, syscall.ENOENT
+}
+
+var _ fs.NodeGetattrer = (*submoduleDirNode)(nil)
+var _ fs.NodeReaddirer = (*submoduleDirNode)(nil)
+var _ fs.NodeLookuper = (*submoduleDirNode)(nil)
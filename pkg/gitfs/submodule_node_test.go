@@ -0,0 +1,144 @@
+package gitfs
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/stretchr/testify/assert"
+	"gogitfs/pkg/logging"
+	"os"
+	"path"
+	"testing"
+)
+
+// storeObject encodes the object and saves it in the storage
+func storeObject(t *testing.T, s storer.EncodedObjectStorer, o interface {
+	Encode(plumbing.EncodedObject) error
+}) plumbing.Hash {
+	obj := s.NewEncodedObject()
+	err := o.Encode(obj)
+	if err != nil {
+		t.Fatalf("Cannot encode object: %v", err)
+	}
+	hash, err := s.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatalf("Cannot store object: %v", err)
+	}
+	return hash
+}
+
+// storeBlob saves a blob with the given contents in the storage
+func storeBlob(t *testing.T, s storer.EncodedObjectStorer, data string) plumbing.Hash {
+	obj := s.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		t.Fatalf("Cannot create blob: %v", err)
+	}
+	_, _ = w.Write([]byte(data))
+	_ = w.Close()
+	hash, err := s.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatalf("Cannot store blob: %v", err)
+	}
+	return hash
+}
+
+// storeCommit saves a commit with the given tree entries and message in the storage
+func storeCommit(t *testing.T, s storer.EncodedObjectStorer, entries []object.TreeEntry, msg string) plumbing.Hash {
+	treeHash := storeObject(t, s, &object.Tree{Entries: entries})
+	sig := commitSignatures["foo"]
+	commit := &object.Commit{Author: sig, Committer: sig, Message: msg, TreeHash: treeHash}
+	return storeObject(t, s, commit)
+}
+
+func Test_commitNode_submodules(t *testing.T) {
+	logging.Init(logging.Debug)
+	tmpdir := t.TempDir()
+	repo, err := git.PlainInit(tmpdir, false)
+	if err != nil {
+		t.Fatalf("Cannot create repository: %v", err)
+	}
+	subRepo, err := git.PlainInit(path.Join(tmpdir, ".git", "modules", "foo"), true)
+	if err != nil {
+		t.Fatalf("Cannot create submodule repository: %v", err)
+	}
+	subDirHash := storeObject(t, subRepo.Storer, &object.Tree{Entries: []object.TreeEntry{
+		{Name: "lib.go", Mode: filemode.Regular, Hash: storeBlob(t, subRepo.Storer, "package lib")},
+	}})
+	subHash := storeCommit(t, subRepo.Storer, []object.TreeEntry{
+		{Name: "README", Mode: filemode.Regular, Hash: storeBlob(t, subRepo.Storer, "readme")},
+		{Name: "build.sh", Mode: filemode.Executable, Hash: storeBlob(t, subRepo.Storer, "#!/bin/sh")},
+		{Name: "link", Mode: filemode.Symlink, Hash: storeBlob(t, subRepo.Storer, "src/lib.go")},
+		{Name: "src", Mode: filemode.Dir, Hash: subDirHash},
+	}, "submodule commit")
+	missingHash := plumbing.NewHash("0123456789abcdef0123456789abcdef01234567")
+	_, err = git.PlainInit(path.Join(tmpdir, ".git", "modules", "baz"), true)
+	if err != nil {
+		t.Fatalf("Cannot create submodule repository: %v", err)
+	}
+
+	gitmodules := `[submodule "foo"]
+	path = libs/foo
+	url = https://example.com/foo.git
+[submodule "bar"]
+	path = bar
+	url = https://example.com/bar.git
+[submodule "baz"]
+	path = baz
+	url = https://example.com/baz.git
+`
+	libsHash := storeObject(t, repo.Storer, &object.Tree{Entries: []object.TreeEntry{
+		{Name: "foo", Mode: filemode.Submodule, Hash: subHash},
+	}})
+	hash := storeCommit(t, repo.Storer, []object.TreeEntry{
+		{Name: ".gitmodules", Mode: filemode.Regular, Hash: storeBlob(t, repo.Storer, gitmodules)},
+		{Name: "bar", Mode: filemode.Submodule, Hash: missingHash},
+		{Name: "baz", Mode: filemode.Submodule, Hash: missingHash},
+		{Name: "libs", Mode: filemode.Dir, Hash: libsHash},
+	}, "main commit")
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		t.Fatalf("Error during commit retrieval: %v", err)
+	}
+
+	node := &commitNode{commit: commit}
+	node.fsContext = newFsContext(repo)
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+
+	p := path.Join(mountPath, "submodules")
+	t.Run("ls", func(t *testing.T) {
+		assertDirEntries(t, p, []string{"bar", "baz", "libs"}, "incorrect submodule directory entries")
+		assertDirEntries(t, path.Join(p, "libs"), []string{"foo"}, "incorrect submodule directory entries")
+	})
+	t.Run("available submodule", func(t *testing.T) {
+		sp := path.Join(p, "libs", "foo")
+		assertDirEntries(t, sp, []string{"README", "build.sh", "link", "src"}, "pinned tree should be shown")
+		assert.Equal(t, "readme", catFile(t, path.Join(sp, "README")), "incorrect file contents")
+		assert.Equal(t, "package lib", catFile(t, path.Join(sp, "src", "lib.go")), "incorrect file contents")
+		target, err := os.Readlink(path.Join(sp, "link"))
+		assert.NoError(t, err, "unexpected Readlink error")
+		assert.Equal(t, "src/lib.go", target, "incorrect symlink target")
+		info, err := os.Stat(path.Join(sp, "build.sh"))
+		if assert.NoError(t, err, "unexpected Stat error") {
+			assert.Equal(t, os.FileMode(0555), info.Mode(), "file should be executable")
+			assert.Equal(t, int64(len("#!/bin/sh")), info.Size(), "incorrect file size")
+		}
+	})
+	t.Run("unavailable submodule", func(t *testing.T) {
+		sp := path.Join(p, "bar")
+		assertDirEntries(t, sp, []string{"commit", "url"}, "incorrect submodule entries")
+		assert.Equal(t, missingHash.String(), catFile(t, path.Join(sp, "commit")), "incorrect pinned commit")
+		assert.Equal(t, "https://example.com/bar.git", catFile(t, path.Join(sp, "url")), "incorrect URL")
+	})
+	t.Run("pinned commit missing", func(t *testing.T) {
+		sp := path.Join(p, "baz")
+		assertDirEntries(t, sp, []string{"commit", "url"}, "incorrect submodule entries")
+		assert.Equal(t, missingHash.String(), catFile(t, path.Join(sp, "commit")), "incorrect pinned commit")
+	})
+}
@@ -0,0 +1,170 @@
+package gitfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"gogitfs/pkg/error_handler"
+	"gogitfs/pkg/gitfs/internal/utils"
+	"gogitfs/pkg/logging"
+	"syscall"
+	"time"
+)
+
+// TagValid represents expiration time for tag symlinks
+const TagValid = 30 * time.Second
+
+// tagListNode represents the list of all tags pointing to commits. Each tag is represented as a symlink named
+// after the tag and pointing to the tagged commit in the commits directory. Annotated tags are peeled.
+// Readdir and Lookup always consider the current state of the repository.
+// If references are writable (see RootNode.SetWritableRefs), a lightweight tag can be created by creating a symlink
+// to a commit, e.g. `ln -s ../commits/<hash> tags/<name>`, and deleted by removing the symlink.
+type tagListNode struct {
+	repoNode
+}
+
+func (n *tagListNode) GetCallCtx() logging.CallCtx {
+	return utils.NodeCallCtx(n)
+}
+
+// tagCommit returns the commit the tag `ref` points to. If it points to an annotated tag, the tag is peeled.
+// If the tag does not point to a commit, an error wrapping plumbing.ErrObjectNotFound is returned.
+func (n *tagListNode) tagCommit(ref *plumbing.Reference) (*object.Commit, error) {
+	var commit *object.Commit
+	tag, err := n.repo.TagObject(ref.Hash())
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		commit, err = n.repo.CommitObject(ref.Hash())
+	} else if err == nil {
+		commit, err = tag.Commit()
+	}
+	if errors.Is(err, object.ErrUnsupportedObject) {
+		return nil, fmt.Errorf("%v does not point to a commit: %w", ref.Name(), plumbing.ErrObjectNotFound)
+	}
+	return commit, err
+}
+
+// tagSymlink creates a symlink node pointing to the commit in the commits directory.
+func tagSymlink(commit *object.Commit) *fs.MemSymlink {
+	basePath := "../commits"
+	return commitSymlink(commit, &basePath)
+}
+
+// Readdir returns the contents of the directory representing all tags.
+// The result is based on the current state of the repository.
+func (n *tagListNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	iter, err := n.repo.Tags()
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get tags: %w", err))
+	}
+	var entries []fuse.DirEntry
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		_, err := n.tagCommit(ref)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			logging.DebugLog.Printf("Skipping tag %v: %v", ref.Name(), err)
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("cannot get commit of tag %v: %w", ref.Name(), err)
+		}
+		entries = append(entries, fuse.DirEntry{Name: ref.Name().Short(), Mode: fuse.S_IFLNK})
+		return nil
+	})
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	return fs.NewListDirStream(entries), fs.OK
+}
+
+// Lookup returns a symlink representing the tag with the given name.
+// The result is based on the current state of the repository.
+func (n *tagListNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	refName := plumbing.NewTagReferenceName(name)
+	ref, err := n.repo.Reference(refName, true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		logging.WarningLog.Printf("Tag %v not found", name)
+		return nil, syscall.ENOENT
+	} else if err != nil {
+		err = fmt.Errorf("cannot get tag reference %v: %w", refName, err)
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	commit, err := n.tagCommit(ref)
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		logging.WarningLog.Printf("Tag %v does not point to a commit", name)
+		return nil, syscall.ENOENT
+	} else if err != nil {
+		err = fmt.Errorf("cannot get commit of tag %v: %w", name, err)
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	link := tagSymlink(commit)
+	out.Attr = link.Attr
+	out.Mode = fuse.S_IFLNK | 0555
+	out.SetAttrTimeout(TagValid)
+	out.SetEntryTimeout(TagValid)
+	return n.NewInode(ctx, link, fs.StableAttr{Mode: fuse.S_IFLNK}), fs.OK
+}
+
+// Getattr returns attributes corresponding to the current HEAD commit.
+func (n *tagListNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	attr, err := headAttr(n)
+	if err != nil {
+		return error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get HEAD commit attributes: %w", err))
+	}
+	out.Attr = attr
+	out.Attr.Mode = 0555
+	if n.writableRefs {
+		out.Attr.Mode = 0755
+	}
+	return fs.OK
+}
+
+// Symlink creates the lightweight tag `name` pointing to the commit which `target` points to, see parseRefTarget.
+func (n *tagListNode) Symlink(
+	ctx context.Context,
+	target, name string,
+	out *fuse.EntryOut,
+) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"target": target, "name": name})
+	defer logging.Benchmark(time.Now())
+	commit, err := n.createRef(plumbing.NewTagReferenceName(name), target)
+	if err != nil {
+		return nil, handleRefError(ctx, n, err)
+	}
+	link := tagSymlink(commit)
+	out.Attr = link.Attr
+	out.Mode = fuse.S_IFLNK | 0555
+	out.SetAttrTimeout(TagValid)
+	out.SetEntryTimeout(TagValid)
+	return n.NewInode(ctx, link, fs.StableAttr{Mode: fuse.S_IFLNK}), fs.OK
+}
+
+// Unlink deletes the tag `name`.
+func (n *tagListNode) Unlink(ctx context.Context, name string) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	err := n.deleteRef(plumbing.NewTagReferenceName(name))
+	if err != nil {
+		return handleRefError(ctx, n, err)
+	}
+	return fs.OK
+}
+
+func newTagListNode(fsCtx *fsContext) *tagListNode {
+	node := &tagListNode{}
+	node.fsContext = fsCtx
+	return node
+}
+
+var _ fs.NodeLookuper = (*tagListNode)(nil)
+var _ fs.NodeReaddirer = (*tagListNode)(nil)
+var _ fs.NodeGetattrer = (*tagListNode)(nil)
+var _ fs.NodeSymlinker = (*tagListNode)(nil)
+var _ fs.NodeUnlinker = (*tagListNode)(nil)
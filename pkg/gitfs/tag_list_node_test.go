@@ -0,0 +1,91 @@
+package gitfs
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+// makeTagRepo creates a sample repository with the tags `annotated`, pointing to the commit foo, `lightweight`,
+// pointing to the commit bar, and `tree`, pointing to the tree of bar.
+func makeTagRepo(t *testing.T) (*git.Repository, repoExtras) {
+	repo, extras := makeRepo(t)
+	sig := commitSignatures["foo"]
+	_, err := repo.CreateTag("annotated", extras.commits["foo"], &git.CreateTagOptions{Tagger: &sig, Message: "foo"})
+	assert.NoError(t, err, "unexpected error when creating annotated tag")
+	_, err = repo.CreateTag("lightweight", extras.commits["bar"], nil)
+	assert.NoError(t, err, "unexpected error when creating lightweight tag")
+	commit, err := repo.CommitObject(extras.commits["bar"])
+	assert.NoError(t, err, "unexpected error when getting commit")
+	_, err = repo.CreateTag("tree", commit.TreeHash, nil)
+	assert.NoError(t, err, "unexpected error when creating tag of a tree")
+	return repo, extras
+}
+
+func Test_tagListNode(t *testing.T) {
+	repo, extras := makeTagRepo(t)
+	fsCtx := newFsContext(repo)
+	fsCtx.writableRefs = true
+	// references are read through the storage of the filesystem, which synchronizes them with its writes
+	repo = fsCtx.repo
+	node := newTagListNode(fsCtx)
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+
+	t.Run("ls", func(t *testing.T) {
+		assertDirEntries(t, mountPath, []string{"annotated", "lightweight"}, "incorrect directory entries")
+	})
+	t.Run("readlink", func(t *testing.T) {
+		for name, hash := range map[string]plumbing.Hash{
+			"annotated":   extras.commits["foo"],
+			"lightweight": extras.commits["bar"],
+		} {
+			target, err := os.Readlink(path.Join(mountPath, name))
+			assert.NoError(t, err, "unexpected Readlink error")
+			assert.Equal(t, "../commits/"+hash.String(), target, "incorrect target of tag %v", name)
+		}
+	})
+	t.Run("lookup not a commit", func(t *testing.T) {
+		_, err := os.Lstat(path.Join(mountPath, "tree"))
+		assert.ErrorIs(t, err, os.ErrNotExist, "tags of trees should not be shown")
+	})
+	t.Run("symlink", func(t *testing.T) {
+		target := "../commits/" + extras.commits["baz"].String()
+		assert.NoError(t, os.Symlink(target, path.Join(mountPath, "new")), "unexpected error when creating tag")
+		ref, err := repo.Reference(plumbing.NewTagReferenceName("new"), false)
+		assert.NoError(t, err, "tag should be created")
+		if err == nil {
+			assert.Equal(t, extras.commits["baz"], ref.Hash(), "tag should point to the commit")
+		}
+		link, err := os.Readlink(path.Join(mountPath, "new"))
+		assert.NoError(t, err, "unexpected Readlink error")
+		assert.Equal(t, target, link, "incorrect target of the new tag")
+	})
+	t.Run("remove", func(t *testing.T) {
+		assert.NoError(t, os.Remove(path.Join(mountPath, "annotated")), "unexpected error when deleting tag")
+		_, err := repo.Reference(plumbing.NewTagReferenceName("annotated"), false)
+		assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound, "tag should be deleted")
+		assertDirEntries(t, mountPath, []string{"lightweight", "new"}, "incorrect directory entries")
+	})
+}
+
+func Test_tagListNode_readOnly(t *testing.T) {
+	repo, extras := makeTagRepo(t)
+	node := newTagListNode(newFsContext(repo))
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+
+	err := os.Symlink("../commits/"+extras.commits["foo"].String(), path.Join(mountPath, "new"))
+	assert.ErrorIs(t, err, syscall.EROFS, "tags should not be created by default")
+	err = os.Remove(path.Join(mountPath, "lightweight"))
+	assert.ErrorIs(t, err, syscall.EROFS, "tags should not be deleted by default")
+	assertDirEntries(t, mountPath, []string{"annotated", "lightweight"}, "incorrect directory entries")
+}
@@ -0,0 +1,235 @@
+package gitfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"gogitfs/pkg/error_handler"
+	"gogitfs/pkg/gitfs/internal/utils"
+	"gogitfs/pkg/logging"
+	"io"
+	"syscall"
+	"time"
+)
+
+// treeNode represents a directory of a git tree stored in the repository of `blobs`, which does not have to be
+// the mounted repository. It is used to show the trees of commits pinned by submodules. Nested submodules are shown
+// as empty directories, as in a working tree where they have not been initialized.
+type treeNode struct {
+	fs.Inode
+	// blobs serves the contents of files, replacing Git LFS pointers
+	blobs lfsResolver
+	tree  *object.Tree
+	// attr is used as the attributes of all nodes
+	attr fuse.Attr
+}
+
+func (n *treeNode) GetCallCtx() logging.CallCtx {
+	info := utils.NodeCallCtx(n)
+	info["tree"] = n.tree.Hash.String()
+	return info
+}
+
+// Getattr returns the attributes given on creation.
+func (n *treeNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	out.Attr = n.attr
+	out.Mode = 0555
+	return fs.OK
+}
+
+// entryMode returns the file type corresponding to the mode of a tree entry.
+func entryMode(mode filemode.FileMode) uint32 {
+	switch mode {
+	case filemode.Dir, filemode.Submodule:
+		return fuse.S_IFDIR
+	case filemode.Symlink:
+		return fuse.S_IFLNK
+	default:
+		return fuse.S_IFREG
+	}
+}
+
+// Readdir returns the entries of the tree.
+func (n *treeNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	entries := make([]fuse.DirEntry, 0, len(n.tree.Entries))
+	for _, e := range n.tree.Entries {
+		entries = append(entries, fuse.DirEntry{Name: e.Name, Mode: entryMode(e.Mode)})
+	}
+	return fs.NewListDirStream(entries), fs.OK
+}
+
+// Lookup returns a treeNode for subdirectories, a symlink for symlinks and a blobFileNode for files.
+func (n *treeNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	entry, err := n.tree.FindEntry(name)
+	if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return nil, syscall.ENOENT
+	} else if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get tree entry %v: %w", name, err))
+	}
+
+	out.Attr = n.attr
+	switch entry.Mode {
+	case filemode.Dir:
+		tree, err := n.blobs.repo.TreeObject(entry.Hash)
+		if err != nil {
+			err = fmt.Errorf("cannot get tree %v: %w", entry.Hash, err)
+			return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+		}
+		out.Mode = fuse.S_IFDIR | 0555
+		node := &treeNode{blobs: n.blobs, tree: tree, attr: n.attr}
+		return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFDIR}), fs.OK
+	case filemode.Submodule:
+		out.Mode = fuse.S_IFDIR | 0555
+		node := &treeNode{blobs: n.blobs, tree: &object.Tree{}, attr: n.attr}
+		return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFDIR}), fs.OK
+	case filemode.Symlink:
+		target, err := readBlob(n.blobs.repo, entry.Hash)
+		if err != nil {
+			return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+		}
+		link := &fs.MemSymlink{Attr: n.attr, Data: target}
+		out.Mode = fuse.S_IFLNK | 0555
+		return n.NewInode(ctx, link, fs.StableAttr{Mode: fuse.S_IFLNK}), fs.OK
+	default:
+		node := &blobFileNode{blobs: n.blobs, blob: entry.Hash, mode: entry.Mode, attr: n.attr}
+		err = node.fillAttr(&out.Attr)
+		if err != nil {
+			return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+		}
+		return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFREG}), fs.OK
+	}
+}
+
+var _ fs.NodeGetattrer = (*treeNode)(nil)
+var _ fs.NodeReaddirer = (*treeNode)(nil)
+var _ fs.NodeLookuper = (*treeNode)(nil)
+
+// readBlob returns the contents of the blob with the given hash.
+func readBlob(repo *git.Repository, hash plumbing.Hash) ([]byte, error) {
+	blob, err := repo.BlobObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get blob %v: %w", hash, err)
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read blob %v: %w", hash, err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read blob %v: %w", hash, err)
+	}
+	return data, nil
+}
+
+// blobFileNode represents a file of a git tree, see treeNode. The contents are read when the file is opened.
+// If the blob is a Git LFS pointer, the contents of the object are served instead, if available (see lfsResolver),
+// and the file is marked by extended attributes.
+type blobFileNode struct {
+	fs.Inode
+	blobs lfsResolver
+	blob  plumbing.Hash
+	// mode is the mode of the file in the tree
+	mode filemode.FileMode
+	attr fuse.Attr
+}
+
+func (n *blobFileNode) GetCallCtx() logging.CallCtx {
+	info := utils.NodeCallCtx(n)
+	info["blob"] = n.blob.String()
+	return info
+}
+
+// fillAttr sets the attributes of the file. Executable files are marked as such. The size of resolved
+// Git LFS pointers is the size of the object.
+func (n *blobFileNode) fillAttr(attr *fuse.Attr) error {
+	info, err := n.blobs.stat(n.blob)
+	if err != nil {
+		return err
+	}
+	*attr = n.attr
+	attr.Mode = fuse.S_IFREG | 0444
+	if n.mode == filemode.Executable {
+		attr.Mode |= 0111
+	}
+	attr.Size = uint64(info.size)
+	return nil
+}
+
+// Getattr returns the attributes of the file.
+func (n *blobFileNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	err := n.fillAttr(&out.Attr)
+	if err != nil {
+		return error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	return fs.OK
+}
+
+// Open reads the contents of the file.
+func (n *blobFileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"flags": flags})
+	defer logging.Benchmark(time.Now())
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	data, _, err := n.blobs.read(n.blob)
+	if err != nil {
+		return nil, 0, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	return &bytesFileHandle{data: data}, 0, fs.OK
+}
+
+// xattrs returns extended attributes describing the file: user.git.blob, user.git.mode and, if the blob
+// is a Git LFS pointer, the attributes described in lfsBlob.addXattrs.
+func (n *blobFileNode) xattrs() (utils.Xattrs, error) {
+	xattrs := utils.Xattrs{"user.git.blob": n.blob.String(), "user.git.mode": n.mode.String()}
+	info, err := n.blobs.stat(n.blob)
+	if err != nil {
+		return nil, err
+	}
+	info.addXattrs(xattrs)
+	return xattrs, nil
+}
+
+// Getxattr returns extended attributes describing the file.
+func (n *blobFileNode) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"attr": attr})
+	defer logging.Benchmark(time.Now())
+	xattrs, err := n.xattrs()
+	if err != nil {
+		return 0, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	return xattrs.GetXattr(attr, dest)
+}
+
+// Listxattr lists extended attributes describing the file.
+func (n *blobFileNode) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	xattrs, err := n.xattrs()
+	if err != nil {
+		return 0, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	return xattrs.ListXattr(dest)
+}
+
+var _ fs.NodeGetattrer = (*blobFileNode)(nil)
+var _ fs.NodeOpener = (*blobFileNode)(nil)
+var _ fs.NodeGetxattrer = (*blobFileNode)(nil)
+var _ fs.NodeListxattrer = (*blobFileNode)(nil)
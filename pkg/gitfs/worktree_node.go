@@ -0,0 +1,254 @@
+package gitfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"gogitfs/pkg/error_handler"
+	"gogitfs/pkg/gitfs/internal/utils"
+	"gogitfs/pkg/logging"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// WorktreeValid represents expiration time for worktree nodes
+const WorktreeValid = 30 * time.Second
+
+// worktree describes a linked worktree, as created by `git worktree add`.
+type worktree struct {
+	name string
+	// path is the path of the worktree's checkout
+	path string
+	// head is the reference the worktree's HEAD points to, or nil if HEAD is detached
+	head *plumbing.Reference
+	// commit is the checked out commit
+	commit *object.Commit
+}
+
+// readWorktreeFile reads a file from the administrative directory of the worktree called `name`.
+func readWorktreeFile(storage *filesystem.Storage, name, file string) (string, error) {
+	f, err := storage.Filesystem().Open(path.Join("worktrees", name, file))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// worktreeStorage returns the filesystem storage of the repository, or nil if the repository is not stored
+// in a filesystem, and thus cannot have linked worktrees.
+func (c *fsContext) worktreeStorage() *filesystem.Storage {
+	return filesystemStorage(c.repo)
+}
+
+// worktreeNames returns the sorted names of the linked worktrees of the repository.
+func (c *fsContext) worktreeNames() ([]string, error) {
+	storage := c.worktreeStorage()
+	if storage == nil {
+		return nil, nil
+	}
+	entries, err := storage.Filesystem().ReadDir("worktrees")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read worktrees directory: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readWorktree reads the description of the linked worktree called `name`.
+// If there is no such worktree, an error wrapping os.ErrNotExist is returned.
+func (c *fsContext) readWorktree(name string) (*worktree, error) {
+	storage := c.worktreeStorage()
+	if storage == nil {
+		return nil, os.ErrNotExist
+	}
+	headData, err := readWorktreeFile(storage, name, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read HEAD of worktree %v: %w", name, err)
+	}
+	gitdir, err := readWorktreeFile(storage, name, "gitdir")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read gitdir of worktree %v: %w", name, err)
+	}
+
+	wt := &worktree{name: name, path: filepath.Dir(gitdir)}
+	hash := plumbing.NewHash(headData)
+	if target, ok := strings.CutPrefix(headData, "ref: "); ok {
+		ref, err := c.repo.Reference(plumbing.ReferenceName(target), true)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve HEAD of worktree %v: %w", name, err)
+		}
+		wt.head = ref
+		hash = ref.Hash()
+	}
+	wt.commit, err = c.repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get HEAD commit of worktree %v: %w", name, err)
+	}
+	return wt, nil
+}
+
+// worktreeListNode represents the list of linked worktrees of the repository. Each worktree is represented
+// as a directory named after the worktree. Readdir and Lookup always consider the current state of the repository.
+type worktreeListNode struct {
+	repoNode
+}
+
+func (n *worktreeListNode) GetCallCtx() logging.CallCtx {
+	return utils.NodeCallCtx(n)
+}
+
+// Readdir lists the linked worktrees.
+func (n *worktreeListNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	names, err := n.worktreeNames()
+	if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	entries := make([]fuse.DirEntry, len(names))
+	for i, name := range names {
+		entries[i] = fuse.DirEntry{Name: name, Mode: fuse.S_IFDIR}
+	}
+	return fs.NewListDirStream(entries), fs.OK
+}
+
+// Lookup returns a node representing the linked worktree with the given name.
+func (n *worktreeListNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	wt, err := n.readWorktree(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, syscall.ENOENT
+	} else if err != nil {
+		return nil, error_handler.Fuse.HandleNodeError(ctx, n, err)
+	}
+	node := &worktreeNode{worktree: wt}
+	node.fsContext = n.fsContext
+	out.SetAttrTimeout(WorktreeValid)
+	out.SetEntryTimeout(WorktreeValid)
+	out.Attr = utils.CommitAttr(wt.commit)
+	out.Mode = fuse.S_IFDIR | 0555
+	return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFDIR}), fs.OK
+}
+
+// Getattr returns attributes corresponding to the current HEAD commit.
+func (n *worktreeListNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ctx = logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	attr, err := headAttr(n)
+	if err != nil {
+		return error_handler.Fuse.HandleNodeError(ctx, n, fmt.Errorf("cannot get HEAD commit attributes: %w", err))
+	}
+	out.Attr = attr
+	out.Attr.Mode = 0555
+	return fs.OK
+}
+
+func newWorktreeListNode(fsCtx *fsContext) *worktreeListNode {
+	node := &worktreeListNode{}
+	node.fsContext = fsCtx
+	return node
+}
+
+// worktreeNode represents a single linked worktree. It contains the symlink `HEAD`, pointing to the checked out
+// commit, the symlink `branch`, pointing to the checked out branch (unless HEAD is detached),
+// and the text file `path`, containing the path of the worktree's checkout.
+type worktreeNode struct {
+	repoNode
+	worktree *worktree
+}
+
+func (n *worktreeNode) GetCallCtx() logging.CallCtx {
+	info := utils.NodeCallCtx(n)
+	info["name"] = n.worktree.name
+	return info
+}
+
+// Getattr returns attributes corresponding to the checked out commit.
+func (n *worktreeNode) Getattr(ctx context.Context, _ fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	out.Attr = utils.CommitAttr(n.worktree.commit)
+	out.Mode = 0555
+	return fs.OK
+}
+
+// Readdir returns the children of the node. The symlink `branch` is only listed if HEAD is not detached.
+func (n *worktreeNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	logging.LogCall(ctx, n, nil)
+	defer logging.Benchmark(time.Now())
+	entries := []fuse.DirEntry{
+		{Name: "HEAD", Mode: fuse.S_IFLNK},
+		{Name: "path", Mode: fuse.S_IFREG},
+	}
+	if n.worktree.head != nil && n.worktree.head.Name().IsBranch() {
+		entries = append(entries, fuse.DirEntry{Name: "branch", Mode: fuse.S_IFLNK})
+	}
+	return fs.NewListDirStream(entries), fs.OK
+}
+
+// Lookup creates the child node with the given name.
+func (n *worktreeNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	ctx = logging.LogCall(ctx, n, logging.CallCtx{"name": name})
+	defer logging.Benchmark(time.Now())
+	attr := utils.CommitAttr(n.worktree.commit)
+	var node fs.InodeEmbedder
+	var mode uint32 = fuse.S_IFLNK
+	switch name {
+	case "HEAD":
+		attr.Mode = 0555
+		target := fmt.Sprintf("../../commits/%v", n.worktree.commit.Hash)
+		node = &fs.MemSymlink{Attr: attr, Data: []byte(target)}
+	case "branch":
+		if n.worktree.head == nil || !n.worktree.head.Name().IsBranch() {
+			return nil, syscall.ENOENT
+		}
+		attr.Mode = 0555
+		target := fmt.Sprintf("../../branches/%v", n.worktree.head.Name().Short())
+		node = &fs.MemSymlink{Attr: attr, Data: []byte(target)}
+	case "path":
+		attr.Mode = 0444
+		node, mode = &fs.MemRegularFile{Attr: attr, Data: []byte(n.worktree.path + "\n")}, fuse.S_IFREG
+	default:
+		return nil, syscall.ENOENT
+	}
+
+	child := n.NewInode(ctx, node, fs.StableAttr{Mode: mode})
+	var attrOut fuse.AttrOut
+	errno := node.(fs.NodeGetattrer).Getattr(ctx, nil, &attrOut)
+	out.Attr = attrOut.Attr
+	return child, errno
+}
+
+var _ fs.NodeLookuper = (*worktreeListNode)(nil)
+var _ fs.NodeReaddirer = (*worktreeListNode)(nil)
+var _ fs.NodeGetattrer = (*worktreeListNode)(nil)
+var _ fs.NodeLookuper = (*worktreeNode)(nil)
+var _ fs.NodeReaddirer = (*worktreeNode)(nil)
+var _ fs.NodeGetattrer = (*worktreeNode)(nil)
@@ -0,0 +1,147 @@
+package gitfs
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"gogitfs/pkg/logging"
+	"os"
+	"path"
+	"testing"
+)
+
+// writeFile writes a file, creating its parent directories.
+func writeFile(t *testing.T, p string, data string) {
+	err := os.MkdirAll(path.Dir(p), 0755)
+	if err != nil {
+		t.Fatalf("Error during directory creation: %v", err)
+	}
+	err = os.WriteFile(p, []byte(data), 0644)
+	if err != nil {
+		t.Fatalf("Error during file creation: %v", err)
+	}
+}
+
+// addWorktree creates a linked worktree called `name` in the repository located at repoPath,
+// with the same layout as `git worktree add`. The checkout itself is left empty. Returns the path of the worktree.
+func addWorktree(t *testing.T, repoPath, name, head string) string {
+	wtPath := path.Join(t.TempDir(), name)
+	adminPath := path.Join(repoPath, ".git", "worktrees", name)
+	writeFile(t, path.Join(adminPath, "HEAD"), head+"\n")
+	writeFile(t, path.Join(adminPath, "commondir"), "../..\n")
+	writeFile(t, path.Join(adminPath, "gitdir"), path.Join(wtPath, ".git")+"\n")
+	writeFile(t, path.Join(wtPath, ".git"), "gitdir: "+adminPath+"\n")
+	return wtPath
+}
+
+// makeDiskRepo creates a sample repository stored on disk, with the commits foo and bar on the main branch
+// and the branch `feature` pointing to foo. Returns the repository and its path.
+func makeDiskRepo(t *testing.T) (*git.Repository, string, map[string]plumbing.Hash) {
+	logging.Init(logging.Debug)
+	repoPath := t.TempDir()
+	initOpts := &git.PlainInitOptions{InitOptions: git.InitOptions{DefaultBranch: plumbing.Main}}
+	repo, err := git.PlainInitWithOptions(repoPath, initOpts)
+	if err != nil {
+		t.Fatalf("Error during repository creation: %v", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Error during repository creation: %v", err)
+	}
+	commits := make(map[string]plumbing.Hash)
+	commits["foo"] = addCommit(t, worktree, worktree.Filesystem, "foo")
+	commits["bar"] = addCommit(t, worktree, worktree.Filesystem, "bar")
+	ref := plumbing.NewHashReference(plumbing.NewBranchReferenceName("feature"), commits["foo"])
+	err = repo.Storer.SetReference(ref)
+	if err != nil {
+		t.Fatalf("Error during branch creation: %v", err)
+	}
+	return repo, repoPath, commits
+}
+
+func Test_worktreeListNode(t *testing.T) {
+	repo, repoPath, commits := makeDiskRepo(t)
+	wtPath := addWorktree(t, repoPath, "wt", "ref: refs/heads/feature")
+	detachedPath := addWorktree(t, repoPath, "detached", commits["bar"].String())
+	node := newWorktreeListNode(newFsContext(repo))
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+
+	assertDirEntries(t, mountPath, []string{"detached", "wt"}, "incorrect worktree list")
+	testCases := []struct {
+		name    string
+		path    string
+		commit  plumbing.Hash
+		entries []string
+		branch  string
+	}{
+		{"wt", wtPath, commits["foo"], []string{"HEAD", "branch", "path"}, "feature"},
+		{"detached", detachedPath, commits["bar"], []string{"HEAD", "path"}, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := path.Join(mountPath, tc.name)
+			assertDirEntries(t, p, tc.entries, "incorrect worktree directory entries")
+			target, err := os.Readlink(path.Join(p, "HEAD"))
+			assert.NoError(t, err, "unexpected Readlink error")
+			assert.Equal(t, "../../commits/"+tc.commit.String(), target, "incorrect HEAD symlink")
+			data, err := os.ReadFile(path.Join(p, "path"))
+			assert.NoError(t, err, "unexpected error when reading path")
+			assert.Equal(t, tc.path+"\n", string(data), "incorrect worktree path")
+			target, err = os.Readlink(path.Join(p, "branch"))
+			if tc.branch != "" {
+				assert.NoError(t, err, "unexpected Readlink error")
+				assert.Equal(t, "../../branches/"+tc.branch, target, "incorrect branch symlink")
+			} else {
+				assert.ErrorIs(t, err, os.ErrNotExist, "detached worktree should not have a branch")
+			}
+		})
+	}
+	t.Run("missing", func(t *testing.T) {
+		_, err := os.Stat(path.Join(mountPath, "missing"))
+		assert.ErrorIs(t, err, os.ErrNotExist, "worktree should not exist")
+	})
+}
+
+func Test_worktreeListNode_memory(t *testing.T) {
+	repo, _ := makeRepo(t)
+	node := newWorktreeListNode(newFsContext(repo))
+	server, mountPath := mountNode(t, node, noOpCb)
+	defer func() {
+		_ = server.Unmount()
+	}()
+	assertDirEntries(t, mountPath, nil, "repository in memory should have no worktrees")
+}
+
+func Test_NewRootNode_layouts(t *testing.T) {
+	_, repoPath, commits := makeDiskRepo(t)
+	wtPath := addWorktree(t, repoPath, "wt", "ref: refs/heads/feature")
+	barePath := t.TempDir()
+	_, err := git.PlainClone(barePath, true, &git.CloneOptions{URL: repoPath})
+	if err != nil {
+		t.Fatalf("Error during cloning: %v", err)
+	}
+
+	testCases := []struct {
+		name string
+		path string
+		head plumbing.Hash
+	}{
+		{"main", repoPath, commits["bar"]},
+		{"worktree", wtPath, commits["foo"]},
+		{"bare", barePath, commits["bar"]},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			node, err := NewRootNode(tc.path)
+			if !assert.NoError(t, err, "unexpected error when opening repository") {
+				return
+			}
+			commit, err := headCommit(node)
+			assert.NoError(t, err, "unexpected error when reading HEAD")
+			assert.Equal(t, tc.head, commit.Hash, "incorrect HEAD commit")
+		})
+	}
+}
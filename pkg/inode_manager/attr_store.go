@@ -1,7 +1,9 @@
 package inode_manager
 
 import (
+	"encoding/binary"
 	"github.com/hanwen/go-fuse/v2/fs"
+	"hash/fnv"
 	"sync"
 )
 
@@ -17,11 +19,15 @@ func (e *attrEntry) toStableAttr() fs.StableAttr {
 }
 
 // AttrStore stores and generates inode and generation numbers for each key.
-// Each new key gets the next available number.
+// Each new key gets the next available number, or a number derived from the key if initialized with InitHashed.
 type AttrStore struct {
 	lock    *sync.Mutex
 	nextIno uint64
 	attrs   map[string]*attrEntry
+	// hashBits is the number of bits of inode numbers derived from keys. If 0, numbers are assigned sequentially.
+	hashBits uint
+	// used maps the assigned inode numbers to keys - only used if hashBits > 0
+	used map[uint64]string
 }
 
 // Init performs initialization. initialIno specifies the number that wil lbe received by the first added key.
@@ -31,8 +37,54 @@ func (s *AttrStore) Init(initialIno uint64) {
 	s.attrs = make(map[string]*attrEntry)
 }
 
+// InitHashed performs initialization, so that inode numbers are derived from the hashes of the keys.
+// This way, a key gets the same number every time, independently of the order in which keys are added.
+// The numbers are in range [baseIno, baseIno + 2^hashBits). If two keys collide, the key added later is rehashed
+// with a salt (see keyOffset), so its number is still derived from the key rather than from the insertion order.
+// Only the choice of which of the colliding keys keeps the unsalted number depends on the order, so the numbers
+// of colliding keys may still change across remounts.
+func (s *AttrStore) InitHashed(baseIno uint64, hashBits uint) {
+	s.Init(baseIno)
+	s.hashBits = hashBits
+	s.used = make(map[uint64]string)
+}
+
+// maxRehashes is the number of salted hashes tried for a colliding key before falling back to linear probing,
+// which guarantees that a free number is found while there is any.
+const maxRehashes = 16
+
+// keyOffset returns the offset of the inode number derived from the key, hashed together with the salt
+// if it is not 0.
+func (s *AttrStore) keyOffset(key string, salt uint64) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	if salt > 0 {
+		_ = binary.Write(h, binary.LittleEndian, salt)
+	}
+	return h.Sum64() & (uint64(1)<<s.hashBits - 1)
+}
+
+// hashedIno returns the inode number derived from the key, see InitHashed.
+func (s *AttrStore) hashedIno(key string) uint64 {
+	mask := uint64(1)<<s.hashBits - 1
+	offset := s.keyOffset(key, 0)
+	for salt := uint64(1); ; salt++ {
+		ino := s.nextIno + offset
+		if _, ok := s.used[ino]; !ok {
+			s.used[ino] = key
+			return ino
+		}
+		if salt <= maxRehashes {
+			offset = s.keyOffset(key, salt)
+		} else {
+			offset = (offset + 1) & mask
+		}
+	}
+}
+
 // GetOrInsert for a given key returns fs.StableAttr containing inode and generation number for the given key.
-// If the key was absent, it returns the next available inode number and generation number equal to 0.
+// If the key was absent, it returns the next available inode number (or the number derived from the key)
+// and generation number equal to 0.
 // Subsequent calls will return the same inode number and the same generation number if updateGen == false.
 // If updateGen == tre, the returned generation number will be increased.
 func (s *AttrStore) GetOrInsert(key string, updateGen bool) fs.StableAttr {
@@ -43,6 +95,9 @@ func (s *AttrStore) GetOrInsert(key string, updateGen bool) fs.StableAttr {
 		if updateGen {
 			attr.gen += 1
 		}
+	} else if s.hashBits > 0 {
+		attr = &attrEntry{ino: s.hashedIno(key), gen: 0}
+		s.attrs[key] = attr
 	} else {
 		attr = &attrEntry{ino: s.nextIno, gen: 0}
 		s.nextIno += 1
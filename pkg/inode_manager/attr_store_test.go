@@ -1,6 +1,7 @@
 package inode_manager
 
 import (
+	"fmt"
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -53,3 +54,54 @@ func TestAttrStore_GetOrInsert(t *testing.T) {
 		})
 	}
 }
+
+func TestAttrStore_GetOrInsert_hashed(t *testing.T) {
+	newStore := func(hashBits uint) *AttrStore {
+		store := &AttrStore{}
+		store.InitHashed(1<<32, hashBits)
+		return store
+	}
+
+	t.Run("stable", func(t *testing.T) {
+		keys := []string{"a", "b", "c"}
+		first := newStore(16)
+		second := newStore(16)
+		expected := make(map[string]fs.StableAttr)
+		for _, key := range keys {
+			expected[key] = first.GetOrInsert(key, false)
+		}
+		for i := len(keys) - 1; i >= 0; i-- {
+			result := second.GetOrInsert(keys[i], false)
+			assert.Equal(t, expected[keys[i]], result, "inode number should not depend on insertion order")
+			assert.GreaterOrEqual(t, result.Ino, uint64(1<<32), "inode number out of range")
+			assert.Less(t, result.Ino, uint64(1<<32+1<<16), "inode number out of range")
+		}
+		assert.Equal(t, expected["a"], first.GetOrInsert("a", false), "repeated key should get the same number")
+	})
+
+	t.Run("collision", func(t *testing.T) {
+		store := newStore(1)
+		a := store.GetOrInsert("a", false)
+		b := store.GetOrInsert("b", false)
+		assert.NotEqual(t, a.Ino, b.Ino, "colliding keys should get different numbers")
+		assert.ElementsMatch(t, []uint64{1 << 32, 1<<32 + 1}, []uint64{a.Ino, b.Ino}, "inode numbers out of range")
+	})
+
+	t.Run("rehash", func(t *testing.T) {
+		store := newStore(8)
+		// find a key colliding with "a"
+		key := ""
+		for i := 0; key == ""; i++ {
+			if candidate := fmt.Sprint(i); store.keyOffset(candidate, 0) == store.keyOffset("a", 0) {
+				key = candidate
+			}
+		}
+		other := newStore(8)
+		other.GetOrInsert("b", false)
+		other.GetOrInsert("a", false)
+		store.GetOrInsert("a", false)
+		expected := uint64(1<<32) + store.keyOffset(key, 1)
+		assert.Equal(t, expected, store.GetOrInsert(key, false).Ino, "colliding key should be rehashed")
+		assert.Equal(t, expected, other.GetOrInsert(key, false).Ino, "number should not depend on other keys")
+	})
+}
@@ -23,6 +23,13 @@ func (m *InodeCache) Init(initialIno uint64) {
 	m.InodeStore.Init()
 }
 
+// InitHashed performs initialization, so that inode numbers are derived from the keys.
+// The parameters are passed to AttrStore.InitHashed.
+func (m *InodeCache) InitHashed(baseIno uint64, hashBits uint) {
+	m.Init(baseIno)
+	m.AttrStore.InitHashed(baseIno, hashBits)
+}
+
 // GetOrInsert returns the Inode corresponding to the given key. If the key is absent or overwrite == true,
 // a new node will be created with Attr generated from AttrStore and the specified file mode.
 // Other parameters are simply passed to InodeStore.GetOrInsert.
@@ -43,3 +50,11 @@ func (m *InodeCache) GetOrInsert(
 	node, err := m.InodeStore.GetOrInsert(ctx, key, attr, parent, builder, overwrite)
 	return node, err
 }
+
+// Clear removes all nodes from the cache, see InodeStore.Clear. The attributes are kept, so recreated nodes
+// get the same inode numbers.
+func (m *InodeCache) Clear() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.InodeStore.Clear()
+}
@@ -70,3 +70,23 @@ func TestInodeCache_GetOrInsert(t *testing.T) {
 		}
 	})
 }
+
+func TestInodeCache_Clear(t *testing.T) {
+	testWithMount(t, func(t *testing.T, ctx context.Context, root *fs.Inode) {
+		cache := InodeCache{}
+		cache.Init(16)
+		var built int
+		builder := func() (fs.InodeEmbedder, error) {
+			built++
+			return &fs.Inode{}, nil
+		}
+		_, err := cache.GetOrInsert(ctx, "a", fuse.S_IFREG, root, builder, false)
+		assert.NoError(t, err, "unexpected error on running GetOrInsert")
+		cache.Clear()
+		assert.Equal(t, 0, cache.InodeStore.Len(), "store should be empty")
+		result, err := cache.GetOrInsert(ctx, "a", fuse.S_IFREG, root, builder, false)
+		assert.NoError(t, err, "unexpected error on running GetOrInsert")
+		assert.Equal(t, 2, built, "node should be rebuilt after clearing")
+		assert.Equal(t, uint64(16), result.StableAttr().Ino, "inode number should be kept")
+	})
+}
@@ -1,29 +1,108 @@
 package inode_manager
 
 import (
+	"container/list"
 	"context"
 	"fmt"
 	"github.com/hanwen/go-fuse/v2/fs"
+	"gogitfs/pkg/metrics"
 	"sync"
 )
 
-// InodeStore stores a unique Inode per key.
+// cacheRequests counts the calls of InodeStore.GetOrInsert which returned an existing node (hits)
+// and which created a new one (misses).
+var cacheRequests = metrics.Default.NewCounterVec(
+	"gogitfs_inode_cache_requests_total",
+	"Lookups in inode caches, by result (hit or miss).",
+	"result",
+)
+
+// cacheEvictions counts the nodes removed from inode stores because their limit was exceeded.
+var cacheEvictions = metrics.Default.NewCounterVec(
+	"gogitfs_inode_cache_evictions_total",
+	"Nodes evicted from inode caches because of their size limit.",
+)
+
+// forgetNotifier is implemented by nodes embedding ForgetHook.
+type forgetNotifier interface {
+	setOnForget(cb func())
+}
+
+// ForgetHook implements fs.NodeOnForgetter. Nodes embedding it are removed from InodeStore when the kernel
+// forgets them. Note that this requires the node to have no persistent children - otherwise it is never forgotten.
+type ForgetHook struct {
+	lock     sync.Mutex
+	onForget func()
+}
+
+func (h *ForgetHook) setOnForget(cb func()) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.onForget = cb
+}
+
+// OnForget calls the callback registered by InodeStore, if any.
+func (h *ForgetHook) OnForget() {
+	h.lock.Lock()
+	cb := h.onForget
+	h.lock.Unlock()
+	if cb != nil {
+		cb()
+	}
+}
+
+var _ fs.NodeOnForgetter = (*ForgetHook)(nil)
+
+// storedInode is an entry of InodeStore.
+type storedInode struct {
+	key   string
+	inode *fs.Inode
+}
+
+// InodeStore stores a unique Inode per key. If a limit is set (see SetLimit), the least recently used nodes are
+// removed from the store once the limit is exceeded.
 type InodeStore struct {
 	lock   *sync.Mutex
-	inodes map[string]*fs.Inode
+	inodes map[string]*list.Element
+	// recent contains storedInode entries, ordered from the most recently used
+	recent *list.List
+	// limit is the maximum number of stored nodes, or 0 if unlimited
+	limit int
 }
 
 func (s *InodeStore) Init() {
-	s.inodes = make(map[string]*fs.Inode)
+	s.inodes = make(map[string]*list.Element)
+	s.recent = list.New()
 	s.lock = &sync.Mutex{}
 }
 
+// SetLimit sets the maximum number of stored nodes, 0 meaning no limit. Evicted nodes remain valid as long as
+// the kernel references them, as in Clear.
+func (s *InodeStore) SetLimit(limit int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.limit = limit
+	s.evict()
+}
+
+// evict removes the least recently used nodes until the limit is satisfied. s.lock must be held.
+func (s *InodeStore) evict() {
+	for s.limit > 0 && s.recent.Len() > s.limit {
+		oldest := s.recent.Back()
+		s.recent.Remove(oldest)
+		delete(s.inodes, oldest.Value.(storedInode).key)
+		cacheEvictions.Inc()
+	}
+}
+
 // GetOrInsert returns the Inode corresponding to the given key, or creates one if it doesn't exist.
 // Subsequent calls will return the same node, unless called with overwrite == true.
 // When the key is absent or overwrite == true, new node will be created by calling builder()
-// and then calling NewPersistentInode on parent passing attr and the result.
+// and then calling NewInode on parent passing attr and the result.
 // builder() will not be called if key is present and overwrite == false. Use overwrite to force creation
 // of a new node.
+// If the built node embeds ForgetHook, it is removed from the store once the kernel forgets it, so that the store
+// does not grow indefinitely. Otherwise, the node is kept until it is overwritten or evicted, see SetLimit.
 func (s *InodeStore) GetOrInsert(
 	ctx context.Context,
 	key string,
@@ -34,15 +113,53 @@ func (s *InodeStore) GetOrInsert(
 ) (*fs.Inode, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
-	inode, ok := s.inodes[key]
+	elem, ok := s.inodes[key]
 	if ok && !overwrite {
-		return inode, nil
+		cacheRequests.Inc("hit")
+		s.recent.MoveToFront(elem)
+		return elem.Value.(storedInode).inode, nil
 	}
+	cacheRequests.Inc("miss")
 	newEmb, err := builder()
 	if err != nil {
 		return nil, fmt.Errorf("cannot build an INode: %w", err)
 	}
-	newNode := parent.EmbeddedInode().NewPersistentInode(ctx, newEmb, attr)
-	s.inodes[key] = newNode
+	newNode := parent.EmbeddedInode().NewInode(ctx, newEmb, attr)
+	if notifier, ok := newEmb.(forgetNotifier); ok {
+		notifier.setOnForget(func() {
+			s.remove(key, newNode)
+		})
+	}
+	if ok {
+		s.recent.Remove(elem)
+	}
+	s.inodes[key] = s.recent.PushFront(storedInode{key: key, inode: newNode})
+	s.evict()
 	return newNode, nil
 }
+
+// remove removes the key from the store, provided that it still corresponds to `inode`.
+func (s *InodeStore) remove(key string, inode *fs.Inode) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if elem, ok := s.inodes[key]; ok && elem.Value.(storedInode).inode == inode {
+		s.recent.Remove(elem)
+		delete(s.inodes, key)
+	}
+}
+
+// Len returns the number of stored nodes.
+func (s *InodeStore) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.inodes)
+}
+
+// Clear removes all nodes from the store. Subsequent calls of GetOrInsert create new nodes.
+// The removed nodes remain valid as long as the kernel references them.
+func (s *InodeStore) Clear() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.inodes = make(map[string]*list.Element)
+	s.recent.Init()
+}
@@ -8,6 +8,12 @@ import (
 	"testing"
 )
 
+// forgettableNode is a node which is removed from InodeStore once forgotten.
+type forgettableNode struct {
+	fs.Inode
+	ForgetHook
+}
+
 func TestInodeStore_GetOrInsert(t *testing.T) {
 	testWithMount(t, func(t *testing.T, ctx context.Context, root *fs.Inode) {
 		store := &InodeStore{}
@@ -55,6 +61,47 @@ func TestInodeStore_GetOrInsert(t *testing.T) {
 				assert.Equal(t, tc.shouldCreate, didCreate, "unexpected node creation or reuse")
 			})
 		}
+		t.Run("forget", func(t *testing.T) {
+			builder := func() (fs.InodeEmbedder, error) {
+				return &forgettableNode{}, nil
+			}
+			first, err := store.GetOrInsert(ctx, "c", fs.StableAttr{}, root, builder, false)
+			assert.NoError(t, err, "unexpected error on running GetOrInsert")
+			second, err := store.GetOrInsert(ctx, "c", fs.StableAttr{}, root, builder, true)
+			assert.NoError(t, err, "unexpected error on running GetOrInsert")
+			size := store.Len()
+
+			first.Operations().(*forgettableNode).OnForget()
+			assert.Equal(t, size, store.Len(), "an overwritten node should not remove its replacement")
+			second.Operations().(*forgettableNode).OnForget()
+			assert.Equal(t, size-1, store.Len(), "a forgotten node should be removed")
+
+			third, err := store.GetOrInsert(ctx, "c", fs.StableAttr{}, root, builder, false)
+			assert.NoError(t, err, "unexpected error on running GetOrInsert")
+			assert.NotSame(t, second, third, "a forgotten node should be recreated")
+		})
+		t.Run("limit", func(t *testing.T) {
+			store.Clear()
+			store.SetLimit(2)
+			defer store.SetLimit(0)
+			builder := func() (fs.InodeEmbedder, error) {
+				return &fs.Inode{}, nil
+			}
+			get := func(key string) *fs.Inode {
+				inode, err := store.GetOrInsert(ctx, key, fs.StableAttr{}, root, builder, false)
+				assert.NoError(t, err, "unexpected error on running GetOrInsert")
+				return inode
+			}
+			first := get("d")
+			get("e")
+			assert.Same(t, first, get("d"), "a node within the limit should be kept")
+			get("f")
+			assert.Equal(t, 2, store.Len(), "the store should not exceed the limit")
+			assert.Same(t, first, get("d"), "a recently used node should be kept")
+			store.SetLimit(1)
+			assert.Equal(t, 1, store.Len(), "lowering the limit should evict nodes")
+			assert.Same(t, first, get("d"), "the most recently used node should be kept")
+		})
 		t.Run("error", func(t *testing.T) {
 			expectedErr := errors.New("foo")
 			builder := func() (fs.InodeEmbedder, error) {
@@ -1,10 +1,14 @@
 package logging
 
 import (
+	"context"
 	"fmt"
+	"gogitfs/pkg/metrics"
+	"io"
 	"runtime"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -122,24 +126,115 @@ func (n NilCtx) GetCallCtx() CallCtx {
 	return nil
 }
 
-// LogCall logs information about the function call.
-// The format is Called <method> (<key>=<value>), with key, value as specified by extra and GetCallCtx()
-func LogCall(l CallCtxGetter, extra CallCtx) {
-	methodName := CurrentFuncName(1, Class)
+// requestIDKey is the context key of the request ID, see LogCall.
+type requestIDKey struct{}
+
+// lastRequestID is the last assigned request ID.
+var lastRequestID atomic.Uint64
+
+// RequestID returns the ID of the request assigned by LogCall, or false if ctx has no request ID.
+func RequestID(ctx context.Context) (uint64, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	id, ok := ctx.Value(requestIDKey{}).(uint64)
+	return id, ok
+}
+
+// TypeName returns the name of the value's type, without the package and the pointer, e.g. "commitNode".
+func TypeName(v any) string {
+	name := fmt.Sprintf("%T", v)
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// callInfo collects the information about a call: the node type, the request ID, the fields returned
+// by GetCallCtx() and the extra fields.
+func callInfo(ctx context.Context, l CallCtxGetter, extra CallCtx) CallCtx {
 	var info CallCtx
 	if l != nil {
 		info = l.GetCallCtx()
 	}
 	info = concatCtx(info, extra)
-	methodInfo := formatCtx(info)
-	DebugLog.Printf("Called %v (%v)", methodName, methodInfo)
+	if info == nil {
+		info = make(CallCtx)
+	}
+	if _, isNil := l.(NilCtx); l != nil && !isNil {
+		info["node"] = TypeName(l)
+	}
+	if id, ok := RequestID(ctx); ok {
+		info["request"] = id
+	}
+	return info
+}
+
+// LogCall logs information about the function call.
+// The format is Called <method> (<key>=<value>), with key, value as specified by extra and GetCallCtx(),
+// as well as the node type and the request ID. In the JSON format, a record with the same information is written.
+// Each request is assigned a unique ID, which is stored in the returned context. If ctx already has a request ID,
+// e.g. because the call is made while handling another call, the ID is kept. This allows correlating
+// all messages logged while handling a single FUSE request.
+func LogCall(ctx context.Context, l CallCtxGetter, extra CallCtx) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := RequestID(ctx); !ok {
+		ctx = context.WithValue(ctx, requestIDKey{}, lastRequestID.Add(1))
+	}
+	if DebugLog.Writer() == io.Discard {
+		return ctx
+	}
+	methodName := CurrentFuncName(1, Class)
+	info := callInfo(ctx, l, extra)
+	if !writeCallRecord(DebugLog, callRecord("call", methodName, info)) {
+		DebugLog.Printf("Called %v (%v)", methodName, formatCtx(info))
+	}
+	return ctx
+}
+
+// LogError logs an error which occurred during a method call, along with information about the call, as in LogCall.
+// The format is Error in <method>: <error> (<key>=<value>). In the JSON format, the error is placed in the field
+// "error" of the record. skip specifies how many frames to skip after the caller of LogError, as in CurrentFuncName.
+func LogError(ctx context.Context, skip int, l CallCtxGetter, err error, extra CallCtx) {
+	methodName := CurrentFuncName(skip+1, Class)
+	info := callInfo(ctx, l, extra)
+	record := callRecord("error", methodName, info)
+	record["error"] = err.Error()
+	if !writeCallRecord(ErrorLog, record) {
+		ErrorLog.Printf("Error in %v: %v (%v)", methodName, err, formatCtx(info))
+	}
+}
+
+// operationDuration is the histogram of running times measured by Benchmark.
+var operationDuration = metrics.Default.NewHistogramVec(
+	"gogitfs_operation_duration_seconds",
+	"Running time of filesystem operations, by node type and operation.",
+	metrics.DefaultBuckets,
+	"node", "op",
+)
+
+// splitMethodName splits a method name in the Class format, e.g. "(*commitNode).Lookup",
+// into the type name and the method name. The type name is empty for functions.
+func splitMethodName(name string) (typeName, method string) {
+	typeName, method, ok := strings.Cut(name, ".")
+	if !ok {
+		return "", name
+	}
+	typeName = strings.TrimSuffix(strings.TrimPrefix(typeName, "(*"), ")")
+	return typeName, method
+}
+
+// OperationCounts returns the number of calls measured by Benchmark, keyed by "<type>.<method>".
+func OperationCounts() map[string]uint64 {
+	return operationDuration.Counts()
 }
 
 // Benchmark can be used to measure running time of functions. Usage: `defer Benchmark(time.Now())`
+// The running time is logged and added to the histogram gogitfs_operation_duration_seconds,
+// labelled with the receiver type and the method name.
 func Benchmark(start time.Time) {
 	elapsed := time.Since(start)
 	name := CurrentFuncName(1, Package)
+	typeName, method := splitMethodName(ProcessFuncName(name, Class))
+	operationDuration.Observe(elapsed.Seconds(), typeName, method)
 	DebugLog.Printf("[BENCHMARK] %s: %v (%vms)", name, elapsed, elapsed.Seconds()*1000)
 }
-
-var _ = Benchmark
@@ -3,6 +3,7 @@ package logging
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func Test_formatCtxValue(t *testing.T) {
@@ -130,3 +131,31 @@ func Test_CurrentFuncName(t *testing.T) {
 		})
 	}
 }
+
+func Test_splitMethodName(t *testing.T) {
+	testCases := []struct {
+		name, typeName, method string
+	}{
+		{"funcNames", "", "funcNames"},
+		{"sampleClass.methodNames", "sampleClass", "methodNames"},
+		{"(*commitNode).Lookup", "commitNode", "Lookup"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			typeName, method := splitMethodName(tc.name)
+			assert.Equal(t, tc.typeName, typeName, "incorrect type name")
+			assert.Equal(t, tc.method, method, "incorrect method name")
+		})
+	}
+}
+
+func (c *sampleClass) benchmarked() {
+	defer Benchmark(time.Now())
+}
+
+func Test_Benchmark(t *testing.T) {
+	Init(Info)
+	before := operationDuration.Count("sampleClass", "benchmarked")
+	(&sampleClass{}).benchmarked()
+	assert.Equal(t, before+1, operationDuration.Count("sampleClass", "benchmarked"), "call should be measured")
+}
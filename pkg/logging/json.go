@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is a single structured log record.
+type Record = map[string]any
+
+// jsonWriter formats each message written by a log.Logger as a JSON record.
+type jsonWriter struct {
+	lock  sync.Mutex
+	out   io.Writer
+	level LogLevelFlag
+}
+
+// Write writes the message as the field "msg" of a record.
+func (w *jsonWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	err := w.writeRecord(Record{"msg": msg})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeRecord adds the timestamp and level to the record and writes it as a single line.
+func (w *jsonWriter) writeRecord(record Record) error {
+	record["time"] = time.Now().Format(time.RFC3339Nano)
+	record["level"] = levelToStr[w.level]
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("cannot format log record: %w", err)
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_, err = w.out.Write(append(data, '\n'))
+	return err
+}
+
+// jsonCtxValue converts a CallCtx value to a value which can be represented in JSON.
+// Numbers and booleans are kept, other values are formatted as strings.
+func jsonCtxValue(v any) any {
+	switch v.(type) {
+	case int, int8, int16, int32, int64:
+		return v
+	case uint, uint8, uint16, uint32, uint64, uintptr:
+		return v
+	case float32, float64, bool:
+		return v
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// topLevelKeys are CallCtx keys placed directly in the record, rather than in the field "ctx".
+var topLevelKeys = []string{"request", "node", "ino", "gen"}
+
+// callRecord creates a record describing a method call. Selected keys of the call context are placed directly
+// in the record, while the rest are placed in the field "ctx".
+func callRecord(msg, method string, info CallCtx) Record {
+	record := Record{"msg": msg, "method": method}
+	ctx := make(Record)
+	for k, v := range info {
+		ctx[k] = jsonCtxValue(v)
+	}
+	for _, k := range topLevelKeys {
+		if v, ok := ctx[k]; ok {
+			record[k] = v
+			delete(ctx, k)
+		}
+	}
+	if len(ctx) > 0 {
+		record["ctx"] = ctx
+	}
+	return record
+}
+
+// writeCallRecord writes the record using the logger's writer, if the JSON format is used.
+// Returns false if the logger does not use the JSON format.
+func writeCallRecord(logger interface{ Writer() io.Writer }, record Record) bool {
+	w, ok := logger.Writer().(*jsonWriter)
+	if !ok {
+		return false
+	}
+	_ = w.writeRecord(record)
+	return true
+}
@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"strings"
+	"testing"
+)
+
+func Test_LogFormatFlag(t *testing.T) {
+	for k, v := range map[LogFormatFlag]string{Text: "text", JSON: "json"} {
+		assert.Equal(t, v, k.String(), "incorrect string from flag")
+		var flag LogFormatFlag
+		err := flag.Set(v)
+		assert.NoError(t, err, "unexpected error during flag conversion")
+		assert.Equal(t, k, flag, "incorrect flag from string")
+	}
+	var flag LogFormatFlag
+	assert.Error(t, flag.Set("xml"), "should get an error for invalid flag")
+}
+
+type testNode struct{}
+
+func (n *testNode) GetCallCtx() CallCtx {
+	return CallCtx{"ino": 5, "gen": 1, "name": "foo\nbar"}
+}
+
+// readRecords parses the JSON records written to buf.
+func readRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		err := json.Unmarshal([]byte(line), &record)
+		assert.NoError(t, err, "unexpected error when parsing %v", line)
+		records = append(records, record)
+	}
+	return records
+}
+
+func Test_LogCall_json(t *testing.T) {
+	Init(Debug)
+	var buf bytes.Buffer
+	DebugLog = log.New(&jsonWriter{out: &buf, level: Debug}, "", 0)
+	ErrorLog = log.New(&jsonWriter{out: &buf, level: Error}, "", 0)
+
+	ctx := LogCall(context.Background(), &testNode{}, CallCtx{"extra": true})
+	id, ok := RequestID(ctx)
+	assert.True(t, ok, "request ID should be assigned")
+	nestedCtx := LogCall(ctx, &testNode{}, nil)
+	nestedId, _ := RequestID(nestedCtx)
+	assert.Equal(t, id, nestedId, "nested call should keep the request ID")
+	LogError(ctx, 0, &testNode{}, errors.New("failed"), nil)
+	otherCtx := LogCall(context.Background(), NilCtx{}, nil)
+	otherId, _ := RequestID(otherCtx)
+	assert.NotEqual(t, id, otherId, "different calls should have different request IDs")
+	DebugLog.Printf("message")
+
+	records := readRecords(t, &buf)
+	if !assert.Len(t, records, 5, "incorrect number of records") {
+		return
+	}
+	for _, record := range records {
+		assert.Contains(t, record, "time", "record should have a timestamp")
+		delete(record, "time")
+	}
+	assert.Equal(t, map[string]any{
+		"level":   "DEBUG",
+		"msg":     "call",
+		"method":  "Test_LogCall_json",
+		"node":    "testNode",
+		"request": float64(id),
+		"ino":     float64(5),
+		"gen":     float64(1),
+		"ctx":     map[string]any{"name": "foo\nbar", "extra": true},
+	}, records[0], "incorrect call record")
+	assert.Equal(t, float64(id), records[1]["request"], "incorrect request ID of nested call")
+	assert.Equal(t, "ERROR", records[2]["level"], "incorrect level of error record")
+	assert.Equal(t, "failed", records[2]["error"], "incorrect error")
+	assert.Equal(t, float64(id), records[2]["request"], "error should have the request ID of the call")
+	assert.NotContains(t, records[3], "node", "NilCtx should not be reported as a node")
+	assert.Equal(t, map[string]any{"level": "DEBUG", "msg": "message"}, records[4], "incorrect message record")
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"sync"
 )
 
 // LogLevelFlag represents log levels, with 0 (DEBUG) being the most detailed
@@ -57,20 +58,72 @@ func (f *LogLevelFlag) Set(s string) error {
 	return nil
 }
 
+// LogFormatFlag represents the format of log messages
+type LogFormatFlag int
+
+const (
+	// Text - human-readable messages with a timestamp and level prefix
+	Text LogFormatFlag = iota
+	// JSON - one JSON object per line, see README for the fields
+	JSON
+)
+
+var formatToStr = map[LogFormatFlag]string{
+	Text: "text",
+	JSON: "json",
+}
+
+var strToFormat = map[string]LogFormatFlag{
+	"text": Text,
+	"json": JSON,
+}
+
+// String returns a string representation of a log format flag
+func (f *LogFormatFlag) String() string {
+	return formatToStr[*f]
+}
+
+// Set parses log format flag, given as a lower-case name.
+func (f *LogFormatFlag) Set(s string) error {
+	val, ok := strToFormat[s]
+	if !ok {
+		return fmt.Errorf("log format must be \"text\" or \"json\", got %v", s)
+	}
+	*f = val
+	return nil
+}
+
+// configLock guards the configuration of the loggers: the level, the format, the output and recent.
+// The loggers themselves are never replaced, only reconfigured, so they can be used concurrently with
+// the configuration functions.
+var configLock sync.Mutex
+
 // current logging level
 var logLevel = Info
 
+// current logging format
+var logFormat = Text
+
+// writer used by the loggers
+var logOutput io.Writer = os.Stdout
+
 // DebugLog writes messages with level DEBUG
-var DebugLog *log.Logger
+var DebugLog = log.New(io.Discard, "", 0)
 
 // InfoLog writes messages with level INFO
-var InfoLog *log.Logger
+var InfoLog = log.New(io.Discard, "", 0)
 
 // WarningLog writes messages with level WARNING
-var WarningLog *log.Logger
+var WarningLog = log.New(io.Discard, "", 0)
 
 // ErrorLog writes messages with level ERROR
-var ErrorLog *log.Logger
+var ErrorLog = log.New(io.Discard, "", 0)
+
+// The loggers are initialized with level INFO and the text format, so that they can be used before Init is called,
+// e.g. by programs using gogitfs as a library without configuring logging.
+func init() {
+	Init(Info)
+}
 
 // LoggerWithLevel returns the logger for the specified level
 func LoggerWithLevel(l LogLevelFlag) *log.Logger {
@@ -87,24 +140,70 @@ func LoggerWithLevel(l LogLevelFlag) *log.Logger {
 	return nil
 }
 
+// Init initializes the loggers with the given level, using the text format.
 func Init(l LogLevelFlag) {
+	InitWithFormat(l, Text)
+}
+
+// InitWithFormat initializes the loggers with the given level and format.
+func InitWithFormat(l LogLevelFlag, f LogFormatFlag) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	logLevel = l
+	logFormat = f
+	configureLoggers()
+}
+
+// SetLevel changes the level of the loggers, keeping the format and the output. It is safe to call while
+// the loggers are used, e.g. when the level is changed through the filesystem.
+func SetLevel(l LogLevelFlag) {
+	configLock.Lock()
+	defer configLock.Unlock()
 	logLevel = l
-	DebugLog = makeLogger(Debug)
-	InfoLog = makeLogger(Info)
-	WarningLog = makeLogger(Warning)
-	ErrorLog = makeLogger(Error)
+	configureLoggers()
 }
 
-func makeLogger(level LogLevelFlag) *log.Logger {
+// Level returns the current level of the loggers.
+func Level() LogLevelFlag {
+	configLock.Lock()
+	defer configLock.Unlock()
+	return logLevel
+}
+
+// SetOutput sets the writer used by the loggers (os.Stdout by default).
+func SetOutput(w io.Writer) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	logOutput = w
+	configureLoggers()
+}
+
+// configureLoggers applies the current configuration to all loggers. configLock must be held.
+func configureLoggers() {
+	for level := Debug; level <= Error; level++ {
+		configureLogger(LoggerWithLevel(level), level)
+	}
+}
+
+// configureLogger sets the output, prefix and flags of the logger according to the current configuration.
+// configLock must be held.
+func configureLogger(logger *log.Logger, level LogLevelFlag) {
 	var output io.Writer
 	if level >= logLevel {
-		output = os.Stdout
+		output = withRecent(logOutput)
 	} else {
 		output = io.Discard
 	}
 
-	prefix := fmt.Sprintf("[%s] ", levelToStr[level])
-	return log.New(output, prefix, log.LstdFlags|log.Lmsgprefix)
+	if logFormat == JSON && output != io.Discard {
+		logger.SetOutput(&jsonWriter{out: output, level: level})
+		logger.SetPrefix("")
+		logger.SetFlags(0)
+		return
+	}
+	logger.SetOutput(output)
+	logger.SetPrefix(fmt.Sprintf("[%s] ", levelToStr[level]))
+	logger.SetFlags(log.LstdFlags | log.Lmsgprefix)
 }
 
 // MakeFileLogger returns a logger writing to the specified file
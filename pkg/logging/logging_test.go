@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -75,3 +76,43 @@ func Test_MakeFileLogger(t *testing.T) {
 	assert.NoError(t, err, "unexpected data reading error")
 	assert.Equal(t, "test\n", string(data[:n]), "read incorrect data")
 }
+
+func Test_KeepRecentLines(t *testing.T) {
+	Init(Info)
+	SetOutput(io.Discard)
+	defer SetOutput(os.Stdout)
+	KeepRecentLines(2)
+	defer KeepRecentLines(0)
+	assert.Empty(t, RecentLines(), "no lines should be kept yet")
+	InfoLog.Printf("a")
+	assert.Len(t, RecentLines(), 1, "one line should be kept")
+	DebugLog.Printf("discarded")
+	InfoLog.Printf("b\nc")
+	lines := RecentLines()
+	if assert.Len(t, lines, 2, "only the last lines should be kept") {
+		assert.True(t, strings.HasSuffix(lines[0], "] b"), "incorrect line: %v", lines[0])
+		assert.Equal(t, "c", lines[1], "incorrect line")
+	}
+}
+
+func Test_SetLevel_concurrent(t *testing.T) {
+	Init(Info)
+	SetOutput(io.Discard)
+	defer SetOutput(os.Stdout)
+	defer Init(Info)
+	logger := DebugLog
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			DebugLog.Printf("message %d", i)
+			LoggerWithLevel(Info).Printf("message %d", i)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		SetLevel(LogLevelFlag(i % 4))
+	}
+	<-done
+	assert.Same(t, logger, DebugLog, "loggers should be reconfigured, not replaced")
+	assert.Equal(t, Error, Level(), "incorrect level")
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"io"
+	"strings"
+	"sync"
+)
+
+// recentLines keeps the most recent log lines in a ring buffer.
+type recentLines struct {
+	lock  sync.Mutex
+	lines []string
+	// next is the index in lines where the next line is stored
+	next int
+	full bool
+}
+
+// Write stores each line of p.
+func (r *recentLines) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		r.lines[r.next] = line
+		r.next = (r.next + 1) % len(r.lines)
+		if r.next == 0 {
+			r.full = true
+		}
+	}
+	return len(p), nil
+}
+
+// get returns the stored lines, oldest first.
+func (r *recentLines) get() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.full {
+		return append([]string(nil), r.lines[:r.next]...)
+	}
+	return append(append([]string(nil), r.lines[r.next:]...), r.lines[:r.next]...)
+}
+
+// recent stores the recent log lines, or is nil if they aren't kept. It is guarded by configLock.
+var recent *recentLines
+
+// KeepRecentLines makes the loggers keep the last n lines written, in addition to writing them to the output.
+// The lines can be retrieved with RecentLines. If n <= 0, lines are no longer kept.
+func KeepRecentLines(n int) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	if n <= 0 {
+		recent = nil
+	} else {
+		recent = &recentLines{lines: make([]string, n)}
+	}
+	configureLoggers()
+}
+
+// RecentLines returns the lines kept since the last call of KeepRecentLines, oldest first.
+func RecentLines() []string {
+	configLock.Lock()
+	r := recent
+	configLock.Unlock()
+	if r == nil {
+		return nil
+	}
+	return r.get()
+}
+
+// withRecent returns a writer writing to `output`, which additionally stores the lines written,
+// if KeepRecentLines is enabled. configLock must be held.
+func withRecent(output io.Writer) io.Writer {
+	if recent == nil {
+		return output
+	}
+	return io.MultiWriter(output, recent)
+}
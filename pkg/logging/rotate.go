@@ -0,0 +1,195 @@
+package logging
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// RotatingFile is a log file which is rotated once it exceeds the maximum size. When the file is rotated,
+// it's renamed to <path>.1, the previously rotated files are renamed to <path>.2, <path>.3 etc.,
+// and files beyond the maximum count are removed. Rotated files can optionally be compressed with gzip,
+// in which case the suffix .gz is added to their names.
+type RotatingFile struct {
+	lock sync.Mutex
+	file *os.File
+	size int64
+
+	// Path is the path of the current log file.
+	Path string
+	// MaxSize is the size in bytes above which the file is rotated. If 0, the file is never rotated.
+	MaxSize int64
+	// MaxFiles is the number of rotated files which are kept.
+	MaxFiles int
+	// Compress specifies whether rotated files should be compressed.
+	Compress bool
+	// OnRotate, if not nil, is called with the newly opened file after each rotation.
+	OnRotate func(file *os.File) error
+}
+
+// OpenRotatingFile opens the log file at `path` for appending, creating it if necessary.
+func OpenRotatingFile(path string, maxSize int64, maxFiles int, compress bool) (*RotatingFile, error) {
+	f := &RotatingFile{Path: path, MaxSize: maxSize, MaxFiles: maxFiles, Compress: compress}
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("cannot stat log file: %w", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write writes p to the current file. If the file would exceed the maximum size, it's rotated first.
+// A single write is never split between files.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSize {
+		err := f.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file regardless of its size.
+func (f *RotatingFile) Rotate() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// Close closes the current file.
+func (f *RotatingFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// rotatedName returns the name of the n-th rotated file.
+func (f *RotatingFile) rotatedName(n int, compressed bool) string {
+	name := fmt.Sprintf("%s.%d", f.Path, n)
+	if compressed {
+		name += ".gz"
+	}
+	return name
+}
+
+// removeIfExists removes the file, ignoring the error if it doesn't exist.
+func removeIfExists(name string) error {
+	err := os.Remove(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// renameIfExists renames the file, ignoring the error if it doesn't exist.
+func renameIfExists(from, to string) error {
+	err := os.Rename(from, to)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// rotate closes the current file, shifts the rotated files and opens a new file. Must be called with the lock held.
+func (f *RotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return fmt.Errorf("cannot close log file: %w", err)
+	}
+
+	for _, compressed := range []bool{false, true} {
+		if err = removeIfExists(f.rotatedName(f.MaxFiles, compressed)); err != nil {
+			return fmt.Errorf("cannot remove old log file: %w", err)
+		}
+		for i := f.MaxFiles - 1; i >= 1; i-- {
+			err = renameIfExists(f.rotatedName(i, compressed), f.rotatedName(i+1, compressed))
+			if err != nil {
+				return fmt.Errorf("cannot rename old log file: %w", err)
+			}
+		}
+	}
+	if f.MaxFiles > 0 {
+		err = os.Rename(f.Path, f.rotatedName(1, false))
+		if err == nil && f.Compress {
+			err = compressFile(f.rotatedName(1, false), f.rotatedName(1, true))
+		}
+	} else {
+		err = os.Remove(f.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot rotate log file: %w", err)
+	}
+
+	if err = f.open(); err != nil {
+		return err
+	}
+	if f.OnRotate != nil {
+		return f.OnRotate(f.file)
+	}
+	return nil
+}
+
+// compressFile writes the contents of `src` compressed with gzip to `dst`, then removes `src`.
+func compressFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := out.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err != nil {
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+var _ io.WriteCloser = (*RotatingFile)(nil)
@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readLogFile(t *testing.T, name string, compressed bool) string {
+	file, err := os.Open(name)
+	if !assert.NoError(t, err, "cannot open log file") {
+		return ""
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	var r io.Reader = file
+	if compressed {
+		r, err = gzip.NewReader(file)
+		if !assert.NoError(t, err, "cannot decompress log file") {
+			return ""
+		}
+	}
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err, "cannot read log file")
+	return string(data)
+}
+
+func Test_RotatingFile(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		name := "plain"
+		if compress {
+			name = "compressed"
+		}
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.log")
+			f, err := OpenRotatingFile(path, 8, 2, compress)
+			if !assert.NoError(t, err, "cannot open log file") {
+				return
+			}
+			var rotations int
+			f.OnRotate = func(file *os.File) error {
+				rotations++
+				return nil
+			}
+			for _, msg := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dd\n", "eeeeeeeeee\n"} {
+				_, err = f.Write([]byte(msg))
+				assert.NoError(t, err, "unexpected write error")
+			}
+			assert.NoError(t, f.Close())
+
+			assert.Equal(t, 3, rotations)
+			assert.Equal(t, "eeeeeeeeee\n", readLogFile(t, path, false))
+			assert.Equal(t, "cccc\ndd\n", readLogFile(t, f.rotatedName(1, compress), compress))
+			assert.Equal(t, "bbbb\n", readLogFile(t, f.rotatedName(2, compress), compress))
+			for _, c := range []bool{false, true} {
+				assert.NoFileExists(t, f.rotatedName(3, c))
+				if c != compress {
+					assert.NoFileExists(t, f.rotatedName(1, c))
+				}
+			}
+		})
+	}
+
+	t.Run("append", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.log")
+		assert.NoError(t, os.WriteFile(path, []byte("aaaa\n"), 0644))
+		f, err := OpenRotatingFile(path, 8, 1, false)
+		if !assert.NoError(t, err, "cannot open log file") {
+			return
+		}
+		_, err = f.Write([]byte("bbbb\n"))
+		assert.NoError(t, err, "unexpected write error")
+		assert.NoError(t, f.Close())
+		assert.Equal(t, "bbbb\n", readLogFile(t, path, false))
+		assert.Equal(t, "aaaa\n", readLogFile(t, path+".1", false))
+	})
+
+	t.Run("no rotated files", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.log")
+		f, err := OpenRotatingFile(path, 4, 0, false)
+		if !assert.NoError(t, err, "cannot open log file") {
+			return
+		}
+		for _, msg := range []string{"aaaa\n", "bbbb\n"} {
+			_, err = f.Write([]byte(msg))
+			assert.NoError(t, err, "unexpected write error")
+		}
+		assert.NoError(t, f.Close())
+		assert.Equal(t, "bbbb\n", readLogFile(t, path, false))
+		assert.NoFileExists(t, path+".1")
+	})
+}
+
+func Test_SetOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	f, err := OpenRotatingFile(path, 0, 0, false)
+	if !assert.NoError(t, err, "cannot open log file") {
+		return
+	}
+	Init(Info)
+	SetOutput(f)
+	defer SetOutput(os.Stdout)
+	assert.Equal(t, io.Discard, DebugLog.Writer())
+	assert.Equal(t, f, InfoLog.Writer())
+	InfoLog.Printf("test")
+	assert.NoError(t, f.Close())
+	assert.Contains(t, readLogFile(t, path, false), "[INFO] test\n")
+}
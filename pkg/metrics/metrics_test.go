@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := &Registry{}
+	counter := r.NewCounterVec("test_total", "Test counter.", "kind")
+	histogram := r.NewHistogramVec("test_seconds", "Test histogram.", []float64{1, 0.1}, "op")
+	r.NewGaugeFunc("test_gauge", "Test gauge.", func() float64 { return 3 })
+
+	counter.Inc("b")
+	counter.Add(2, "a")
+	counter.Inc("b")
+	counter.Inc("with \"quotes\"")
+	histogram.Observe(0.05, "read")
+	histogram.Observe(0.5, "read")
+	histogram.Observe(2, "read")
+
+	assert.Equal(t, 2.0, counter.Value("b"), "incorrect counter value")
+	assert.Equal(t, 0.0, counter.Value("c"), "absent counter should be 0")
+	assert.Equal(t, uint64(3), histogram.Count("read"), "incorrect histogram count")
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.Write(&buf), "unexpected write error")
+	expected := `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{kind="a"} 2
+test_total{kind="b"} 2
+test_total{kind="with \"quotes\""} 1
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{op="read",le="0.1"} 1
+test_seconds_bucket{op="read",le="1"} 2
+test_seconds_bucket{op="read",le="+Inf"} 3
+test_seconds_sum{op="read"} 2.55
+test_seconds_count{op="read"} 3
+# HELP test_gauge Test gauge.
+# TYPE test_gauge gauge
+test_gauge 3
+`
+	assert.Equal(t, expected, buf.String(), "incorrect output")
+}
+
+func TestCounterVec_labelMismatch(t *testing.T) {
+	r := &Registry{}
+	counter := r.NewCounterVec("test_total", "Test counter.", "a", "b")
+	assert.Panics(t, func() {
+		counter.Inc("a")
+	}, "wrong number of label values should panic")
+}
+
+func TestListen(t *testing.T) {
+	r := &Registry{}
+	r.NewCounterVec("test_total", "Test counter.").Inc()
+	socket := filepath.Join(t.TempDir(), "metrics.sock")
+
+	testCases := []struct {
+		name   string
+		addr   string
+		client *http.Client
+	}{
+		{"tcp", "127.0.0.1:0", http.DefaultClient},
+		{"unix", "unix:" + socket, &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, err := Listen(tc.addr, r)
+			if !assert.NoError(t, err, "cannot listen") {
+				return
+			}
+			defer func() {
+				_ = server.Close()
+			}()
+			url := "http://localhost/metrics"
+			if tc.name == "tcp" {
+				url = "http://" + server.Addr().String() + "/metrics"
+			}
+			resp, err := tc.client.Get(url)
+			if !assert.NoError(t, err, "cannot get metrics") {
+				return
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			body, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err, "cannot read response")
+			assert.Contains(t, string(body), "test_total 1\n", "metrics should be served")
+		})
+	}
+
+	t.Run("non-loopback", func(t *testing.T) {
+		for _, addr := range []string{":0", "0.0.0.0:0", "example.com:9100"} {
+			_, err := Listen(addr, r)
+			assert.Error(t, err, "non-loopback address %v should be rejected", addr)
+		}
+	})
+}
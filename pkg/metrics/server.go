@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ServeHTTP writes the metrics of the registry in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.Write(w)
+}
+
+// Server serves the metrics of a registry over HTTP.
+type Server struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+// listen creates a listener for the address, see Listen.
+func listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		// remove a stale socket left by a previous run
+		info, err := os.Lstat(path)
+		if err == nil && info.Mode()&fs.ModeSocket != 0 {
+			_ = os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, errors.New("only loopback addresses are allowed")
+	}
+	return net.Listen("tcp", addr)
+}
+
+// Listen starts serving the metrics of the registry at the given address, which is either
+// "unix:<path>" for a Unix socket, or "<host>:<port>" with a loopback host, e.g. "localhost:9100".
+// The metrics are served at every path.
+func Listen(addr string, r *Registry) (*Server, error) {
+	listener, err := listen(addr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot listen on %v: %w", addr, err)
+	}
+	s := &Server{server: &http.Server{Handler: r}, listener: listener}
+	go func() {
+		_ = s.server.Serve(listener)
+	}()
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.server.Close()
+}
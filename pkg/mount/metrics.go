@@ -0,0 +1,65 @@
+package mount
+
+import (
+	"gogitfs/pkg/gitfs"
+	"gogitfs/pkg/metrics"
+	"sync"
+)
+
+// mountedRoots contains the root nodes of the filesystems mounted by this process.
+var mountedRoots = struct {
+	lock  sync.Mutex
+	roots map[*gitfs.RootNode]bool
+}{roots: map[*gitfs.RootNode]bool{}}
+
+func addMountedRoot(root *gitfs.RootNode) {
+	mountedRoots.lock.Lock()
+	defer mountedRoots.lock.Unlock()
+	mountedRoots.roots[root] = true
+}
+
+func removeMountedRoot(root *gitfs.RootNode) {
+	mountedRoots.lock.Lock()
+	defer mountedRoots.lock.Unlock()
+	delete(mountedRoots.roots, root)
+}
+
+// liveInodes returns the total number of live inodes of the mounted filesystems, see gitfs.RootNode.LiveInodes.
+func liveInodes() float64 {
+	mountedRoots.lock.Lock()
+	defer mountedRoots.lock.Unlock()
+	var total int
+	for root := range mountedRoots.roots {
+		total += root.LiveInodes()
+	}
+	return float64(total)
+}
+
+var _ = metrics.Default.NewGaugeFunc(
+	"gogitfs_live_inodes",
+	"Number of inodes of the mounted filesystems currently known to the kernel.",
+	liveInodes,
+)
+
+// serveMetrics starts serving metrics.Default at opts.MetricsAddr, if set. The server is stopped
+// once the filesystem is unmounted.
+func (h *Handle) serveMetrics(opts Options) error {
+	addMountedRoot(h.root)
+	var server *metrics.Server
+	if opts.MetricsAddr != "" {
+		var err error
+		server, err = metrics.Listen(opts.MetricsAddr, metrics.Default)
+		if err != nil {
+			return err
+		}
+		h.metricsAddr = server.Addr().String()
+	}
+	go func() {
+		h.server.Wait()
+		removeMountedRoot(h.root)
+		if server != nil {
+			_ = server.Close()
+		}
+	}()
+	return nil
+}
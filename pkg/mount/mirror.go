@@ -0,0 +1,103 @@
+package mount
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"gogitfs/pkg/logging"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// IsURL returns true if repoPath should be treated as a URL of a remote repository, rather than a local path.
+// Only URLs with an explicit scheme, such as https:// or file://, are recognized.
+func IsURL(repoPath string) bool {
+	return strings.Contains(repoPath, "://")
+}
+
+// DefaultCacheDir returns the directory where mirrors of remote repositories are stored by default.
+func DefaultCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot get user cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, "gogitfs"), nil
+}
+
+// mirrorPath returns the path of the mirror of the repository at the given URL. The directory name consists
+// of the last element of the URL, for readability, and a hash of the whole URL, for uniqueness.
+func mirrorPath(cacheDir, url string) string {
+	base := strings.TrimSuffix(path.Base(strings.TrimRight(url, "/")), ".git")
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(cacheDir, fmt.Sprintf("%s-%s.git", base, hex.EncodeToString(sum[:8])))
+}
+
+// fetchMirror fetches the changes from the remote of the mirror. Returns nil if the mirror is already up-to-date.
+func fetchMirror(ctx context.Context, repo *git.Repository) error {
+	err := repo.FetchContext(ctx, &git.FetchOptions{Force: true, Prune: true})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("cannot fetch: %w", err)
+	}
+	return nil
+}
+
+// openMirror opens the mirror of the repository at the given URL stored in cacheDir and updates it.
+// If there is no mirror yet, the repository is cloned.
+func openMirror(ctx context.Context, url, cacheDir string) (*git.Repository, error) {
+	p := mirrorPath(cacheDir, url)
+	repo, err := git.PlainOpen(p)
+	if err == nil {
+		logging.InfoLog.Printf("Updating mirror of %v in %v\n", url, p)
+		err = fetchMirror(ctx, repo)
+		if err != nil {
+			return nil, fmt.Errorf("cannot update mirror of %v: %w", url, err)
+		}
+		return repo, nil
+	} else if !errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, fmt.Errorf("cannot open mirror of %v: %w", url, err)
+	}
+
+	logging.InfoLog.Printf("Cloning %v into %v\n", url, p)
+	repo, err = git.PlainCloneContext(ctx, p, true, &git.CloneOptions{URL: url, Mirror: true})
+	if err != nil {
+		return nil, fmt.Errorf("cannot clone %v: %w", url, err)
+	}
+	return repo, nil
+}
+
+// fetchPeriodically fetches the changes to the mirror located at mirrorDir every `interval`, until ctx is done
+// or the filesystem is unmounted. The changes are fetched through a separate git.Repository, so the repository read
+// by the filesystem is not modified concurrently. After each fetch, the filesystem is refreshed, so that the fetched
+// objects and new branch heads are visible.
+func (h *Handle) fetchPeriodically(ctx context.Context, mirrorDir string, interval time.Duration) {
+	repo, err := git.PlainOpen(mirrorDir)
+	if err != nil {
+		logging.ErrorLog.Printf("Cannot open mirror for fetching: %v", err)
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	done := waitChan(h.server)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			return
+		case <-ticker.C:
+			logging.DebugLog.Printf("Fetching changes to mirror")
+			err := fetchMirror(ctx, repo)
+			if err != nil {
+				logging.WarningLog.Printf("Cannot update mirror: %v", err)
+				continue
+			}
+			h.Refresh()
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package mount
+
+import (
+	"context"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestIsURL(t *testing.T) {
+	assert.True(t, IsURL("https://example.com/repo.git"), "https URL should be recognized")
+	assert.True(t, IsURL("file:///tmp/repo"), "file URL should be recognized")
+	assert.False(t, IsURL("/tmp/repo"), "absolute path should not be a URL")
+	assert.False(t, IsURL("repo"), "relative path should not be a URL")
+}
+
+func Test_mirrorPath(t *testing.T) {
+	p1 := mirrorPath("/cache", "https://example.com/foo/repo.git")
+	p2 := mirrorPath("/cache", "https://example.org/bar/repo.git")
+	assert.Equal(t, "/cache", path.Dir(p1), "mirror should be placed in the cache directory")
+	assert.Regexp(t, "^repo-[0-9a-f]{16}\\.git$", path.Base(p1), "incorrect mirror directory name")
+	assert.NotEqual(t, p1, p2, "different URLs should have different mirrors")
+	assert.Equal(t, p1, mirrorPath("/cache", "https://example.com/foo/repo.git"), "mirror path should be stable")
+}
+
+func TestMount_url(t *testing.T) {
+	srcDir := t.TempDir()
+	src, err := git.PlainInit(srcDir, false)
+	if err != nil {
+		t.Fatalf("Cannot create repository: %v", err)
+	}
+	first := addCommit(t, src, srcDir, "first")
+
+	opts := DefaultOptions()
+	opts.CacheDir = t.TempDir()
+	opts.FetchInterval = 100 * time.Millisecond
+	url := "file://" + srcDir
+	mountDir := t.TempDir()
+	handle, err := Mount(context.Background(), url, mountDir, opts)
+	if err != nil {
+		t.Fatalf("Cannot mount repository: %v", err)
+	}
+	defer func() {
+		_ = handle.Unmount()
+	}()
+
+	branchDir := path.Join(mountDir, "branches", "master")
+	assert.Contains(t, dirEntries(t, branchDir), first.String(), "commit should be mirrored")
+
+	t.Run("fetch", func(t *testing.T) {
+		second := addCommit(t, src, srcDir, "second")
+		assert.Eventually(t, func() bool {
+			for _, name := range dirEntries(t, branchDir) {
+				if name == second.String() {
+					return true
+				}
+			}
+			return false
+		}, 10*time.Second, 100*time.Millisecond, "new commit should be fetched")
+	})
+
+	t.Run("new branch", func(t *testing.T) {
+		wt, err := src.Worktree()
+		if err != nil {
+			t.Fatalf("Cannot get worktree: %v", err)
+		}
+		err = wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature"), Create: true})
+		if err != nil {
+			t.Fatalf("Cannot create branch: %v", err)
+		}
+		third := addCommit(t, src, srcDir, "third")
+		branchesDir := path.Join(mountDir, "branches")
+		assert.Eventually(t, func() bool {
+			for _, name := range dirEntries(t, branchesDir) {
+				if name == "feature" {
+					return true
+				}
+			}
+			return false
+		}, 10*time.Second, 100*time.Millisecond, "new branch should be fetched")
+		// the branch may be fetched before the commit is added to it
+		assert.Eventually(t, func() bool {
+			for _, name := range dirEntries(t, path.Join(branchesDir, "feature")) {
+				if name == third.String() {
+					return true
+				}
+			}
+			return false
+		}, 10*time.Second, 100*time.Millisecond, "commit should be fetched")
+	})
+
+	t.Run("reuse mirror", func(t *testing.T) {
+		repo, err := openMirror(context.Background(), url, opts.CacheDir)
+		if !assert.NoError(t, err, "unexpected error when opening existing mirror") {
+			return
+		}
+		_, err = repo.CommitObject(first)
+		assert.NoError(t, err, "existing mirror should contain the commit")
+	})
+}
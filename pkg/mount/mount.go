@@ -0,0 +1,314 @@
+// Package mount provides an API for mounting repositories from Go code, without spawning a daemon process.
+package mount
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"gogitfs/pkg/gitfs"
+	"gogitfs/pkg/logging"
+	"gogitfs/pkg/mountpoint"
+	"os/user"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options specifies how the repository is mounted. The fields correspond to the CLI flags of gogitfs.
+type Options struct {
+	// InitLogging makes Mount configure the process-wide loggers with LogLevel and LogFormat, and keep the last
+	// log lines for .gogitfs/log. Leave it false if the program configures logging itself, see the package logging.
+	InitLogging bool
+	// LogLevel is the level of messages written to the logs, if InitLogging is set.
+	LogLevel logging.LogLevelFlag
+	// LogFormat is the format of the logs, if InitLogging is set.
+	LogFormat logging.LogFormatFlag
+	// FuseDebug enables FUSE debug info in logs.
+	FuseDebug bool
+	// AllowNonEmpty allows mounting in a non-empty directory.
+	AllowNonEmpty bool
+	// UID is the user ID to mount as. If -1, the current user's ID is used.
+	UID int64
+	// GID is the group ID to mount as. If -1, the current user group's ID is used.
+	GID int64
+	// AllowOther mounts the filesystem with 'allow_other'.
+	AllowOther bool
+	// DetectDotGit makes Mount search for the repository in parent directories of the given path.
+	DetectDotGit bool
+	// EnableDotGitCommonDir makes Mount respect the commondir file, allowing linked worktrees to be mounted.
+	EnableDotGitCommonDir bool
+	// CacheDir is the directory where mirrors of remote repositories are stored.
+	// If empty, DefaultCacheDir is used.
+	CacheDir string
+	// FetchInterval is the interval between fetches of changes to a mirrored remote repository.
+	// If 0, the mirror is only updated when mounting.
+	FetchInterval time.Duration
+	// MetricsAddr is the address at which metrics are served in the Prometheus text format, see metrics.Listen.
+	// If empty, metrics are not served.
+	MetricsAddr string
+	// WritableRefs allows creating and deleting branches and tags, see gitfs.RootNode.SetWritableRefs.
+	WritableRefs bool
+	// CommitAuthor is the author of commits created in staging areas, in the format "Name <email>".
+	// If empty, the author is taken from git config, see gitfs.RootNode.SetCommitAuthor.
+	CommitAuthor string
+	// RawLFSPointers makes Git LFS pointers be served as they are, see gitfs.RootNode.SetRawLFSPointers.
+	RawLFSPointers bool
+	// Flags are the command line flags the options were parsed from, shown in .gogitfs/options.
+	// If nil, the options are described by the names and values of the fields.
+	Flags []string
+}
+
+// recentLogLines is the number of log lines shown in .gogitfs/log.
+const recentLogLines = 100
+
+// describe returns the lines shown in .gogitfs/options.
+func (o Options) describe() []string {
+	if o.Flags != nil {
+		return o.Flags
+	}
+	var lines []string
+	v := reflect.ValueOf(&o).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if v.Type().Field(i).Name == "Flags" {
+			continue
+		}
+		value := field.Interface()
+		// log levels and formats implement fmt.Stringer with pointer receivers
+		if stringer, ok := field.Addr().Interface().(fmt.Stringer); ok {
+			value = stringer.String()
+		}
+		lines = append(lines, fmt.Sprintf("%s=%v", v.Type().Field(i).Name, value))
+	}
+	return lines
+}
+
+// initLogging initializes the loggers according to the options, if opts.InitLogging is set.
+func initLogging(opts Options) {
+	if !opts.InitLogging {
+		return
+	}
+	logging.InitWithFormat(opts.LogLevel, opts.LogFormat)
+	logging.KeepRecentLines(recentLogLines)
+}
+
+// DefaultOptions returns the options used by gogitfs when no flags are given.
+func DefaultOptions() Options {
+	return Options{
+		LogLevel:              logging.Info,
+		UID:                   -1,
+		GID:                   -1,
+		EnableDotGitCommonDir: true,
+	}
+}
+
+// Handle represents a mounted repository.
+type Handle struct {
+	server   *fuse.Server
+	root     *gitfs.RootNode
+	mountDir string
+	// metricsAddr is the address of the metrics server, or empty if metrics are not served
+	metricsAddr string
+	// unmountOnce makes sure the filesystem is unmounted once, even if both Unmount is called
+	// and the context is cancelled.
+	unmountOnce sync.Once
+	unmountErr  error
+}
+
+// MountDir returns the absolute path of the directory where the repository is mounted.
+func (h *Handle) MountDir() string {
+	return h.mountDir
+}
+
+// MetricsAddr returns the address at which metrics are served, or an empty string if Options.MetricsAddr was empty.
+func (h *Handle) MetricsAddr() string {
+	return h.metricsAddr
+}
+
+// Wait blocks until the filesystem is unmounted.
+func (h *Handle) Wait() {
+	h.server.Wait()
+}
+
+// Unmount unmounts the filesystem and waits until the FUSE server stops.
+func (h *Handle) Unmount() error {
+	h.unmountOnce.Do(func() {
+		h.unmountErr = h.server.Unmount()
+		if h.unmountErr != nil {
+			h.unmountErr = fmt.Errorf("cannot unmount %v: %w", h.mountDir, h.unmountErr)
+		}
+	})
+	return h.unmountErr
+}
+
+// Refresh makes the filesystem reflect the current state of the repository immediately,
+// see gitfs.RootNode.Refresh.
+func (h *Handle) Refresh() {
+	h.root.Refresh()
+}
+
+// parseAuthor returns the name and email of an author given in the format "Name <email>".
+func parseAuthor(author string) (string, string, error) {
+	name, email, ok := strings.Cut(strings.TrimSpace(author), "<")
+	email, closed := strings.CutSuffix(email, ">")
+	name = strings.TrimSpace(name)
+	if !ok || !closed || name == "" || email == "" || strings.ContainsAny(email, "<>") {
+		return "", "", fmt.Errorf("invalid commit author %q, expected \"Name <email>\"", author)
+	}
+	return name, email, nil
+}
+
+// fuseOptions creates FUSE options based on the given options.
+func fuseOptions(opts Options) (*fs.Options, error) {
+	fsOpts := &fs.Options{}
+	// get current UID and GID if not specified
+	if opts.UID == -1 || opts.GID == -1 {
+		currentUser, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get current user: %w", err)
+		}
+		if opts.UID == -1 {
+			uid, err := strconv.ParseUint(currentUser.Uid, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse UID: %w", err)
+			}
+			opts.UID = int64(uid)
+		}
+		if opts.GID == -1 {
+			gid, err := strconv.ParseUint(currentUser.Gid, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse GID: %w", err)
+			}
+			opts.GID = int64(gid)
+		}
+	}
+	fsOpts.UID = uint32(opts.UID)
+	fsOpts.GID = uint32(opts.GID)
+
+	posTime := 6 * time.Hour
+	negTime := 15 * time.Second
+	fsOpts.AttrTimeout = &posTime
+	fsOpts.EntryTimeout = &posTime
+	fsOpts.NegativeTimeout = &negTime
+	fsOpts.Debug = opts.FuseDebug
+	fsOpts.AllowOther = opts.AllowOther
+	fsOpts.Logger = logging.ErrorLog
+	return fsOpts, nil
+}
+
+// Mount mounts the repository located at repoPath in mountDir and returns a handle to the mounted filesystem.
+// If repoPath is a URL (see IsURL), the remote repository is mirrored in opts.CacheDir and the mirror is mounted.
+// The function returns once the filesystem is ready. When ctx is done, the filesystem is unmounted.
+func Mount(ctx context.Context, repoPath, mountDir string, opts Options) (*Handle, error) {
+	initLogging(opts)
+	if IsURL(repoPath) {
+		return mountURL(ctx, repoPath, mountDir, opts)
+	}
+	openOpts := &git.PlainOpenOptions{
+		DetectDotGit:          opts.DetectDotGit,
+		EnableDotGitCommonDir: opts.EnableDotGitCommonDir,
+	}
+	root, err := gitfs.NewRootNodeWithOptions(repoPath, openOpts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create root node: %w", err)
+	}
+	logging.InfoLog.Printf("Mounting %v in %v\n", repoPath, mountDir)
+	return mountRoot(ctx, root, mountDir, opts)
+}
+
+// mountURL mounts a mirror of the remote repository at the given URL. If opts.FetchInterval is set,
+// the mirror is updated periodically.
+func mountURL(ctx context.Context, url, mountDir string, opts Options) (*Handle, error) {
+	cacheDir := opts.CacheDir
+	if cacheDir == "" {
+		var err error
+		cacheDir, err = DefaultCacheDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+	repo, err := openMirror(ctx, url, cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	logging.InfoLog.Printf("Mounting %v in %v\n", url, mountDir)
+	root := gitfs.NewRootNodeFromRepo(repo)
+	root.SetMountInfo(gitfs.MountInfo{RepoPath: url})
+	h, err := mountRoot(ctx, root, mountDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.FetchInterval > 0 {
+		go h.fetchPeriodically(ctx, mirrorPath(cacheDir, url), opts.FetchInterval)
+	}
+	return h, nil
+}
+
+// MountRepository works like Mount, but mounts an already opened repository. The repository may use any storage,
+// e.g. one created by memory.NewStorage. DetectDotGit and EnableDotGitCommonDir are ignored.
+func MountRepository(ctx context.Context, repo *git.Repository, mountDir string, opts Options) (*Handle, error) {
+	initLogging(opts)
+	logging.InfoLog.Printf("Mounting repository in %v\n", mountDir)
+	return mountRoot(ctx, gitfs.NewRootNodeFromRepo(repo), mountDir, opts)
+}
+
+// mountRoot validates the mountpoint and starts the FUSE server serving the given root node.
+func mountRoot(ctx context.Context, root *gitfs.RootNode, mountDir string, opts Options) (*Handle, error) {
+	mountDir, err := mountpoint.ValidateMountpoint(mountDir, opts.AllowNonEmpty)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mountpoint: %w", err)
+	}
+
+	fsOpts, err := fuseOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	root.SetMountInfo(gitfs.MountInfo{RepoPath: root.MountInfo().RepoPath, Options: opts.describe()})
+	root.SetWritableRefs(opts.WritableRefs)
+	root.SetRawLFSPointers(opts.RawLFSPointers)
+	if opts.CommitAuthor != "" {
+		name, email, err := parseAuthor(opts.CommitAuthor)
+		if err != nil {
+			return nil, err
+		}
+		root.SetCommitAuthor(name, email)
+	}
+	server, err := fs.Mount(mountDir, root, fsOpts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot start FUSE server: %w", err)
+	}
+
+	h := &Handle{server: server, root: root, mountDir: mountDir}
+	err = h.serveMetrics(opts)
+	if err != nil {
+		_ = h.Unmount()
+		return nil, fmt.Errorf("cannot serve metrics: %w", err)
+	}
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				err := h.Unmount()
+				if err != nil {
+					logging.ErrorLog.Printf("%v", err)
+				}
+			case <-waitChan(server):
+			}
+		}()
+	}
+	return h, nil
+}
+
+// waitChan returns a channel which is closed when the server stops.
+func waitChan(server *fuse.Server) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		server.Wait()
+		close(done)
+	}()
+	return done
+}
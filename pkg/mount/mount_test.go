@@ -0,0 +1,217 @@
+package mount
+
+import (
+	"context"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"gogitfs/pkg/logging"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// addCommit creates a commit modifying a single file in the repository's worktree.
+func addCommit(t *testing.T, repo *git.Repository, repoDir, msg string) plumbing.Hash {
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Cannot get worktree: %v", err)
+	}
+	err = os.WriteFile(path.Join(repoDir, "file"), []byte(msg), 0644)
+	if err != nil {
+		t.Fatalf("Cannot write file: %v", err)
+	}
+	_, err = wt.Add("file")
+	if err != nil {
+		t.Fatalf("Cannot add file: %v", err)
+	}
+	sig := &object.Signature{Name: "Foo", Email: "foo@bar.com", When: time.Now()}
+	hash, err := wt.Commit(msg, &git.CommitOptions{Author: sig, Committer: sig})
+	if err != nil {
+		t.Fatalf("Cannot commit: %v", err)
+	}
+	return hash
+}
+
+// dirEntries returns the names of files in the directory.
+func dirEntries(t *testing.T, p string) []string {
+	entries, err := os.ReadDir(p)
+	assert.NoError(t, err, "unexpected error when reading %v", p)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestMount(t *testing.T) {
+	repoDir := t.TempDir()
+	repo, err := git.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatalf("Cannot create repository: %v", err)
+	}
+	first := addCommit(t, repo, repoDir, "first")
+
+	mountDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handle, err := Mount(ctx, repoDir, mountDir, DefaultOptions())
+	if err != nil {
+		t.Fatalf("Cannot mount repository: %v", err)
+	}
+	defer func() {
+		_ = handle.Unmount()
+	}()
+
+	assert.Equal(t, mountDir, handle.MountDir(), "incorrect mount directory")
+	assert.Contains(t, dirEntries(t, path.Join(mountDir, "commits")), first.String(), "commit should be listed")
+	branchDir := path.Join(mountDir, "branches", "master")
+	assert.Contains(t, dirEntries(t, branchDir), first.String(), "commit should be on the branch")
+
+	t.Run("refresh", func(t *testing.T) {
+		second := addCommit(t, repo, repoDir, "second")
+		handle.Refresh()
+		assert.Contains(t, dirEntries(t, branchDir), second.String(), "new commit should be on the branch")
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			handle.Wait()
+			close(done)
+		}()
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("filesystem was not unmounted after cancelling the context")
+		}
+		_, err := os.Stat(path.Join(mountDir, "commits"))
+		assert.True(t, os.IsNotExist(err), "mount directory should be empty")
+	})
+}
+
+// makeMemoryRepo creates a repository stored in memory, containing a single commit.
+func makeMemoryRepo(t *testing.T) (*git.Repository, plumbing.Hash) {
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatalf("Cannot create repository: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("Cannot get worktree: %v", err)
+	}
+	sig := &object.Signature{Name: "Foo", Email: "foo@bar.com", When: time.Now()}
+	hash, err := wt.Commit("foo", &git.CommitOptions{Author: sig, Committer: sig, AllowEmptyCommits: true})
+	if err != nil {
+		t.Fatalf("Cannot commit: %v", err)
+	}
+	return repo, hash
+}
+
+func TestMountRepository(t *testing.T) {
+	repo, hash := makeMemoryRepo(t)
+	mountDir := t.TempDir()
+	handle, err := MountRepository(context.Background(), repo, mountDir, DefaultOptions())
+	if err != nil {
+		t.Fatalf("Cannot mount repository: %v", err)
+	}
+	defer func() {
+		_ = handle.Unmount()
+	}()
+	assert.Contains(t, dirEntries(t, path.Join(mountDir, "commits")), hash.String(), "commit should be listed")
+}
+
+func TestMountRepository_logging(t *testing.T) {
+	repo, _ := makeMemoryRepo(t)
+	logging.Init(logging.Warning)
+	defer logging.Init(logging.Info)
+	defer logging.KeepRecentLines(0)
+	mount := func(opts Options) {
+		handle, err := MountRepository(context.Background(), repo, t.TempDir(), opts)
+		if err != nil {
+			t.Fatalf("Cannot mount repository: %v", err)
+		}
+		_ = handle.Unmount()
+	}
+
+	mount(DefaultOptions())
+	assert.Equal(t, logging.Warning, logging.Level(), "logging should not be reconfigured by default")
+	assert.Nil(t, logging.RecentLines(), "recent lines should not be kept by default")
+
+	opts := DefaultOptions()
+	opts.InitLogging = true
+	mount(opts)
+	assert.Equal(t, logging.Info, logging.Level(), "logging should be configured with InitLogging")
+	assert.NotNil(t, logging.RecentLines(), "recent lines should be kept with InitLogging")
+}
+
+func TestMount_metrics(t *testing.T) {
+	repoDir := t.TempDir()
+	repo, err := git.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatalf("Cannot create repository: %v", err)
+	}
+	first := addCommit(t, repo, repoDir, "first")
+
+	mountDir := t.TempDir()
+	opts := DefaultOptions()
+	opts.MetricsAddr = "127.0.0.1:0"
+	handle, err := Mount(context.Background(), repoDir, mountDir, opts)
+	if err != nil {
+		t.Fatalf("Cannot mount repository: %v", err)
+	}
+	defer func() {
+		_ = handle.Unmount()
+	}()
+	_, err = os.ReadDir(path.Join(mountDir, "commits", first.String()))
+	assert.NoError(t, err, "cannot read commit directory")
+
+	resp, err := http.Get("http://" + handle.MetricsAddr() + "/metrics")
+	if !assert.NoError(t, err, "cannot get metrics") {
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err, "cannot read metrics")
+	for _, metric := range []string{
+		`gogitfs_operation_duration_seconds_count{node="allCommitsNode",op="Lookup"}`,
+		`gogitfs_operation_duration_seconds_count{node="commitNode",op="Readdir"}`,
+		`gogitfs_object_read_duration_seconds_count{type="commit"}`,
+		`gogitfs_inode_cache_requests_total{result="miss"}`,
+		`gogitfs_live_inodes`,
+	} {
+		assert.Contains(t, string(body), metric, "metric should be exposed")
+	}
+}
+
+func TestOptions_describe(t *testing.T) {
+	opts := DefaultOptions()
+	opts.FetchInterval = time.Minute
+	lines := opts.describe()
+	assert.Contains(t, lines, "LogLevel=INFO", "log level should be described by name")
+	assert.Contains(t, lines, "FetchInterval=1m0s", "durations should be formatted")
+	assert.Contains(t, lines, "UID=-1", "UID should be described")
+
+	opts.Flags = []string{"--log-level=INFO"}
+	assert.Equal(t, opts.Flags, opts.describe(), "flags should be used if given")
+}
+
+func Test_parseAuthor(t *testing.T) {
+	name, email, err := parseAuthor(" Aaa Bbb <aaa@bbb.com> ")
+	assert.NoError(t, err, "unexpected error when parsing author")
+	assert.Equal(t, "Aaa Bbb", name, "incorrect name")
+	assert.Equal(t, "aaa@bbb.com", email, "incorrect email")
+	for _, author := range []string{"Aaa Bbb", "<aaa@bbb.com>", "Aaa <>", "Aaa <aaa@bbb.com", "Aaa <a<b>"} {
+		_, _, err = parseAuthor(author)
+		assert.Error(t, err, "%q should be rejected", author)
+	}
+}